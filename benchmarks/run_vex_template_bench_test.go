@@ -0,0 +1,88 @@
+package bench_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/gi8lino/vex/pkg/vex"
+)
+
+// ---------------- Vex library: streaming vs. compiled -----------------
+
+// loadTemplates reads files into memory so only rendering is measured.
+func loadTemplates(b *testing.B, files []string) [][]byte {
+	b.Helper()
+	srcs := make([][]byte, 0, len(files))
+	for _, p := range files {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			b.Fatalf("ReadFile: %v", err)
+		}
+		srcs = append(srcs, data)
+	}
+	return srcs
+}
+
+// benchStreaming re-parses every template on each iteration.
+func benchStreaming(b *testing.B, n, size int) {
+	b.ReportAllocs()
+	files, total := makeFiles(b, b.TempDir(), n, size, BenchExtendedPattern)
+	srcs := loadTemplates(b, files)
+	x := vex.New(vex.WithLookup(benchLookup))
+
+	b.SetBytes(total)
+	b.ResetTimer()
+
+	for b.Loop() {
+		for _, src := range srcs {
+			if err := x.Expand(bytes.NewReader(src), io.Discard); err != nil {
+				b.Fatalf("Expand err=%v", err)
+			}
+		}
+	}
+}
+
+// benchCompiled parses every template once and only renders in the loop.
+func benchCompiled(b *testing.B, n, size int) {
+	b.ReportAllocs()
+	files, total := makeFiles(b, b.TempDir(), n, size, BenchExtendedPattern)
+	srcs := loadTemplates(b, files)
+	x := vex.New()
+	tpls := make([]*vex.Template, 0, len(srcs))
+	for _, src := range srcs {
+		tpl, err := x.Compile(bytes.NewReader(src))
+		if err != nil {
+			b.Fatalf("Compile err=%v", err)
+		}
+		tpls = append(tpls, tpl)
+	}
+
+	b.SetBytes(total)
+	b.ResetTimer()
+
+	for b.Loop() {
+		for _, tpl := range tpls {
+			if err := tpl.Execute(benchLookup, io.Discard); err != nil {
+				b.Fatalf("Execute err=%v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkVexTemplate_Streaming_ManySmallFiles(b *testing.B) {
+	benchStreaming(b, BenchNumSmallFiles, BenchSmallFileSize)
+}
+
+func BenchmarkVexTemplate_Compiled_ManySmallFiles(b *testing.B) {
+	benchCompiled(b, BenchNumSmallFiles, BenchSmallFileSize)
+}
+
+func BenchmarkVexTemplate_Streaming_OneBigFile(b *testing.B) {
+	benchStreaming(b, 1, BenchBigFileSize)
+}
+
+func BenchmarkVexTemplate_Compiled_OneBigFile(b *testing.B) {
+	benchCompiled(b, 1, BenchBigFileSize)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/gi8lino/vex/internal/app"
+	"github.com/gi8lino/vex/internal/xerr"
 )
 
 var (
@@ -24,6 +25,6 @@ func main() {
 		os.Setenv,
 	); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(xerr.ExitCode(err))
 	}
 }
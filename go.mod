@@ -3,8 +3,8 @@ module github.com/gi8lino/vex
 go 1.25.0
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/containeroo/tinyflags v0.0.80
 	github.com/stretchr/testify v1.12.1
+	go.yaml.in/yaml/v3 v3.0.5
 )
-
-require go.yaml.in/yaml/v3 v3.0.5 // indirect
@@ -2,13 +2,21 @@ package app
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"os"
+	"slices"
 
+	"github.com/gi8lino/vex/internal/config"
+	"github.com/gi8lino/vex/internal/env"
 	"github.com/gi8lino/vex/internal/flag"
 	"github.com/gi8lino/vex/internal/formatter"
 	"github.com/gi8lino/vex/internal/processor"
 	"github.com/gi8lino/vex/internal/utils"
+	"github.com/gi8lino/vex/internal/varsfile"
+	"github.com/gi8lino/vex/internal/xerr"
 
 	"github.com/containeroo/tinyflags"
 )
@@ -35,44 +43,181 @@ func Run(
 		return err
 	}
 
-	// Merge external vars (multiple files allowed).
-	if len(flags.VarsFiles) > 0 {
-		lookupEnv, err = utils.MergeVars(flags.VarsFiles, lookupEnv)
-		if err != nil {
-			return err
+	// Print the options merged from the config file and the command line.
+	if flags.PrintConfig {
+		return config.Write(out, flags.Config, flags.Profile, flags.Effective())
+	}
+
+	// Restore backups; nothing is rendered, so no variables are loaded.
+	if flags.Restore {
+		if len(flags.Positional) == 0 {
+			return errors.New("--restore needs files")
+		}
+		pr := processor.NewProcessor(flags, nil, nil, nil, formatter.NewFormatter(false), ioBufSize)
+		for _, p := range flags.Positional {
+			if err := pr.Restore(p); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+
+	// Variables resolve through one chain:
+	// assigned (${VAR:=word}) > --set > --vars-dir/--extra-vars > host environment.
+	host := env.Host{Get: lookupEnv, Environ: os.Environ, Allow: flags.EnvAllow, Disabled: flags.NoEnv}
+	sets := env.ParseSet(flags.Set)
+	vars, err := utils.MergeVars(flags.VarsDirs, flags.VarsFiles, varsfile.Options{
+		Separator:   flags.VarsSeparator,
+		Case:        varsfile.Case(flags.VarsCase),
+		JSON:        flags.VarsJSON,
+		TrimNewline: flags.VarsDirTrim,
+		Sanitize:    flags.VarsDirSanitize,
+		Interpolate: flags.VarsInterpolate,
+	}, env.Chain{sets, host}.Lookup)
+	if err != nil {
+		return err
+	}
+	if err := loadFilterLists(&flags, vars); err != nil {
+		return err
+	}
+	assigned := env.Map{}
+	var chain env.Source = env.Chain{assigned, sets, env.Map(vars), host}
+
+	// Resolve unset VAR from VAR_FILE (opt-in).
+	var resolve func(string) (string, bool, error)
+	if flags.FileEnv {
+		files := &env.Files{Next: chain, Dirs: flags.FileEnvDirs, MaxSize: flags.FileEnvMaxSize}
+		chain, resolve = files, files.Resolve
+	}
+
+	// Assignments are visible to later references and passed on to setEnv.
+	assign := func(k, v string) error {
+		_ = assigned.Set(k, v)
+		if setEnv == nil {
+			return nil
+		}
+		return setEnv(k, v)
 	}
 
 	// Instantiate processor.
 	pr := processor.NewProcessor(
 		flags,
-		lookupEnv,
-		setEnv,
-		formatter.NewFormatter(flags.Colored),
+		chain.Lookup,
+		chain.Names, // ${!PREFIX*}
+		assign,
+		formatter.NewFormatter(flags.Colored && !flags.Diff && !flags.DryRun), // previews color the diff only
 		ioBufSize,
 	)
+	if resolve != nil {
+		pr.SetResolve(resolve)
+	}
 
 	// Prepare buffered writer once; only used in code paths that write to stdout.
 	bw := bufio.NewWriterSize(out, ioBufSize)
 
+	// Check only: validate templates and the environment, write nothing.
+	if flags.Check {
+		if len(flags.Positional) == 0 {
+			err = pr.ProcessStdin(bufio.NewReaderSize(in, ioBufSize), bufio.NewWriterSize(io.Discard, ioBufSize))
+		} else {
+			err = pr.CheckFiles(flags.Positional, ioBufSize)
+		}
+		if err != nil {
+			return err
+		}
+		return checkResult(pr.Report())
+	}
+
+	// Analysis only: list referenced variables instead of expanding.
+	if flags.ListVars {
+		usages, err := pr.ListVars(flags.Positional, bufio.NewReaderSize(in, ioBufSize), ioBufSize)
+		if err != nil {
+			return err
+		}
+		if err := pr.Report(); err != nil {
+			return err
+		}
+		if err := processor.WriteVarList(bw, usages, flags.JSON); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+
+	// Preview in-place edits: exit 1 when files would change, 2 on errors (like diff).
+	if flags.Diff || flags.DryRun {
+		if len(flags.Positional) == 0 {
+			return errors.New("--diff and --dry-run need files")
+		}
+		changed, err := pr.DiffFiles(flags.Positional, bw, ioBufSize)
+		if err != nil {
+			return xerr.WithExitCode(2, err)
+		}
+		if err := pr.Report(); err != nil {
+			return xerr.WithExitCode(2, err)
+		}
+		if changed > 0 {
+			return xerr.WithExitCode(1, fmt.Errorf("%d of %d files would change", changed, len(flags.Positional)))
+		}
+		return nil
+	}
+
+	// Directory rendering: the source tree -> --output-dir.
+	if flags.OutputDir != "" {
+		if len(flags.Positional) != 1 {
+			return errors.New("--output-dir expects exactly one source directory")
+		}
+		if err := pr.ProcessTree(flags.Positional[0], flags.OutputDir, ioBufSize); err != nil {
+			return err
+		}
+		return pr.Report()
+	}
+
 	// No positional args: stream stdin -> stdout.
 	if len(flags.Positional) == 0 {
 		br := bufio.NewReaderSize(in, ioBufSize)
 		if err := pr.ProcessStdin(br, bw); err != nil {
 			return err
 		}
-		return bw.Flush()
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		return pr.Report()
 	}
 
 	// In-place editing for positional files.
 	if flags.InPlace {
+		// Files the substitution leaves as they are are not rewritten; --status says which.
+		if flags.Status {
+			pr.SetStatus(func(path string, changed bool) {
+				state := "unchanged"
+				if changed {
+					state = "changed"
+				}
+				_, _ = fmt.Fprintf(bw, "%s: %s\n", path, state)
+			})
+			defer func() { _ = bw.Flush() }()
+		}
+		// With --atomic-all, replace the files only when all of them rendered.
+		if flags.AtomicAll {
+			if err := pr.ProcessInPlaceAll(flags.Positional, ioBufSize); err != nil {
+				return err
+			}
+			return pr.Report()
+		}
+		// With --report-all, render every file before rewriting any of them.
+		if flags.ReportAll {
+			if err := pr.ProcessInPlaceChecked(flags.Positional, ioBufSize); err != nil {
+				return err
+			}
+			return pr.Report()
+		}
 		for _, p := range flags.Positional {
 			if err := pr.ProcessInPlace(p, ioBufSize); err != nil {
 				return err
 			}
 		}
 		// Nothing buffered to flush in this branch (writes go to files).
-		return nil
+		return pr.Report()
 	}
 
 	// Positional files -> stdout (concatenate in order).
@@ -82,5 +227,44 @@ func Run(
 
 	_ = bw.Flush()
 
+	return pr.Report()
+}
+
+// checkResult maps --check findings to exit codes: 2 when a template is
+// malformed, 3 when templates are valid but the environment is incomplete.
+func checkResult(err error) error {
+	if err == nil {
+		return nil
+	}
+	if xerr.IsSyntax(err) {
+		return xerr.WithExitCode(2, err)
+	}
+	return xerr.WithExitCode(3, err)
+}
+
+// loadFilterLists appends the entries of the filter list files and, with
+// --variables-from-vars, the names vars defines to the filter lists.
+func loadFilterLists(flags *flag.Options, vars map[string]string) error {
+	for _, l := range []struct {
+		files []string
+		list  *[]string
+	}{
+		{flags.VariablesFiles, &flags.Variables},
+		{flags.PrefixFiles, &flags.Prefix},
+		{flags.SuffixFiles, &flags.Suffix},
+		{flags.ExcludeVariablesFiles, &flags.ExcludeVariables},
+		{flags.ExcludePrefixFiles, &flags.ExcludePrefix},
+	} {
+		for _, f := range l.files {
+			entries, err := utils.ReadList(f)
+			if err != nil {
+				return err
+			}
+			*l.list = append(*l.list, entries...)
+		}
+	}
+	if flags.VariablesFromVars {
+		flags.Variables = append(flags.Variables, slices.Sorted(maps.Keys(vars))...)
+	}
 	return nil
 }
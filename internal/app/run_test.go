@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/gi8lino/vex/internal/app"
+	"github.com/gi8lino/vex/internal/xerr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -48,7 +49,7 @@ func TestRun(t *testing.T) {
 
 		lookupEnv := func(string) (string, bool) { return "", false }
 
-		err := app.Run("v", "c", []string{}, &out, strings.NewReader(input), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader(input), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, input, out.String())
 	})
@@ -58,9 +59,9 @@ func TestRun(t *testing.T) {
 		var out bytes.Buffer
 
 		lookupEnv := func(string) (string, bool) { return "", false }
-		err := app.Run("v", "c", []string{}, &out, strings.NewReader("${VAR?boom}"), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader("${VAR?boom}"), lookupEnv, nil)
 		require.Error(t, err)
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, "<stdin>:1:1: VAR: boom")
 	})
 
 	t.Run("success with rewrite", func(t *testing.T) {
@@ -77,7 +78,7 @@ func TestRun(t *testing.T) {
 		}
 
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{"-i", "--backup", ".bak", p}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "-i", "--backup", ".bak", p}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.NoError(t, err)
 
 		got, rerr := os.ReadFile(p)
@@ -99,9 +100,9 @@ func TestRun(t *testing.T) {
 		lookupEnv := func(string) (string, bool) { return "", false }
 
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{"-i", p}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "-i", p}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.Error(t, err)
-		assert.EqualError(t, err, "X: boom")
+		assert.EqualError(t, err, p+":1:1: X: boom")
 	})
 
 	t.Run("io error open missing file is classified", func(t *testing.T) {
@@ -112,7 +113,7 @@ func TestRun(t *testing.T) {
 		lookupEnv := func(string) (string, bool) { return "", false }
 
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{"-i", missing}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "-i", missing}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.Error(t, err)
 
 		msg := err.Error()
@@ -145,7 +146,7 @@ func TestRun(t *testing.T) {
 			}
 		}
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{f1, f2}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", f1, f2}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.NoError(t, err)
 		// First file: default a; second file: B expands to bee
 		assert.Equal(t, "A=a\nB=bee\n", out.String())
@@ -160,7 +161,7 @@ func TestRun(t *testing.T) {
 		lookupEnv := func(string) (string, bool) { return "", false }
 
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{missing}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", missing}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.Error(t, err)
 		assert.EqualError(t, err, "open "+missing+": no such file or directory")
 	})
@@ -174,9 +175,9 @@ func TestRun(t *testing.T) {
 		lookupEnv := func(string) (string, bool) { return "", false }
 
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{f}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", f}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.Error(t, err)
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, f+":1:1: VAR: boom")
 	})
 
 	t.Run("variables at line start and line end", func(t *testing.T) {
@@ -189,7 +190,7 @@ end-is-var ${C:-Z}`
 		lookupEnv := func(string) (string, bool) { return "", false }
 
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{}, &out, strings.NewReader(in), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader(in), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, want, out.String())
 	})
@@ -205,7 +206,7 @@ end-is-var ${C:-Z}`
 			}
 			return "", false
 		}
-		err := app.Run("v", "c", []string{}, &out, strings.NewReader(in), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader(in), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, "hi Ada", out.String())
 	})
@@ -215,7 +216,7 @@ end-is-var ${C:-Z}`
 		in := "${A:-x"
 		var out bytes.Buffer
 		lookupEnv := func(string) (string, bool) { return "", false }
-		err := app.Run("v", "c", []string{}, &out, strings.NewReader(in), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader(in), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, in, out.String())
 	})
@@ -230,7 +231,7 @@ end-is-var ${C:-Z}`
 			}
 			return "", false
 		}
-		err := app.Run("v", "c", []string{}, &out, strings.NewReader(in), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader(in), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, "$NAME end", out.String())
 	})
@@ -245,7 +246,7 @@ end-is-var ${C:-Z}`
 			}
 			return "", false
 		}
-		err := app.Run("v", "c", []string{"--literal-dollar"}, &out, strings.NewReader(in), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "--literal-dollar"}, &out, strings.NewReader(in), lookupEnv, nil)
 		require.NoError(t, err)
 		// Backslash is literal, $NAME expands → \Ada
 		assert.Equal(t, `\Ada`, out.String())
@@ -261,7 +262,7 @@ end-is-var ${C:-Z}`
 		}
 		lookupEnv := func(string) (string, bool) { return "", false }
 		var out bytes.Buffer
-		err := app.Run("v", "c", []string{}, &out, strings.NewReader(b.String()), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader(b.String()), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, want.String(), out.String())
 	})
@@ -271,9 +272,9 @@ end-is-var ${C:-Z}`
 		in := "${EMPTY}"
 		var out bytes.Buffer
 		lookupEnv := func(n string) (string, bool) { return "", true }
-		err := app.Run("v", "c", []string{"--strict"}, &out, strings.NewReader(in), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "--strict"}, &out, strings.NewReader(in), lookupEnv, nil)
 		require.Error(t, err)
-		assert.EqualError(t, err, "substitution empty: ${EMPTY}")
+		assert.EqualError(t, err, "<stdin>:1:1: substitution empty: ${EMPTY}")
 	})
 }
 
@@ -314,7 +315,7 @@ ${broken but okay
 			}
 		}
 
-		err := app.Run("v", "c", []string{p}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", p}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, wanted, out.String())
 	})
@@ -343,7 +344,7 @@ ${broken but okay
 			}
 		}
 
-		err := app.Run("v", "c", []string{f1, f2}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", f1, f2}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.NoError(t, err)
 		want := aWant.String() + "X=x\nY=yee\n"
 		assert.Equal(t, want, out.String())
@@ -368,7 +369,7 @@ ${broken but okay
 			}
 		}
 
-		err := app.Run("v", "c", []string{"--prefix", "FOO_", p}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "--prefix", "FOO_", p}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.NoError(t, err)
 		// Only FOO_* expands; BAR_* stays literal
 		assert.Equal(t, "one=1\ntwo=${BAR_TWO}\n", out.String())
@@ -389,7 +390,7 @@ ${broken but okay
 			}
 			return "", false
 		}
-		err := app.Run("v", "c", []string{"--keep-vars", p}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "--keep-vars", p}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, "u=${UNSET}\ne=${EMPTY}\n", out.String())
 	})
@@ -403,7 +404,7 @@ ${broken but okay
 
 		var out bytes.Buffer
 		lookupEnv := func(string) (string, bool) { return "", false }
-		err := app.Run("v", "c", []string{"--no-ops", p}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", "--no-ops", p}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.NoError(t, err)
 		assert.Equal(t, in, out.String())
 	})
@@ -418,17 +419,487 @@ ${broken but okay
 
 		var out bytes.Buffer
 		lookupEnv := func(string) (string, bool) { return "", false }
-		err := app.Run("v", "c", []string{ok, bad}, &out, strings.NewReader(""), lookupEnv, nil)
+		err := app.Run("v", "c", []string{"--no-config", ok, bad}, &out, strings.NewReader(""), lookupEnv, nil)
 		require.Error(t, err)
 		assert.Equal(t, "ok=ok\n", out.String())
 
-		assert.EqualError(t, err, "B: boom")
+		assert.EqualError(t, err, bad+":1:1: B: boom")
+	})
+
+	t.Run("report-all lists errors from every file", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		a := filepath.Join(dir, "a.txt")
+		b := filepath.Join(dir, "b.txt")
+		require.NoError(t, os.WriteFile(a, []byte("x=${X}\ny=${Y}\n"), 0o600))
+		require.NoError(t, os.WriteFile(b, []byte("${Z?needed}\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--report-all", "-u", a, b}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.Error(t, err)
+		assert.EqualError(t, err, a+":\n"+
+			"  1:3: variable not set: ${X}\n"+
+			"  2:3: variable not set: ${Y}\n"+
+			b+":\n"+
+			"  1:1: Z: needed\n"+
+			"3 errors in 2 files")
+	})
+
+	t.Run("report-all in place touches no file when one fails", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		ok := filepath.Join(dir, "ok.txt")
+		bad := filepath.Join(dir, "bad.txt")
+		require.NoError(t, os.WriteFile(ok, []byte("ok=${A:-ok}\n"), 0o600))
+		require.NoError(t, os.WriteFile(bad, []byte("${B?boom}\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--report-all", "-i", ok, bad}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "1 error in 1 file")
+
+		got, rerr := os.ReadFile(ok)
+		require.NoError(t, rerr)
+		assert.Equal(t, "ok=${A:-ok}\n", string(got))
+	})
+
+	t.Run("report-all in place rewrites when all succeed", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		ok := filepath.Join(dir, "ok.txt")
+		require.NoError(t, os.WriteFile(ok, []byte("ok=${A:-ok}\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--report-all", "-i", ok}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.NoError(t, err)
+
+		got, rerr := os.ReadFile(ok)
+		require.NoError(t, rerr)
+		assert.Equal(t, "ok=ok\n", string(got))
+	})
+
+	t.Run("report-all in place renders each file once", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		a := filepath.Join(dir, "a.txt")
+		b := filepath.Join(dir, "b.txt")
+		require.NoError(t, os.WriteFile(a, []byte("${A}\n"), 0o600))
+		require.NoError(t, os.WriteFile(b, []byte("${A}\n"), 0o600))
+
+		var out bytes.Buffer
+		lookups := 0
+		lookupEnv := func(k string) (string, bool) { lookups++; return "x", k == "A" }
+		err := app.Run("v", "c", []string{"--no-config", "--report-all", "-i", a, b}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2, lookups)
+
+		got, rerr := os.ReadFile(b)
+		require.NoError(t, rerr)
+		assert.Equal(t, "x\n", string(got))
+	})
+
+	t.Run("list-vars prints referenced names", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		in := "$A ${B:-${C}} $A"
+		err := app.Run("v", "c", []string{"--no-config", "--list-vars"}, &out, strings.NewReader(in), nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "A\nB\nC\n", out.String())
+	})
+
+	t.Run("list-vars json", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--list-vars", "--json"}, &out, strings.NewReader("${A:-x}"), nil, nil)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"name":"A","default":true,"operators":[":-"],"occurrences":[{"file":"<stdin>","line":1,"column":1,"operator":":-","default":true}]}]`, out.String())
+	})
+
+	t.Run("check passes valid template without output", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		f := filepath.Join(dir, "ok.txt")
+		require.NoError(t, os.WriteFile(f, []byte("a=${A:-x}\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--check", "--strict", f}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("check exits 2 on malformed template", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--check", "-u"}, &out, strings.NewReader("${A} ${B@Z}"), lookupEnv, nil)
+		require.Error(t, err)
+		assert.Equal(t, 2, xerr.ExitCode(err))
+		assert.Contains(t, err.Error(), "1:6: syntax error: unknown quoting mode: ${B@Z}")
+		assert.Contains(t, err.Error(), "1:1: variable not set: ${A}")
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("check exits 3 on incomplete environment", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		f := filepath.Join(dir, "env.txt")
+		require.NoError(t, os.WriteFile(f, []byte("${A}\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--check", "--strict", f}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.Error(t, err)
+		assert.Equal(t, 3, xerr.ExitCode(err))
+		assert.EqualError(t, err, f+":\n  1:1: variable not set: ${A}\n1 error in 1 file")
+	})
+
+	t.Run("Prefix listing includes extra vars", func(t *testing.T) {
+		t.Parallel()
+		vars := filepath.Join(t.TempDir(), "vars.env")
+		require.NoError(t, os.WriteFile(vars, []byte("VEXTEST_B=2\nVEXTEST_A=1\nVEXTEST_REF=VEXTEST_B\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--extra-vars", vars}, &out, strings.NewReader("${!VEXTEST_*} ${!VEXTEST_REF}"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "VEXTEST_A VEXTEST_B VEXTEST_REF 2", out.String())
+	})
+
+	t.Run("Vars dir", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "db-password"), []byte("s3cret\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "", false }
+		err := app.Run("v", "c", []string{"--no-config", "--vars-dir", dir, "--vars-dir-trim", "--vars-dir-sanitize"}, &out, strings.NewReader("[$db_password]"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "[s3cret]", out.String())
+	})
+
+	t.Run("File env", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		secret := filepath.Join(dir, "db")
+		require.NoError(t, os.WriteFile(secret, []byte("s3cret\n"), 0o600))
+		env := map[string]string{"VEXTEST_PW_FILE": secret, "VEXTEST_BAD_FILE": filepath.Join(dir, "nope")}
+		lookupEnv := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--file-env"}, &out, strings.NewReader("[$VEXTEST_PW]"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "[s3cret]", out.String())
+
+		out.Reset()
+		err = app.Run("v", "c", []string{"--no-config", "--file-env"}, &out, strings.NewReader("ok\n${VEXTEST_BAD:-x}"), lookupEnv, nil)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, xerr.ErrLookup)
+		assert.EqualError(t, err, "<stdin>:2:1: lookup failed: VEXTEST_BAD_FILE: open "+env["VEXTEST_BAD_FILE"]+": no such file or directory")
+
+		out.Reset()
+		err = app.Run("v", "c", []string{"--no-config"}, &out, strings.NewReader("[$VEXTEST_PW]"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "[]", out.String()) // opt-in
+	})
+
+	t.Run("Precedence set > files > env", func(t *testing.T) {
+		t.Parallel()
+		vars := filepath.Join(t.TempDir(), "vars.env")
+		require.NoError(t, os.WriteFile(vars, []byte("A=file\nB=file\nD=${S}-${C}\n"), 0o600))
+		env := map[string]string{"A": "env", "B": "env", "C": "env"}
+		lookupEnv := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--extra-vars", vars, "--vars-interpolate", "--set", "A=set", "--set", "S=s"}, &out, strings.NewReader("$A $B $C $D"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "set file env s-env", out.String())
+	})
+
+	t.Run("No env hides the host environment", func(t *testing.T) {
+		t.Parallel()
+		env := map[string]string{"HOME": "/root", "APP_URL": "u"}
+		lookupEnv := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--no-env", "--set", "X=1"}, &out, strings.NewReader("[$HOME][$APP_URL][$X]"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "[][][1]", out.String())
+
+		out.Reset()
+		err = app.Run("v", "c", []string{"--no-config", "--env-allow", "APP_*"}, &out, strings.NewReader("[$HOME][$APP_URL]"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "[][u]", out.String())
+	})
+
+	t.Run("Assignments are visible and passed on", func(t *testing.T) {
+		t.Parallel()
+		var got []string
+		setEnv := func(k, v string) error { got = append(got, k+"="+v); return nil }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--no-env"}, &out, strings.NewReader("${X:=1} $X"), nil, setEnv)
+		require.NoError(t, err)
+		assert.Equal(t, "1 1", out.String())
+		assert.Equal(t, []string{"X=1"}, got)
+	})
+
+	t.Run("Exclusions keep nginx variables", func(t *testing.T) {
+		t.Parallel()
+		lookupEnv := func(k string) (string, bool) { return "backend:8080", k == "UPSTREAM" }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--exclude-variable", "host,uri", "--strict"}, &out, strings.NewReader("proxy_pass http://$UPSTREAM$uri; # $host"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "proxy_pass http://backend:8080$uri; # $host", out.String())
+	})
+
+	t.Run("Filter lists from files", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		allow := filepath.Join(dir, "allow.txt")
+		require.NoError(t, os.WriteFile(allow, []byte("# substituted\nUPSTREAM\nPORT # listen\n"), 0o600))
+		deny := filepath.Join(dir, "deny.txt")
+		require.NoError(t, os.WriteFile(deny, []byte("UP\n"), 0o600))
+		empty := filepath.Join(dir, "empty.txt")
+		require.NoError(t, os.WriteFile(empty, []byte("# nothing yet\n"), 0o600))
+		lookupEnv := func(k string) (string, bool) { return "x", true }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--variables-file", allow, "--exclude-prefixes-file", deny}, &out, strings.NewReader("$UPSTREAM $PORT $host"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "$UPSTREAM x $host", out.String())
+
+		out.Reset()
+		err = app.Run("v", "c", []string{"--no-config", "--variables-file", empty}, &out, strings.NewReader("$PORT"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "$PORT", out.String()) // an empty list allows nothing
+
+		err = app.Run("v", "c", []string{"--no-config", "--variables-file", filepath.Join(dir, "nope")}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Variables from vars files", func(t *testing.T) {
+		t.Parallel()
+		vars := filepath.Join(t.TempDir(), "vars.env")
+		require.NoError(t, os.WriteFile(vars, []byte("UPSTREAM=backend\n"), 0o600))
+		lookupEnv := func(k string) (string, bool) { return "env", true }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "--extra-vars", vars, "--variables-from-vars"}, &out, strings.NewReader("$UPSTREAM $host"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "backend $host", out.String())
+	})
+
+	t.Run("Auto-escape by file extension", func(t *testing.T) {
+		t.Parallel()
+		tpl := filepath.Join(t.TempDir(), "values.yaml")
+		require.NoError(t, os.WriteFile(tpl, []byte("a: \"$MSG\"\nb: '$MSG'\n"), 0o600))
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return `it's "x"`, true }
+		err := app.Run("v", "c", []string{"--no-config", "--auto-escape", tpl}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "a: \"it's \\\"x\\\"\"\nb: 'it''s \"x\"'\n", out.String())
+	})
+
+	t.Run("Auto-escape stdin with format", func(t *testing.T) {
+		t.Parallel()
+
+		var out bytes.Buffer
+		lookupEnv := func(string) (string, bool) { return "a b", true }
+		err := app.Run("v", "c", []string{"--no-config", "--format", "shell"}, &out, strings.NewReader("echo $X"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "echo 'a b'", out.String())
+	})
+
+	t.Run("Config file with profile", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		cfg := filepath.Join(dir, ".vex.yaml")
+		require.NoError(t, os.WriteFile(cfg, []byte(`
+set: {ENV: dev}
+overrides:
+  - files: ["*.json"]
+    format: json
+profiles:
+  prod:
+    set: {ENV: prod}
+    strict: true
+`), 0o600))
+		tpl := filepath.Join(dir, "app.json")
+		require.NoError(t, os.WriteFile(tpl, []byte(`{"env": "$ENV", "msg": "$MSG"}`), 0o600))
+		lookupEnv := func(k string) (string, bool) { return `say "hi"`, k == "MSG" }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--config", cfg, "--profile", "prod", tpl}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, `{"env": "prod", "msg": "say \"hi\""}`, out.String())
+
+		out.Reset()
+		err = app.Run("v", "c", []string{"--config", cfg, "--profile", "prod"}, &out, strings.NewReader("$UNSET"), lookupEnv, nil)
+		require.Error(t, err)
+		assert.EqualError(t, err, "<stdin>:1:1: variable not set: $UNSET")
+
+		out.Reset()
+		err = app.Run("v", "c", []string{"--config", cfg, "--profile", "prod", "--no-strict"}, &out, strings.NewReader("[$UNSET]"), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "[]", out.String())
+	})
+
+	t.Run("Print config", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		cfg := filepath.Join(dir, ".vex.yaml")
+		require.NoError(t, os.WriteFile(cfg, []byte("strict: true\nprefix: [APP_]\nprofiles:\n  ci:\n    keep-unset: true\n"), 0o600))
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--config", cfg, "--profile", "ci", "-p", "CLI_", "--print-config"}, &out, strings.NewReader(""), nil, nil)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "# config: "+cfg+"\n# profile: ci\n")
+		assert.Contains(t, out.String(), "\nstrict: true\n")
+		assert.Contains(t, out.String(), "\nkeep-unset: true\n")
+		assert.Contains(t, out.String(), "\nprefix:\n  - CLI_\n")
+	})
+
+	t.Run("Output dir renders a tree", func(t *testing.T) {
+		t.Parallel()
+		src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+		require.NoError(t, os.MkdirAll(filepath.Join(src, "conf"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, "conf", "app.conf.tmpl"), []byte("port=$PORT"), 0o640))
+		require.NoError(t, os.WriteFile(filepath.Join(src, "README"), []byte("$PORT"), 0o644))
+
+		err := app.Run("v", "c", []string{"--no-config", "--output-dir", dst, "--include", "*.tmpl", "--strip-suffix", ".tmpl", src},
+			nil, strings.NewReader(""), func(string) (string, bool) { return "8080", true }, nil)
+		require.NoError(t, err)
+
+		b, err := os.ReadFile(filepath.Join(dst, "conf", "app.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "port=8080", string(b))
+		b, err = os.ReadFile(filepath.Join(dst, "README"))
+		require.NoError(t, err)
+		assert.Equal(t, "$PORT", string(b))
+	})
+
+	t.Run("Output dir needs one source", func(t *testing.T) {
+		t.Parallel()
+		err := app.Run("v", "c", []string{"--no-config", "--output-dir", t.TempDir()}, nil, strings.NewReader(""), nil, nil)
+		require.Error(t, err)
+		assert.EqualError(t, err, "--output-dir expects exactly one source directory")
+	})
+
+	t.Run("Diff previews in-place edits", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		changing, static := filepath.Join(dir, "a.conf"), filepath.Join(dir, "b.conf")
+		require.NoError(t, os.WriteFile(changing, []byte("port=$PORT\n"), 0o644))
+		require.NoError(t, os.WriteFile(static, []byte("static\n"), 0o644))
+		lookupEnv := func(string) (string, bool) { return "8080", true }
+
+		var out bytes.Buffer
+		err := app.Run("v", "c", []string{"--no-config", "-i", "--backup", ".bak", "--diff", changing, static}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.Error(t, err)
+		assert.EqualError(t, err, "1 of 2 files would change")
+		assert.Equal(t, 1, xerr.ExitCode(err))
+		assert.Equal(t, "--- "+changing+"\n+++ "+changing+"\n@@ -1 +1 @@\n-port=$PORT\n+port=8080\n", out.String())
+		assert.NoFileExists(t, changing+".bak")
+
+		out.Reset()
+		err = app.Run("v", "c", []string{"--no-config", "--dry-run", static}, &out, strings.NewReader(""), lookupEnv, nil)
+		require.NoError(t, err)
+		assert.Empty(t, out.String())
+
+		err = app.Run("v", "c", []string{"--no-config", "--diff", "-u", changing}, &out, strings.NewReader(""), func(string) (string, bool) { return "", false }, nil)
+		require.Error(t, err)
+		assert.Equal(t, 2, xerr.ExitCode(err))
+	})
+
+	t.Run("Diff needs files", func(t *testing.T) {
+		t.Parallel()
+		err := app.Run("v", "c", []string{"--no-config", "--diff"}, nil, strings.NewReader(""), nil, nil)
+		require.Error(t, err)
+		assert.EqualError(t, err, "--diff and --dry-run need files")
+	})
+
+	t.Run("Atomic all leaves files untouched on error", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		a, b := filepath.Join(dir, "a.conf"), filepath.Join(dir, "b.conf")
+		require.NoError(t, os.WriteFile(a, []byte("$SET"), 0o644))
+		require.NoError(t, os.WriteFile(b, []byte("$UNSET"), 0o644))
+		lookupEnv := func(k string) (string, bool) { return "x", k == "SET" }
+
+		err := app.Run("v", "c", []string{"--no-config", "-i", "--atomic-all", "-u", a, b}, nil, strings.NewReader(""), lookupEnv, nil)
+		require.Error(t, err)
+		got, err := os.ReadFile(a)
+		require.NoError(t, err)
+		assert.Equal(t, "$SET", string(got))
+
+		require.NoError(t, app.Run("v", "c", []string{"--no-config", "-i", "--atomic-all", a}, nil, strings.NewReader(""), lookupEnv, nil))
+		got, err = os.ReadFile(a)
+		require.NoError(t, err)
+		assert.Equal(t, "x", string(got))
+	})
+
+	t.Run("Restore undoes numbered edits", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		p := filepath.Join(dir, "app.conf")
+		require.NoError(t, os.WriteFile(p, []byte("v=$V"), 0o644))
+		edit := func(v string) {
+			lookupEnv := func(string) (string, bool) { return v, true }
+			require.NoError(t, app.Run("v", "c", []string{"--no-config", "-i", "--backup-mode", "numbered", p}, nil, strings.NewReader(""), lookupEnv, nil))
+		}
+		edit("1")
+		require.NoError(t, os.WriteFile(p, []byte("v=$V # changed"), 0o644))
+		edit("2")
+
+		restore := []string{"--no-config", "--restore", "--backup-mode", "numbered", p}
+		require.NoError(t, app.Run("v", "c", restore, nil, strings.NewReader(""), nil, nil))
+		got, err := os.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, "v=$V # changed", string(got))
+
+		require.NoError(t, app.Run("v", "c", restore, nil, strings.NewReader(""), nil, nil))
+		got, err = os.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, "v=$V", string(got))
+
+		err = app.Run("v", "c", restore, nil, strings.NewReader(""), nil, nil)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "no backup found")
+	})
+
+	t.Run("Status reports changed and unchanged files", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		a, b := filepath.Join(dir, "a.conf"), filepath.Join(dir, "b.conf")
+		require.NoError(t, os.WriteFile(a, []byte("v=$V"), 0o644))
+		require.NoError(t, os.WriteFile(b, []byte("static"), 0o644))
+		lookupEnv := func(string) (string, bool) { return "x", true }
+
+		var out bytes.Buffer
+		require.NoError(t, app.Run("v", "c", []string{"--no-config", "-i", "--status", "--backup", ".bak", a, b}, &out, strings.NewReader(""), lookupEnv, nil))
+		assert.Equal(t, a+": changed\n"+b+": unchanged\n", out.String())
+		assert.FileExists(t, a+".bak")
+		assert.NoFileExists(t, b+".bak")
+	})
+
+	t.Run("Restore needs files", func(t *testing.T) {
+		t.Parallel()
+		err := app.Run("v", "c", []string{"--no-config", "--restore"}, nil, strings.NewReader(""), nil, nil)
+		require.Error(t, err)
+		assert.EqualError(t, err, "--restore needs files")
 	})
 
 	t.Run("Extra vars file errors are classified", func(t *testing.T) {
 		t.Parallel()
 
-		err := app.Run("v", "c", []string{"--extra-vars", "/does/not/exist"}, nil, strings.NewReader(""), nil, nil)
+		err := app.Run("v", "c", []string{"--no-config", "--extra-vars", "/does/not/exist"}, nil, strings.NewReader(""), nil, nil)
 		require.Error(t, err)
 		assert.EqualError(t, err, "open /does/not/exist: no such file or directory")
 	})
@@ -0,0 +1,334 @@
+// Package config loads the optional project config file (.vex.yaml), whose
+// keys are named after the long flags they set.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Names lists the file names Find looks for, in order.
+var Names = []string{".vex.yaml", ".vex.yml"}
+
+// Settings holds the flags a config file may set. The yaml key of each
+// field is the long flag name; nil (or absent) leaves the flag alone.
+type Settings struct {
+	Backup         *string `yaml:"backup,omitempty"`
+	BackupMode     *string `yaml:"backup-mode,omitempty"`
+	BackupDir      *string `yaml:"backup-dir,omitempty"`
+	BackupKeep     *int    `yaml:"backup-keep,omitempty"`
+	AtomicAll      *bool   `yaml:"atomic-all,omitempty"`
+	FollowSymlinks *bool   `yaml:"follow-symlinks,omitempty"`
+	NoOps          *bool   `yaml:"no-ops,omitempty"`
+	LiteralDollar  *bool   `yaml:"literal-dollar,omitempty"`
+
+	AutoEscape *bool   `yaml:"auto-escape,omitempty"`
+	Format     *string `yaml:"format,omitempty"`
+
+	Strict     *bool `yaml:"strict,omitempty"`
+	ErrorUnset *bool `yaml:"error-unset,omitempty"`
+	ErrorEmpty *bool `yaml:"error-empty,omitempty"`
+	ReportAll  *bool `yaml:"report-all,omitempty"`
+
+	KeepVars  *bool `yaml:"keep-vars,omitempty"`
+	KeepUnset *bool `yaml:"keep-unset,omitempty"`
+	KeepEmpty *bool `yaml:"keep-empty,omitempty"`
+
+	Prefix               []string `yaml:"prefix,omitempty"`
+	Suffix               []string `yaml:"suffix,omitempty"`
+	Variable             []string `yaml:"variable,omitempty"`
+	Match                []string `yaml:"match,omitempty"`
+	MatchRegex           []string `yaml:"match-regex,omitempty"`
+	VariablesFile        []string `yaml:"variables-file,omitempty"`
+	PrefixesFile         []string `yaml:"prefixes-file,omitempty"`
+	SuffixesFile         []string `yaml:"suffixes-file,omitempty"`
+	VariablesFromVars    *bool    `yaml:"variables-from-vars,omitempty"`
+	ExcludeVariable      []string `yaml:"exclude-variable,omitempty"`
+	ExcludePrefix        []string `yaml:"exclude-prefix,omitempty"`
+	ExcludeVariablesFile []string `yaml:"exclude-variables-file,omitempty"`
+	ExcludePrefixesFile  []string `yaml:"exclude-prefixes-file,omitempty"`
+
+	NoEnv    *bool             `yaml:"no-env,omitempty"`
+	EnvAllow []string          `yaml:"env-allow,omitempty"`
+	Set      map[string]string `yaml:"set,omitempty"`
+
+	ExtraVars       []string `yaml:"extra-vars,omitempty"`
+	VarsSeparator   *string  `yaml:"vars-separator,omitempty"`
+	VarsCase        *string  `yaml:"vars-case,omitempty"`
+	VarsJSON        *bool    `yaml:"vars-json,omitempty"`
+	VarsInterpolate *bool    `yaml:"vars-interpolate,omitempty"`
+	VarsDir         []string `yaml:"vars-dir,omitempty"`
+	VarsDirTrim     *bool    `yaml:"vars-dir-trim,omitempty"`
+	VarsDirSanitize *bool    `yaml:"vars-dir-sanitize,omitempty"`
+
+	FileEnv        *bool    `yaml:"file-env,omitempty"`
+	FileEnvDir     []string `yaml:"file-env-dir,omitempty"`
+	FileEnvMaxSize *int64   `yaml:"file-env-max-size,omitempty"`
+}
+
+// Override changes settings for the files matching one of its globs.
+type Override struct {
+	Files      []string `yaml:"files"`                 // path.Match globs; without '/' they match the base name
+	Format     *string  `yaml:"format,omitempty"`      // implies auto-escape
+	AutoEscape *bool    `yaml:"auto-escape,omitempty"` // escape by file extension
+	Strict     *bool    `yaml:"strict,omitempty"`      // sets error-unset and error-empty too
+	ErrorUnset *bool    `yaml:"error-unset,omitempty"`
+	ErrorEmpty *bool    `yaml:"error-empty,omitempty"`
+}
+
+// Profile is a set of settings with per-file overrides.
+type Profile struct {
+	Settings  `yaml:",inline"`
+	Overrides []Override `yaml:"overrides,omitempty"`
+}
+
+// File is a config file: the base profile plus named profiles, which
+// apply on top of it.
+type File struct {
+	Profile  `yaml:",inline"`
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// Find returns the first config file (see Names) in dir or its parents,
+// or "" when there is none.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range Names {
+			p := filepath.Join(dir, name)
+			if info, err := os.Stat(p); err == nil && !info.IsDir() {
+				return p, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads the config file at p. Unknown keys are errors, and relative
+// paths are taken relative to the file's directory.
+func Load(p string) (*File, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	var f File
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) { // an empty file sets nothing
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	dir := filepath.Dir(p)
+	f.rebase(dir)
+	for name, prof := range f.Profiles {
+		prof.rebase(dir)
+		f.Profiles[name] = prof
+	}
+	return &f, nil
+}
+
+// validate checks the override globs of all profiles.
+func (f *File) validate() error {
+	for _, name := range append([]string{""}, slices.Sorted(maps.Keys(f.Profiles))...) {
+		prof := f.Profile
+		if name != "" {
+			prof = f.Profiles[name]
+		}
+		for i, o := range prof.Overrides {
+			if len(o.Files) == 0 {
+				return fmt.Errorf("overrides[%d]: files is required", i)
+			}
+			for _, g := range o.Files {
+				if _, err := path.Match(g, ""); err != nil {
+					return fmt.Errorf("overrides[%d]: %q: %w", i, g, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rebase makes the relative paths of s relative to dir.
+func (s *Settings) rebase(dir string) {
+	if s.BackupDir != nil && *s.BackupDir != "" && !filepath.IsAbs(*s.BackupDir) {
+		p := filepath.Join(dir, *s.BackupDir)
+		s.BackupDir = &p
+	}
+	for _, list := range [][]string{
+		s.VariablesFile, s.PrefixesFile, s.SuffixesFile,
+		s.ExcludeVariablesFile, s.ExcludePrefixesFile,
+		s.VarsDir, s.FileEnvDir,
+	} {
+		for i, p := range list {
+			if !filepath.IsAbs(p) {
+				list[i] = filepath.Join(dir, p)
+			}
+		}
+	}
+	for i, spec := range s.ExtraVars {
+		prefix, p := "", spec
+		if f, rest, ok := strings.Cut(spec, ":"); ok && len(f) > 1 && strings.Trim(f, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+			prefix, p = f+":", rest // a format prefix such as "yaml:" (see varsfile.Split)
+		}
+		if !filepath.IsAbs(p) {
+			s.ExtraVars[i] = prefix + filepath.Join(dir, p)
+		}
+	}
+}
+
+// Select returns the base profile with the named profile applied on top:
+// its settings replace the base ones (set merges per key) and its
+// overrides follow the base ones. An empty name selects the base profile.
+func (f *File) Select(name string) (Profile, error) {
+	out := f.Profile
+	if name == "" {
+		return out, nil
+	}
+	prof, ok := f.Profiles[name]
+	if !ok {
+		if len(f.Profiles) == 0 {
+			return Profile{}, fmt.Errorf("unknown profile %q (none defined)", name)
+		}
+		return Profile{}, fmt.Errorf("unknown profile %q (want one of %s)", name, strings.Join(slices.Sorted(maps.Keys(f.Profiles)), ", "))
+	}
+	out.Settings = merge(out.Settings, prof.Settings)
+	out.Overrides = append(slices.Clip(out.Overrides), prof.Overrides...)
+	return out, nil
+}
+
+// merge returns base with the fields top sets replaced; maps are merged.
+func merge(base, top Settings) Settings {
+	b, t := reflect.ValueOf(&base).Elem(), reflect.ValueOf(top)
+	for i := range t.NumField() {
+		tf := t.Field(i)
+		if tf.IsNil() {
+			continue
+		}
+		bf := b.Field(i)
+		if tf.Kind() == reflect.Map && !bf.IsNil() {
+			m := reflect.MakeMap(tf.Type())
+			for _, src := range []reflect.Value{bf, tf} {
+				for it := src.MapRange(); it.Next(); {
+					m.SetMapIndex(it.Key(), it.Value())
+				}
+			}
+			tf = m
+		}
+		bf.Set(tf)
+	}
+	return base
+}
+
+// Bools returns the names of the bool flags a config file may set.
+func Bools() []string {
+	var names []string
+	t := reflect.TypeFor[Settings]()
+	for i := range t.NumField() {
+		if f := t.Field(i); f.Type == reflect.TypeFor[*bool]() {
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Args renders s as command line flags, skipping the flags skip reports.
+// A false bool renders nothing, since every bool flag defaults to false.
+func (s Settings) Args(skip func(flag string) bool) []string {
+	var args []string
+	v, t := reflect.ValueOf(s), reflect.TypeOf(s)
+	for i := range t.NumField() {
+		f := v.Field(i)
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if f.IsNil() || skip != nil && skip(name) {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Pointer:
+			switch e := f.Elem(); e.Kind() {
+			case reflect.Bool:
+				if e.Bool() {
+					args = append(args, "--"+name)
+				}
+			case reflect.Int, reflect.Int64:
+				args = append(args, "--"+name+"="+strconv.FormatInt(e.Int(), 10))
+			default:
+				args = append(args, "--"+name+"="+e.String())
+			}
+		case reflect.Slice:
+			for _, item := range f.Interface().([]string) {
+				args = append(args, "--"+name+"="+item)
+			}
+		case reflect.Map:
+			m := f.Interface().(map[string]string)
+			for _, k := range slices.Sorted(maps.Keys(m)) {
+				args = append(args, "--"+name+"="+k+"="+m[k])
+			}
+		}
+	}
+	return args
+}
+
+// Matches reports whether o applies to the file p.
+func (o Override) Matches(p string) bool {
+	return MatchFiles(o.Files, p) // globs are validated by Load
+}
+
+// MatchFiles reports whether the file p matches one of globs (path.Match
+// syntax). A glob without '/' matches the base name, any other glob the
+// whole (slash-separated) path. Invalid globs match nothing.
+func MatchFiles(globs []string, p string) bool {
+	p = filepath.ToSlash(p)
+	for _, g := range globs {
+		target := p
+		if !strings.Contains(g, "/") {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(g, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints prof as a config file, preceded by a comment naming the
+// file and profile it came from (either may be empty).
+func Write(w io.Writer, file, profile string, prof Profile) error {
+	if file != "" {
+		if _, err := fmt.Fprintf(w, "# config: %s\n", file); err != nil {
+			return err
+		}
+	}
+	if profile != "" {
+		if _, err := fmt.Fprintf(w, "# profile: %s\n", profile); err != nil {
+			return err
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(prof); err != nil {
+		return err
+	}
+	return enc.Close()
+}
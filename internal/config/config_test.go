@@ -0,0 +1,316 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write creates a config file with content in dir and returns its path.
+func write(t *testing.T, dir, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, ".vex.yaml")
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+	return p
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+
+	t.Run("walks up to a parent", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		want := write(t, root, "strict: true\n")
+		sub := filepath.Join(root, "a", "b")
+		require.NoError(t, os.MkdirAll(sub, 0o755))
+
+		got, err := Find(sub)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("prefers the nearest and .yaml over .yml", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		write(t, root, "")
+		sub := filepath.Join(root, "sub")
+		require.NoError(t, os.MkdirAll(sub, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(sub, ".vex.yml"), nil, 0o600))
+		want := write(t, sub, "")
+
+		got, err := Find(sub)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("ignores directories", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(root, ".vex.yaml"), 0o755))
+		want := filepath.Join(root, ".vex.yml")
+		require.NoError(t, os.WriteFile(want, nil, 0o600))
+
+		got, err := Find(root)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	t.Run("settings, overrides and profiles", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		f, err := Load(write(t, dir, `
+strict: true
+prefix: [APP_]
+file-env-max-size: 64
+overrides:
+  - files: ["*.json"]
+    format: json
+profiles:
+  prod:
+    strict: false
+`))
+		require.NoError(t, err)
+		require.NotNil(t, f.Strict)
+		assert.True(t, *f.Strict)
+		assert.Equal(t, []string{"APP_"}, f.Prefix)
+		assert.Equal(t, int64(64), *f.FileEnvMaxSize)
+		require.Len(t, f.Overrides, 1)
+		assert.Equal(t, "json", *f.Overrides[0].Format)
+		require.Contains(t, f.Profiles, "prod")
+		assert.False(t, *f.Profiles["prod"].Strict)
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		t.Parallel()
+		f, err := Load(write(t, t.TempDir(), ""))
+		require.NoError(t, err)
+		assert.Empty(t, f.Settings.Args(nil))
+	})
+
+	t.Run("relative paths are taken from the file's directory", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		f, err := Load(write(t, dir, `
+extra-vars: [vars.env, "yaml:conf/values", /abs/x.env]
+vars-dir: [secrets]
+backup-dir: .backups
+profiles:
+  ci:
+    variables-file: [ci/vars.txt]
+`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "vars.env"),
+			"yaml:" + filepath.Join(dir, "conf", "values"),
+			"/abs/x.env",
+		}, f.ExtraVars)
+		assert.Equal(t, []string{filepath.Join(dir, "secrets")}, f.VarsDir)
+		assert.Equal(t, filepath.Join(dir, ".backups"), *f.BackupDir)
+		assert.Equal(t, []string{filepath.Join(dir, "ci", "vars.txt")}, f.Profiles["ci"].VariablesFile)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, t.TempDir(), "stirct: true\n")
+		_, err := Load(p)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, p+": ")
+		assert.ErrorContains(t, err, "field stirct not found")
+	})
+
+	t.Run("override without files", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, t.TempDir(), "overrides:\n  - format: json\n")
+		_, err := Load(p)
+		require.Error(t, err)
+		assert.EqualError(t, err, p+": overrides[0]: files is required")
+	})
+
+	t.Run("invalid override glob", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, t.TempDir(), "profiles:\n  x:\n    overrides:\n      - files: ['[']\n")
+		_, err := Load(p)
+		require.Error(t, err)
+		assert.EqualError(t, err, p+`: overrides[0]: "[": syntax error in pattern`)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+		_, err := Load("/does/not/exist.yaml")
+		require.Error(t, err)
+		assert.EqualError(t, err, "open /does/not/exist.yaml: no such file or directory")
+	})
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+
+	f, err := Load(write(t, t.TempDir(), `
+strict: true
+prefix: [APP_]
+set: {A: "1", B: "1"}
+overrides:
+  - files: ["*.json"]
+    format: json
+profiles:
+  prod:
+    strict: false
+    prefix: [PROD_]
+    set: {B: "2"}
+    overrides:
+      - files: ["*.xml"]
+        format: xml
+  empty: {}
+`))
+	require.NoError(t, err)
+
+	t.Run("base", func(t *testing.T) {
+		t.Parallel()
+		p, err := f.Select("")
+		require.NoError(t, err)
+		assert.True(t, *p.Strict)
+		assert.Equal(t, []string{"APP_"}, p.Prefix)
+		assert.Len(t, p.Overrides, 1)
+	})
+
+	t.Run("profile replaces settings, merges set and appends overrides", func(t *testing.T) {
+		t.Parallel()
+		p, err := f.Select("prod")
+		require.NoError(t, err)
+		assert.False(t, *p.Strict)
+		assert.Equal(t, []string{"PROD_"}, p.Prefix)
+		assert.Equal(t, map[string]string{"A": "1", "B": "2"}, p.Set)
+		require.Len(t, p.Overrides, 2)
+		assert.Equal(t, "xml", *p.Overrides[1].Format)
+
+		base, err := f.Select("")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"A": "1", "B": "1"}, base.Set, "base is untouched")
+		assert.Len(t, base.Overrides, 1)
+	})
+
+	t.Run("empty profile keeps the base", func(t *testing.T) {
+		t.Parallel()
+		p, err := f.Select("empty")
+		require.NoError(t, err)
+		assert.True(t, *p.Strict)
+		assert.Equal(t, []string{"APP_"}, p.Prefix)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		t.Parallel()
+		_, err := f.Select("dev")
+		require.Error(t, err)
+		assert.EqualError(t, err, `unknown profile "dev" (want one of empty, prod)`)
+	})
+
+	t.Run("no profiles", func(t *testing.T) {
+		t.Parallel()
+		_, err := (&File{}).Select("dev")
+		require.Error(t, err)
+		assert.EqualError(t, err, `unknown profile "dev" (none defined)`)
+	})
+}
+
+func TestSettingsArgs(t *testing.T) {
+	t.Parallel()
+
+	yes, no, format, size, keep := true, false, "json", int64(10), 3
+	s := Settings{
+		BackupKeep:     &keep,
+		Strict:         &yes,
+		NoEnv:          &no,
+		Format:         &format,
+		FileEnvMaxSize: &size,
+		Prefix:         []string{"A_", "B_"},
+		Set:            map[string]string{"Y": "2", "X": "a=b"},
+	}
+
+	t.Run("all", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []string{
+			"--backup-keep=3",
+			"--format=json",
+			"--strict",
+			"--prefix=A_",
+			"--prefix=B_",
+			"--set=X=a=b",
+			"--set=Y=2",
+			"--file-env-max-size=10",
+		}, s.Args(nil))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		t.Parallel()
+		args := s.Args(func(name string) bool { return name == "prefix" || name == "set" || name == "backup-keep" })
+		assert.Equal(t, []string{"--format=json", "--strict", "--file-env-max-size=10"}, args)
+	})
+}
+
+func TestBools(t *testing.T) {
+	t.Parallel()
+
+	bools := Bools()
+	assert.Contains(t, bools, "strict")
+	assert.Contains(t, bools, "no-env")
+	assert.NotContains(t, bools, "prefix")
+	assert.NotContains(t, bools, "backup-keep")
+}
+
+func TestOverrideMatches(t *testing.T) {
+	t.Parallel()
+
+	o := Override{Files: []string{"*.json", "deploy/*.yaml"}}
+	for p, want := range map[string]bool{
+		"config.json":          true,
+		"a/b/config.json":      true,
+		"deploy/app.yaml":      true,
+		"other/deploy/x.yaml":  false,
+		"app.yaml":             false,
+		"<stdin>":              false,
+		"config.json.template": false,
+	} {
+		assert.Equal(t, want, o.Matches(p), p)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	t.Run("with file and profile", func(t *testing.T) {
+		t.Parallel()
+		yes, format := true, "json"
+		var buf bytes.Buffer
+		err := Write(&buf, "/repo/.vex.yaml", "prod", Profile{
+			Settings:  Settings{Strict: &yes, Prefix: []string{"APP_"}},
+			Overrides: []Override{{Files: []string{"*.json"}, Format: &format}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `# config: /repo/.vex.yaml
+# profile: prod
+strict: true
+prefix:
+  - APP_
+overrides:
+  - files:
+      - '*.json'
+    format: json
+`, buf.String())
+	})
+
+	t.Run("without config", func(t *testing.T) {
+		t.Parallel()
+		no := false
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, "", "", Profile{Settings: Settings{Strict: &no}}))
+		assert.Equal(t, "strict: false\n", buf.String())
+	})
+}
@@ -0,0 +1,322 @@
+// Package diff renders line-based unified diffs.
+package diff
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Context is the number of unchanged lines shown around each change.
+const Context = 3
+
+const (
+	bold  = "\x1b[1m"
+	red   = "\x1b[91m"
+	green = "\x1b[32m"
+	cyan  = "\x1b[36m"
+	reset = "\x1b[0m"
+)
+
+// op is one line of the edit script: kind is ' ' (both), '-' (only in a)
+// or '+' (only in b); a and b are the line indexes, or for a line missing
+// on one side, the index it would be inserted at.
+type op struct {
+	kind byte
+	a, b int
+}
+
+// Unified returns the unified diff turning a (named oldName) into b (named
+// newName), or nil when they are equal. With colored, lines are wrapped in
+// ANSI colors.
+func Unified(oldName, newName string, a, b []byte, colored bool) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	al, bl := lines(a), lines(b)
+	ops := edits(al, bl)
+
+	var out bytes.Buffer
+	paint := func(color, s string) {
+		if colored {
+			s = color + s + reset
+		}
+		out.WriteString(s)
+		out.WriteByte('\n')
+	}
+	paint(bold, "--- "+oldName)
+	paint(bold, "+++ "+newName)
+
+	for i, prev := 0, 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// extend the hunk while changes are within 2*Context lines of each other
+		last := i
+		for j := i; j < len(ops) && j-last <= 2*Context+1; j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			}
+		}
+		start, stop := max(i-Context, prev), min(last+Context+1, len(ops))
+		hunk := ops[start:stop]
+
+		var na, nb int
+		for _, o := range hunk {
+			if o.kind != '+' {
+				na++
+			}
+			if o.kind != '-' {
+				nb++
+			}
+		}
+		sa, sb := hunk[0].a, hunk[0].b
+		if na > 0 {
+			sa++
+		}
+		if nb > 0 {
+			sb++
+		}
+		paint(cyan, "@@ -"+span(sa, na)+" +"+span(sb, nb)+" @@")
+
+		for _, o := range hunk {
+			line, color := "", ""
+			switch o.kind {
+			case ' ':
+				line = al[o.a]
+			case '-':
+				line, color = al[o.a], red
+			case '+':
+				line, color = bl[o.b], green
+			}
+			text, nl := bytes.CutSuffix([]byte(line), []byte("\n"))
+			s := string(o.kind) + string(text)
+			if color == "" {
+				out.WriteString(s + "\n")
+			} else {
+				paint(color, s)
+			}
+			if !nl {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i, prev = stop, stop
+	}
+	return out.Bytes()
+}
+
+// span formats a hunk range: the start line and, unless it is 1, the
+// number of lines.
+func span(start, n int) string {
+	if n == 1 {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(n)
+}
+
+// lines splits s into lines, keeping their line endings.
+func lines(s []byte) []string {
+	var out []string
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+		out = append(out, string(s[:i]))
+		s = s[i:]
+	}
+	return out
+}
+
+// edits returns a shortest edit script from a to b, using the linear
+// space variant of Myers' algorithm, with the deletions of each change
+// before its insertions. Lines found on one side only are changes in any
+// script; they are left out of the search, so a file that changes
+// entirely costs linear time.
+func edits(a, b []string) []op {
+	ids := map[string]int{}
+	id := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			n, ok := ids[l]
+			if !ok {
+				n = len(ids)
+				ids[l] = n
+			}
+			out[i] = n
+		}
+		return out
+	}
+	ia, ib := id(a), id(b)
+	inA, inB := make([]bool, len(ids)), make([]bool, len(ids))
+	for _, n := range ia {
+		inA[n] = true
+	}
+	for _, n := range ib {
+		inB[n] = true
+	}
+	// keep returns the lines of s found on the other side and their indexes.
+	keep := func(s []int, other []bool) (lines, at []int) {
+		for i, n := range s {
+			if other[n] {
+				lines, at = append(lines, n), append(at, i)
+			}
+		}
+		return lines, at
+	}
+	fa, ka := keep(ia, inB)
+	fb, kb := keep(ib, inA)
+
+	d := &differ{a: fa, b: fb}
+	d.compare(0, len(fa), 0, len(fb))
+
+	// map the script back, adding the lines left out as changes
+	var ops []op
+	x, y := 0, 0
+	del := func(to int) {
+		for ; x < to; x++ {
+			ops = append(ops, op{'-', x, y})
+		}
+	}
+	ins := func(to int) {
+		for ; y < to; y++ {
+			ops = append(ops, op{'+', x, y})
+		}
+	}
+	for _, o := range d.ops {
+		switch o.kind {
+		case ' ':
+			del(ka[o.a])
+			ins(kb[o.b])
+			ops = append(ops, op{' ', x, y})
+			x, y = x+1, y+1
+		case '-':
+			del(ka[o.a] + 1)
+		case '+':
+			ins(kb[o.b] + 1)
+		}
+	}
+	del(len(a))
+	ins(len(b))
+	return group(ops)
+}
+
+// differ collects the edit script of a and b, given as line ids.
+type differ struct {
+	a, b []int
+	ops  []op
+}
+
+// compare appends the edit script of a[a0:a1] and b[b0:b1], splitting
+// it at a middle snake until one side is empty.
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, op{' ', a0, b0})
+		a0, b0 = a0+1, b0+1
+	}
+	end := a1
+	for a1 > a0 && b1 > b0 && d.a[a1-1] == d.b[b1-1] {
+		a1, b1 = a1-1, b1-1
+	}
+
+	switch {
+	case a0 == a1:
+		for y := b0; y < b1; y++ {
+			d.ops = append(d.ops, op{'+', a0, y})
+		}
+	case b0 == b1:
+		for x := a0; x < a1; x++ {
+			d.ops = append(d.ops, op{'-', x, b0})
+		}
+	default:
+		x, y, u, v := d.snake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.ops = append(d.ops, op{' ', x, y})
+		}
+		d.compare(u, a1, v, b1)
+	}
+
+	for x, y := a1, b1; x < end; x, y = x+1, y+1 {
+		d.ops = append(d.ops, op{' ', x, y})
+	}
+}
+
+// snake returns the middle snake (x, y) to (u, v) of a shortest edit
+// script of a[a0:a1] and b[b0:b1], searching forward from the start and
+// backward from the end until the paths meet.
+func (d *differ) snake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	off := maxD + 1
+	fv := make([]int, 2*off+1) // fv[off+k]: furthest x on forward diagonal k
+	bv := make([]int, 2*off+1) // bv[off+k]: furthest x from the end on backward diagonal k
+
+	// next returns the start of the snake on diagonal k of v at step e.
+	next := func(v []int, k, e int) int {
+		if k == -e || k != e && v[off+k-1] < v[off+k+1] {
+			return v[off+k+1]
+		}
+		return v[off+k-1] + 1
+	}
+	for e := 0; e <= maxD; e++ {
+		for k := -e; k <= e; k += 2 {
+			x0 := next(fv, k, e)
+			px, py := x0, x0-k
+			for px < n && py < m && d.a[a0+px] == d.b[b0+py] {
+				px, py = px+1, py+1
+			}
+			fv[off+k] = px
+			if c := delta - k; odd && c >= -(e-1) && c <= e-1 && px+bv[off+c] >= n {
+				return a0 + x0, b0 + x0 - k, a0 + px, b0 + py
+			}
+		}
+		for k := -e; k <= e; k += 2 {
+			x0 := next(bv, k, e)
+			px, py := x0, x0-k
+			for px < n && py < m && d.a[a1-1-px] == d.b[b1-1-py] {
+				px, py = px+1, py+1
+			}
+			bv[off+k] = px
+			if c := delta - k; !odd && c >= -e && c <= e && fv[off+c]+px >= n {
+				return a1 - px, b1 - py, a1 - x0, b1 - x0 + k
+			}
+		}
+	}
+	panic("diff: no middle snake") // unreachable: the paths meet by maxD
+}
+
+// group moves the deletions of each run of changes before its insertions,
+// so changed lines read as a block of old lines followed by the new ones.
+func group(ops []op) []op {
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		// the run deletes a lines from x on and inserts b lines from y on
+		x, y := ops[i].a, ops[i].b
+		var dels, ins int
+		for _, o := range ops[i:j] {
+			if o.kind == '-' {
+				dels++
+			} else {
+				ins++
+			}
+		}
+		for n := range dels {
+			ops[i+n] = op{'-', x + n, y}
+		}
+		for n := range ins {
+			ops[i+dels+n] = op{'+', x + dels, y + n}
+		}
+		i = j
+	}
+	return ops
+}
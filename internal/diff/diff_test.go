@@ -0,0 +1,208 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnified(t *testing.T) {
+	t.Parallel()
+
+	t.Run("equal", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, Unified("a", "b", []byte("x\n"), []byte("x\n"), false))
+	})
+
+	t.Run("change with context", func(t *testing.T) {
+		t.Parallel()
+		a := "1\n2\n3\n4\nport: $PORT\n6\n7\n8\n9\n"
+		b := "1\n2\n3\n4\nport: 8080\n6\n7\n8\n9\n"
+		assert.Equal(t, `--- app.yaml
++++ app.yaml
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-port: $PORT
++port: 8080
+ 6
+ 7
+ 8
+`, string(Unified("app.yaml", "app.yaml", []byte(a), []byte(b), false)))
+	})
+
+	t.Run("distant changes get separate hunks", func(t *testing.T) {
+		t.Parallel()
+		a := "a\n" + strings.Repeat("=\n", 7) + "b\n"
+		b := "A\n" + strings.Repeat("=\n", 7) + "B\n"
+		assert.Equal(t, `--- x
++++ y
+@@ -1,4 +1,4 @@
+-a
++A
+ =
+ =
+ =
+@@ -6,4 +6,4 @@
+ =
+ =
+ =
+-b
++B
+`, string(Unified("x", "y", []byte(a), []byte(b), false)))
+	})
+
+	t.Run("close changes share a hunk", func(t *testing.T) {
+		t.Parallel()
+		a := "a\n" + strings.Repeat("=\n", 6) + "b\n"
+		b := "A\n" + strings.Repeat("=\n", 6) + "B\n"
+		got := string(Unified("x", "y", []byte(a), []byte(b), false))
+		assert.Equal(t, 1, strings.Count(got, "@@ "))
+		assert.Contains(t, got, "@@ -1,8 +1,8 @@\n")
+	})
+
+	t.Run("insert into and delete all", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "--- x\n+++ y\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+			string(Unified("x", "y", nil, []byte("a\nb\n"), false)))
+		assert.Equal(t, "--- x\n+++ y\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+			string(Unified("x", "y", []byte("a\nb\n"), nil, false)))
+	})
+
+	t.Run("pure insertion", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "--- x\n+++ y\n@@ -1,2 +1,3 @@\n a\n+new\n b\n",
+			string(Unified("x", "y", []byte("a\nb\n"), []byte("a\nnew\nb\n"), false)))
+	})
+
+	t.Run("missing final newline", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "--- x\n+++ y\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+			string(Unified("x", "y", []byte("a"), []byte("b"), false)))
+	})
+
+	t.Run("colored", func(t *testing.T) {
+		t.Parallel()
+		got := string(Unified("x", "y", []byte("a\nk\n"), []byte("b\nk\n"), true))
+		assert.Equal(t, "\x1b[1m--- x\x1b[0m\n\x1b[1m+++ y\x1b[0m\n\x1b[36m@@ -1,2 +1,2 @@\x1b[0m\n\x1b[91m-a\x1b[0m\n\x1b[32m+b\x1b[0m\n k\n", got)
+	})
+}
+
+func TestEdits(t *testing.T) {
+	t.Parallel()
+
+	a := []string{"a", "b", "c", "a", "b", "b", "a"}
+	b := []string{"c", "b", "a", "b", "a", "c"}
+	ops := edits(a, b)
+
+	var dels, ins int
+	var gotA, gotB []string
+	for _, o := range ops {
+		switch o.kind {
+		case ' ':
+			gotA, gotB = append(gotA, a[o.a]), append(gotB, b[o.b])
+		case '-':
+			dels++
+			gotA = append(gotA, a[o.a])
+		case '+':
+			ins++
+			gotB = append(gotB, b[o.b])
+		}
+	}
+	assert.Equal(t, a, gotA)
+	assert.Equal(t, b, gotB)
+	assert.Equal(t, 5, dels+ins, "Myers' example has edit distance 5")
+}
+
+func TestEditsShortest(t *testing.T) {
+	t.Parallel()
+
+	// distance is the edit distance of a and b without substitutions.
+	distance := func(a, b []string) int {
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		return len(a) + len(b) - 2*lcs[0][0]
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	gen := func() []string {
+		out := make([]string, rng.IntN(12))
+		for i := range out {
+			out[i] = string(rune('a' + rng.IntN(3)))
+		}
+		return out
+	}
+	for range 500 {
+		a, b := gen(), gen()
+		var changes int
+		gotA, gotB := []string{}, []string{}
+		for _, o := range edits(a, b) {
+			if o.kind != '+' {
+				gotA = append(gotA, a[o.a])
+			}
+			if o.kind != '-' {
+				gotB = append(gotB, b[o.b])
+			}
+			if o.kind != ' ' {
+				changes++
+			}
+		}
+		require.Equal(t, a, gotA, "%q -> %q", a, b)
+		require.Equal(t, b, gotB, "%q -> %q", a, b)
+		require.Equal(t, distance(a, b), changes, "%q -> %q", a, b)
+	}
+}
+
+func TestUnifiedLarge(t *testing.T) {
+	t.Parallel()
+
+	// every line changes: the edit distance is 2n
+	const n = 20000
+	var a, b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+	out := Unified("a", "b", []byte(a.String()), []byte(b.String()), false)
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	require.Len(t, lines, 3+2*n)
+	assert.Equal(t, "@@ -1,20000 +1,20000 @@", lines[2])
+	assert.Equal(t, "-old 0", lines[3])
+	assert.Equal(t, "+new 0", lines[3+n])
+}
+
+func TestEditsReversed(t *testing.T) {
+	t.Parallel()
+
+	// every line is on both sides, so the search runs on all of them
+	const n = 4000
+	a, b := make([]string, n), make([]string, n)
+	for i := range n {
+		a[i], b[n-1-i] = strconv.Itoa(i), strconv.Itoa(i)
+	}
+	var changes int
+	for _, o := range edits(a, b) {
+		if o.kind != ' ' {
+			changes++
+		}
+	}
+	assert.Equal(t, 2*(n-1), changes)
+}
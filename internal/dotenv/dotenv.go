@@ -0,0 +1,345 @@
+// Package dotenv parses .env files in the docker-compose dialect:
+//
+//	# comment
+//	export KEY=value           # inline comment after whitespace
+//	QUOTED="a b # c\n${OTHER}" # escapes and interpolation
+//	LITERAL='no $expansion'    # taken verbatim
+//	MULTI="first
+//	second"                    # quoted values may span lines
+//	FROM_ENV                   # no '=': copied from the environment if set
+//
+// With a lookup, references ($VAR, ${VAR}, ${VAR:-default}, ...) in
+// unquoted and double-quoted values are expanded by the vex engine, in
+// file order: earlier keys of the same file win over the lookup passed to
+// Parse. $$ is a literal '$'.
+package dotenv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/fsm"
+	"github.com/gi8lino/vex/internal/xerr"
+)
+
+// Parse reads a dotenv file. label names the input in errors, which are
+// positioned as "label:line:col: ...". lookup resolves references to
+// variables not defined (yet) in the file; a nil lookup disables
+// interpolation and keeps values verbatim.
+func Parse(label string, r io.Reader, lookup func(string) (string, bool)) (map[string]string, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src = bytes.TrimPrefix(src, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+
+	p := &parser{label: label, src: src, line: 1, col: 1, vars: make(map[string]string), lookup: lookup}
+	if lookup != nil {
+		p.eng = &fsm.Engine{
+			Label:  label,
+			Lookup: p.resolve,
+			Setenv: func(k, v string) error { p.vars[k] = v; return nil }, // ${X:=v} defines X
+			Format: formatter.NewFormatter(false),
+		}
+	}
+	for p.i < len(p.src) {
+		if err := p.entry(); err != nil {
+			return nil, err
+		}
+	}
+	return p.vars, nil
+}
+
+// parser walks src, keeping the position of the next byte.
+type parser struct {
+	label     string
+	src       []byte
+	i         int
+	line, col int
+	vars      map[string]string
+	lookup    func(string) (string, bool)
+	eng       *fsm.Engine
+}
+
+// resolve looks up name in the vars parsed so far, then in lookup.
+func (p *parser) resolve(name string) (string, bool) {
+	if v, ok := p.vars[name]; ok {
+		return v, true
+	}
+	return p.lookup(name)
+}
+
+// pos is a position in src.
+type pos struct{ line, col int }
+
+func (p *parser) here() pos { return pos{p.line, p.col} }
+
+// syntax returns a positioned syntax error.
+func (p *parser) syntax(at pos, msg string) error {
+	return xerr.At(p.label, at.line, at.col, "", xerr.Syntax(msg))
+}
+
+// peek returns the next byte, or 0 at EOF.
+func (p *parser) peek() byte {
+	if p.i < len(p.src) {
+		return p.src[p.i]
+	}
+	return 0
+}
+
+// next consumes one byte.
+func (p *parser) next() byte {
+	c := p.src[p.i]
+	p.i++
+	if c == '\n' {
+		p.line, p.col = p.line+1, 1
+	} else {
+		p.col++
+	}
+	return c
+}
+
+// blanks skips spaces and tabs.
+func (p *parser) blanks() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.next()
+	}
+}
+
+// rest skips the remainder of the line, which may only hold a comment.
+func (p *parser) rest() error {
+	p.blanks()
+	switch p.peek() {
+	case 0, '\n':
+	case '#':
+		for p.i < len(p.src) && p.peek() != '\n' {
+			p.next()
+		}
+	default:
+		return p.syntax(p.here(), "unexpected text after value")
+	}
+	if p.peek() == '\n' {
+		p.next()
+	}
+	return nil
+}
+
+// entry parses one line: blank, comment or assignment.
+func (p *parser) entry() error {
+	p.blanks()
+	switch p.peek() {
+	case '\n', '#', 0:
+		return p.rest()
+	}
+
+	at := p.here()
+	key := p.key()
+	if key == "export" && (p.peek() == ' ' || p.peek() == '\t') {
+		p.blanks()
+		at = p.here()
+		key = p.key()
+	}
+	if key == "" {
+		return p.syntax(at, "expected variable name")
+	}
+	p.blanks()
+	if c := p.peek(); c == 0 || c == '\n' || c == '#' {
+		// KEY alone: take it from the environment
+		if p.lookup != nil {
+			if v, ok := p.lookup(key); ok {
+				p.vars[key] = v
+			}
+		}
+		return p.rest()
+	}
+	if p.peek() != '=' {
+		return p.syntax(p.here(), "expected '=' after "+key)
+	}
+	p.next()
+	p.blanks()
+
+	val, err := p.value()
+	if err != nil {
+		return err
+	}
+	p.vars[key] = val
+	return p.rest()
+}
+
+// key reads a variable name ([A-Za-z0-9_.-]+).
+func (p *parser) key() string {
+	start := p.i
+	for p.i < len(p.src) {
+		c := p.src[p.i]
+		if !(c == '_' || c == '.' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			break
+		}
+		p.next()
+	}
+	return string(p.src[start:p.i])
+}
+
+// value reads a quoted or unquoted value and resolves it.
+func (p *parser) value() (string, error) {
+	at := p.here()
+	switch q := p.peek(); q {
+	case '\'', '"':
+		p.next()
+		start := p.i
+		for p.i < len(p.src) && p.src[p.i] != q {
+			if q == '"' && p.src[p.i] == '\\' && p.i+1 < len(p.src) {
+				p.next()
+			}
+			p.next()
+		}
+		if p.i >= len(p.src) {
+			what := "double"
+			if q == '\'' {
+				what = "single"
+			}
+			return "", p.syntax(at, "unterminated "+what+"-quoted value")
+		}
+		raw := string(p.src[start:p.i])
+		p.next()
+		if q == '\'' {
+			return raw, nil
+		}
+		return p.expand(raw, true, pos{at.line, at.col + 1})
+
+	default:
+		start := p.i
+		end := p.i // end of the value without trailing blanks
+		for p.i < len(p.src) && p.src[p.i] != '\n' {
+			c := p.src[p.i]
+			if c == '#' && (p.i == start || p.src[p.i-1] == ' ' || p.src[p.i-1] == '\t') {
+				break
+			}
+			p.next()
+			if c != ' ' && c != '\t' {
+				end = p.i
+			}
+		}
+		return p.expand(string(p.src[start:end]), false, at)
+	}
+}
+
+// expand resolves escapes (double-quoted values only) and references in
+// raw, which starts at at. \$ always yields a literal '$'.
+func (p *parser) expand(raw string, escapes bool, at pos) (string, error) {
+	var b strings.Builder
+	line, col := at.line, at.col
+	advance := func(s string) {
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+		}
+	}
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw) && (escapes || raw[i+1] == '$'):
+			b.WriteString(unescape(raw[i+1]))
+			advance(raw[i : i+2])
+			i += 2
+		case c == '$' && p.eng != nil && strings.HasPrefix(raw[i+1:], "$"):
+			b.WriteByte(c) // $$ is a literal '$', as in docker-compose
+			advance(raw[i : i+2])
+			i += 2
+		case c == '$' && p.eng != nil:
+			ref, ok := reference(raw[i:])
+			if !ok {
+				return "", p.syntax(pos{line, col}, "unterminated ${ in value")
+			}
+			if ref == "" { // lone '$'
+				b.WriteByte(c)
+				advance(raw[i : i+1])
+				i++
+				continue
+			}
+			val, err := p.interpolate(ref, pos{line, col})
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(val)
+			advance(ref)
+			i += len(ref)
+		default:
+			b.WriteByte(c)
+			advance(raw[i : i+1])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// unescape maps the byte after a backslash in a double-quoted value.
+func unescape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case '\\', '"', '\'', '$':
+		return string(c)
+	}
+	return "\\" + string(c)
+}
+
+// reference returns the $NAME or ${...} at the start of s ("" when the '$'
+// is literal); ok is false for a ${ without its closing brace.
+func reference(s string) (ref string, ok bool) {
+	if len(s) < 2 {
+		return "", true
+	}
+	if s[1] == '{' {
+		depth := 0
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					return s[:i+1], true
+				}
+			}
+		}
+		return "", false
+	}
+	i := 1
+	for i < len(s) && (s[i] == '_' || s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z' || i > 1 && s[i] >= '0' && s[i] <= '9') {
+		i++
+	}
+	if i == 1 {
+		return "", true
+	}
+	return s[:i], true
+}
+
+// interpolate expands one reference with the engine. Errors are positioned
+// at the reference in the file.
+func (p *parser) interpolate(ref string, at pos) (string, error) {
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	if err := p.eng.Consume(strings.NewReader(ref), w); err != nil {
+		var pe *xerr.PosError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return "", &xerr.PosError{Label: p.label, Line: at.line, Col: at.col, Ref: ref, Err: err}
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
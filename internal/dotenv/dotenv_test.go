@@ -0,0 +1,103 @@
+package dotenv
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/xerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("boom") }
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"HOME": "/home/app", "USER": "app"}
+	lookup := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+
+	t.Run("values", func(t *testing.T) {
+		t.Parallel()
+		for name, tc := range map[string]struct {
+			in   string
+			want map[string]string
+		}{
+			"empty input":             {"", map[string]string{}},
+			"comments and blanks":     {"\n# c\nFOO=bar\n  \n\t# c\nBAZ = qux  \n", map[string]string{"FOO": "bar", "BAZ": "qux"}},
+			"equals in value":         {"KEY=a=b=c", map[string]string{"KEY": "a=b=c"}},
+			"export prefix":           {"export FOO=bar\nexport\tBAR=baz", map[string]string{"FOO": "bar", "BAR": "baz"}},
+			"export as key":           {"export=1", map[string]string{"export": "1"}},
+			"inline comment":          {"A=b # c\nB=b#c\nC=#c", map[string]string{"A": "b", "B": "b#c", "C": ""}},
+			"empty value":             {"A=\nB=''\nC=\"\"", map[string]string{"A": "", "B": "", "C": ""}},
+			"double-quoted comment":   {`FOO="a b # c"`, map[string]string{"FOO": "a b # c"}},
+			"double-quoted escapes":   {`A="l1\nl2\t\"q\" \\ \$HOME \x"`, map[string]string{"A": "l1\nl2\t\"q\" \\ $HOME \\x"}},
+			"single-quoted verbatim":  {`A='$HOME \n "x" # y' # c`, map[string]string{"A": `$HOME \n "x" # y`}},
+			"multi-line double":       {"A=\"first\nsecond\"\nB=1", map[string]string{"A": "first\nsecond", "B": "1"}},
+			"multi-line single":       {"A='first\n$HOME'", map[string]string{"A": "first\n$HOME"}},
+			"dotted and dashed keys":  {"a.b-c=1", map[string]string{"a.b-c": "1"}},
+			"crlf line endings":       {"A=1\r\nB=\"x\r\ny\"\r\n", map[string]string{"A": "1", "B": "x\ny"}},
+			"byte order mark":         {"\xef\xbb\xbfA=1", map[string]string{"A": "1"}},
+			"later keys win":          {"A=1\nA=2", map[string]string{"A": "2"}},
+			"key from environment":    {"HOME\nMISSING # c", map[string]string{"HOME": "/home/app"}},
+			"interpolation":           {"A=$USER\nB=\"${HOME}/x\"\nC=${A}-${B}", map[string]string{"A": "app", "B": "/home/app/x", "C": "app-/home/app/x"}},
+			"operators":               {"A=${NOPE:-def}\nB=${USER^^}\nC=\"${HOME##*/}\"", map[string]string{"A": "def", "B": "APP", "C": "app"}},
+			"nested braces":           {"A=${NOPE:-${USER}}", map[string]string{"A": "app"}},
+			"file keys shadow lookup": {"USER=root\nA=$USER", map[string]string{"USER": "root", "A": "root"}},
+			"assignment defines":      {"A=${B:=x}", map[string]string{"A": "x", "B": "x"}},
+			"escaped dollar unquoted": {`A=\$USER`, map[string]string{"A": "$USER"}},
+			"lone dollar":             {"A=5$ and $1", map[string]string{"A": "5$ and $1"}},
+			"unset is empty":          {"A=[$NOPE]", map[string]string{"A": "[]"}},
+			"double dollar":           {"A=p$$q\nB=\"$$USER\"\nC='$$'", map[string]string{"A": "p$q", "B": "$USER", "C": "$$"}},
+		} {
+			got, err := Parse("vars.env", strings.NewReader(tc.in), lookup)
+			require.NoError(t, err, name)
+			assert.Equal(t, tc.want, got, name)
+		}
+	})
+
+	t.Run("nil lookup keeps values verbatim", func(t *testing.T) {
+		t.Parallel()
+		got, err := Parse("vars.env", strings.NewReader("A=$USER\nB=\"${X}\\n\"\nC=p$$q\nHOME"), nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"A": "$USER", "B": "${X}\n", "C": "p$$q"}, got)
+	})
+
+	t.Run("errors are positioned", func(t *testing.T) {
+		t.Parallel()
+		for in, want := range map[string]string{
+			"A=1\nNOT VALID":                 "vars.env:2:5: syntax error: expected '=' after NOT",
+			"=1":                             "vars.env:1:1: syntax error: expected variable name",
+			"A=1\nB=\"open\n\nmore":          "vars.env:2:3: syntax error: unterminated double-quoted value",
+			"A='open":                        "vars.env:1:3: syntax error: unterminated single-quoted value",
+			"A=\"x\" y":                      "vars.env:1:7: syntax error: unexpected text after value",
+			"A=x ${B":                        "vars.env:1:5: syntax error: unterminated ${ in value",
+			"A=1\nB=\"a\n  ${X:?required}\"": "vars.env:3:3: X: required",
+		} {
+			_, err := Parse("vars.env", strings.NewReader(in), lookup)
+			require.Error(t, err, in)
+			assert.EqualError(t, err, want, in)
+		}
+	})
+
+	t.Run("errors are classified", func(t *testing.T) {
+		t.Parallel()
+		_, err := Parse("vars.env", strings.NewReader("A B"), lookup)
+		assert.True(t, xerr.IsSyntax(err))
+
+		_, err = Parse("vars.env", strings.NewReader("A=${X:?required}"), lookup)
+		assert.ErrorIs(t, err, xerr.ErrUser)
+		var pe *xerr.PosError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, "${X:?required}", pe.Ref)
+	})
+
+	t.Run("read error is returned", func(t *testing.T) {
+		t.Parallel()
+		_, err := Parse("vars.env", errReader{}, lookup)
+		assert.EqualError(t, err, "boom")
+	})
+}
@@ -0,0 +1,114 @@
+package env
+
+import (
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Source is one layer of variables.
+type Source interface {
+	Lookup(name string) (string, bool)
+	Names() []string // the names Lookup resolves
+}
+
+// Chain resolves variables from its sources in order: the first source
+// that has a variable wins. vex builds it as
+//
+//	assigned (${VAR:=word}) > --set > --vars-dir/--extra-vars > host environment
+type Chain []Source
+
+// Lookup returns the value of name from the first source that has it.
+func (c Chain) Lookup(name string) (string, bool) {
+	for _, s := range c {
+		if v, ok := s.Lookup(name); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Names returns the sorted, de-duplicated names of all sources.
+func (c Chain) Names() []string {
+	var names []string
+	for _, s := range c {
+		names = append(names, s.Names()...)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// Map is a Source backed by a map.
+type Map map[string]string
+
+// Lookup returns m[name].
+func (m Map) Lookup(name string) (string, bool) {
+	v, ok := m[name]
+	return v, ok
+}
+
+// Names returns the keys of m.
+func (m Map) Names() []string {
+	return slices.Collect(maps.Keys(m))
+}
+
+// Set stores name=val; it has the signature of os.Setenv.
+func (m Map) Set(name, val string) error {
+	m[name] = val
+	return nil
+}
+
+// Host is the process environment. With Allow set, only names matching
+// one of its glob patterns (path.Match syntax, e.g. APP_*) are visible;
+// Disabled alone hides every name.
+type Host struct {
+	Get      func(string) (string, bool) // e.g. os.LookupEnv
+	Environ  func() []string             // "KEY=VALUE" entries, e.g. os.Environ
+	Allow    []string                    // --env-allow: glob patterns of visible names
+	Disabled bool                        // --no-env: hide names Allow does not match
+}
+
+// Lookup returns the value of name if it is visible.
+func (h Host) Lookup(name string) (string, bool) {
+	if h.Get == nil || !h.visible(name) {
+		return "", false
+	}
+	return h.Get(name)
+}
+
+// Names returns the visible names of Environ that Get resolves.
+func (h Host) Names() []string {
+	if h.Environ == nil {
+		return nil
+	}
+	var names []string
+	for _, kv := range h.Environ() {
+		if k, _, ok := strings.Cut(kv, "="); ok && k != "" {
+			if _, ok := h.Lookup(k); ok {
+				names = append(names, k)
+			}
+		}
+	}
+	return names
+}
+
+// visible reports whether name passes Allow and Disabled.
+func (h Host) visible(name string) bool {
+	for _, p := range h.Allow {
+		if ok, _ := path.Match(p, name); ok { // patterns are validated by flag parsing
+			return true
+		}
+	}
+	return !h.Disabled && len(h.Allow) == 0
+}
+
+// ParseSet parses KEY=VALUE assignments (--set) into a Map; later ones win.
+func ParseSet(assigns []string) Map {
+	m := make(Map, len(assigns))
+	for _, a := range assigns {
+		k, v, _ := strings.Cut(a, "=") // validated by flag parsing
+		m[k] = v
+	}
+	return m
+}
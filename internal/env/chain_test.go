@@ -0,0 +1,105 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	t.Run("first source wins", func(t *testing.T) {
+		t.Parallel()
+		c := Chain{Map{"A": "set"}, Map{"A": "file", "B": "file"}, Map{"A": "env", "B": "env", "C": "env", "E": ""}}
+		for name, want := range map[string]string{"A": "set", "B": "file", "C": "env", "E": ""} {
+			v, ok := c.Lookup(name)
+			assert.True(t, ok, name)
+			assert.Equal(t, want, v, name)
+		}
+		_, ok := c.Lookup("MISSING")
+		assert.False(t, ok)
+	})
+
+	t.Run("names are merged, sorted and de-duplicated", func(t *testing.T) {
+		t.Parallel()
+		c := Chain{Map{"C": "", "A": ""}, Map{"B": "", "A": ""}}
+		assert.Equal(t, []string{"A", "B", "C"}, c.Names())
+		assert.Empty(t, Chain{}.Names())
+	})
+
+	t.Run("chains nest", func(t *testing.T) {
+		t.Parallel()
+		c := Chain{Chain{Map{"A": "1"}}, Map{"B": "2"}}
+		v, ok := c.Lookup("A")
+		assert.True(t, ok)
+		assert.Equal(t, "1", v)
+		assert.Equal(t, []string{"A", "B"}, c.Names())
+	})
+}
+
+func TestMap(t *testing.T) {
+	t.Parallel()
+
+	m := Map{}
+	require.NoError(t, m.Set("A", "1"))
+	v, ok := m.Lookup("A")
+	assert.True(t, ok)
+	assert.Equal(t, "1", v)
+	assert.Equal(t, []string{"A"}, m.Names())
+}
+
+func TestHost(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]string{"HOME": "/root", "APP_URL": "u", "APP_PORT": "1", "PATH": "/bin"}
+	get := func(k string) (string, bool) { v, ok := vars[k]; return v, ok }
+	environ := func() []string {
+		return []string{"HOME=/root", "APP_URL=u", "APP_PORT=1", "PATH=/bin", "=bogus", "NOEQ", "STALE=x"}
+	}
+
+	t.Run("everything by default", func(t *testing.T) {
+		t.Parallel()
+		h := Host{Get: get, Environ: environ}
+		v, ok := h.Lookup("HOME")
+		assert.True(t, ok)
+		assert.Equal(t, "/root", v)
+		assert.Equal(t, []string{"HOME", "APP_URL", "APP_PORT", "PATH"}, h.Names()) // STALE is not resolved by Get
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		h := Host{Get: get, Environ: environ, Disabled: true}
+		_, ok := h.Lookup("HOME")
+		assert.False(t, ok)
+		assert.Empty(t, h.Names())
+	})
+
+	t.Run("allow patterns", func(t *testing.T) {
+		t.Parallel()
+		for _, disabled := range []bool{false, true} {
+			h := Host{Get: get, Environ: environ, Allow: []string{"APP_*", "PATH"}, Disabled: disabled}
+			_, ok := h.Lookup("HOME")
+			assert.False(t, ok)
+			v, ok := h.Lookup("APP_URL")
+			assert.True(t, ok)
+			assert.Equal(t, "u", v)
+			assert.Equal(t, []string{"APP_URL", "APP_PORT", "PATH"}, h.Names())
+		}
+	})
+
+	t.Run("nil funcs", func(t *testing.T) {
+		t.Parallel()
+		_, ok := Host{}.Lookup("HOME")
+		assert.False(t, ok)
+		assert.Empty(t, Host{}.Names())
+	})
+}
+
+func TestParseSet(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, Map{"A": "x=y", "B": "", "C": "2"}, ParseSet([]string{"A=x=y", "B=", "C=1", "C=2"}))
+	assert.Empty(t, ParseSet(nil))
+}
@@ -0,0 +1,132 @@
+// Package env provides the variable lookup layers vex resolves references
+// against.
+package env
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/xerr"
+)
+
+// FileSuffix marks a variable holding the path of the file with another
+// variable's value (DB_PASSWORD_FILE=/run/secrets/db for DB_PASSWORD).
+const FileSuffix = "_FILE"
+
+// DefaultMaxFileSize caps VAR_FILE contents when Files.MaxSize is zero.
+const DefaultMaxFileSize = 1 << 20
+
+// Files resolves VAR from the file named by VAR_FILE when Next leaves VAR
+// unset, the convention many container images use for secrets. One
+// trailing newline is trimmed from the contents.
+type Files struct {
+	Next    Source   // underlying variables
+	Dirs    []string // directories files may live in; empty allows any
+	MaxSize int64    // largest file read; DefaultMaxFileSize when zero
+}
+
+// Resolve looks up name, reading VAR_FILE as described on Files. Failing
+// to read the file is an xerr.ErrLookup error.
+func (f *Files) Resolve(name string) (string, bool, error) {
+	if v, ok := f.Next.Lookup(name); ok {
+		return v, true, nil
+	}
+	path, ok := f.Next.Lookup(name + FileSuffix)
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	v, err := f.read(path)
+	if err != nil {
+		return "", false, xerr.Lookup(name + FileSuffix + ": " + err.Error())
+	}
+	return v, true, nil
+}
+
+// Lookup is Resolve for callers that cannot handle errors: an unreadable
+// file leaves the variable unset.
+func (f *Files) Lookup(name string) (string, bool) {
+	v, ok, err := f.Resolve(name)
+	return v, ok && err == nil
+}
+
+// read returns the contents of path after checking Dirs and MaxSize.
+func (f *Files) read(path string) (string, error) {
+	if len(f.Dirs) > 0 {
+		if err := f.allowed(path); err != nil {
+			return "", err
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	limit := f.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxFileSize
+	}
+	b, err := io.ReadAll(io.LimitReader(file, limit+1)) // the file may grow after Stat
+	if err != nil {
+		return "", err
+	}
+	if int64(len(b)) > limit {
+		return "", fmt.Errorf("%s is larger than %d bytes", path, limit)
+	}
+	v := string(b)
+	if t, ok := strings.CutSuffix(v, "\n"); ok {
+		v = strings.TrimSuffix(t, "\r")
+	}
+	return v, nil
+}
+
+// allowed reports an error unless path, with symlinks resolved, lies in
+// one of Dirs.
+func (f *Files) allowed(path string) error {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return err
+	}
+	for _, dir := range f.Dirs {
+		d, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue // a missing directory allows nothing
+		}
+		if d, err = filepath.Abs(d); err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(d, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is outside the allowed directories (%s)", path, strings.Join(f.Dirs, ", "))
+}
+
+// Names returns the names of Next plus VAR for every readable VAR_FILE.
+func (f *Files) Names() []string {
+	names := f.Next.Names()
+	for _, n := range names {
+		if v, ok := strings.CutSuffix(n, FileSuffix); ok && v != "" {
+			if _, ok := f.Lookup(v); ok {
+				names = append(names, v)
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
@@ -0,0 +1,134 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/xerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+	vars := map[string]string{
+		"PLAIN":      "p",
+		"PLAIN_FILE": write("plain", "ignored"),
+		"PW_FILE":    write("pw", "s3cret\n"),
+		"CRLF_FILE":  write("crlf", "a\r\n\n"),
+		"EMPTY_FILE": "",
+		"DIR_FILE":   dir,
+		"GONE_FILE":  filepath.Join(dir, "gone"),
+		"BIG_FILE":   write("big", strings.Repeat("x", 11)),
+	}
+	files := &Files{Next: Map(vars), MaxSize: 10}
+
+	t.Run("resolves", func(t *testing.T) {
+		t.Parallel()
+		for name, want := range map[string]string{
+			"PLAIN": "p",      // set variables win
+			"PW":    "s3cret", // one trailing newline trimmed
+			"CRLF":  "a\r\n",  // only one
+		} {
+			v, ok, err := files.Resolve(name)
+			require.NoError(t, err, name)
+			assert.True(t, ok, name)
+			assert.Equal(t, want, v, name)
+		}
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		t.Parallel()
+		for _, name := range []string{"NOPE", "EMPTY"} {
+			_, ok, err := files.Resolve(name)
+			require.NoError(t, err, name)
+			assert.False(t, ok, name)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		for name, want := range map[string]string{
+			"DIR":  "lookup failed: DIR_FILE: " + dir + " is not a regular file",
+			"GONE": "lookup failed: GONE_FILE: open " + vars["GONE_FILE"] + ": no such file or directory",
+			"BIG":  "lookup failed: BIG_FILE: " + vars["BIG_FILE"] + " is larger than 10 bytes",
+		} {
+			_, ok, err := files.Resolve(name)
+			assert.False(t, ok, name)
+			assert.ErrorIs(t, err, xerr.ErrLookup, name)
+			assert.EqualError(t, err, want, name)
+
+			_, ok = files.Lookup(name)
+			assert.False(t, ok, name)
+		}
+	})
+
+	t.Run("default size limit", func(t *testing.T) {
+		t.Parallel()
+		f := &Files{Next: Map(vars)}
+		v, ok, err := f.Resolve("BIG")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Len(t, v, 11)
+	})
+
+	t.Run("allowed directories", func(t *testing.T) {
+		t.Parallel()
+		other := t.TempDir()
+		outside := filepath.Join(other, "pw")
+		require.NoError(t, os.WriteFile(outside, []byte("x"), 0o600))
+		rel, err := filepath.Rel(dir, outside)
+		require.NoError(t, err)
+		env := Map{"IN_FILE": vars["PW_FILE"], "OUT_FILE": outside, "DOTS_FILE": dir + string(filepath.Separator) + rel}
+		f := &Files{Next: env, Dirs: []string{dir}}
+
+		v, ok, err := f.Resolve("IN")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "s3cret", v)
+
+		for _, name := range []string{"OUT", "DOTS"} {
+			_, _, err = f.Resolve(name)
+			require.Error(t, err, name)
+			assert.Contains(t, err.Error(), "is outside the allowed directories ("+dir+")", name)
+		}
+	})
+
+	t.Run("symlinks cannot escape allowed directories", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks need privileges on Windows")
+		}
+		allowed, other := t.TempDir(), t.TempDir()
+		target := filepath.Join(other, "pw")
+		require.NoError(t, os.WriteFile(target, []byte("x"), 0o600))
+		link := filepath.Join(allowed, "pw")
+		require.NoError(t, os.Symlink(target, link))
+
+		f := &Files{Next: Map{"PW_FILE": link}, Dirs: []string{allowed}}
+		_, _, err := f.Resolve("PW")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is outside the allowed directories")
+	})
+}
+
+func TestFilesNames(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	pw := filepath.Join(dir, "pw")
+	require.NoError(t, os.WriteFile(pw, []byte("x"), 0o600))
+
+	f := &Files{Next: Map{"DB_PASSWORD_FILE": pw, "HOME": "/", "_FILE": pw, "GONE_FILE": filepath.Join(dir, "gone"), "SET": "1", "SET_FILE": pw}}
+	assert.Equal(t, []string{"DB_PASSWORD", "DB_PASSWORD_FILE", "GONE_FILE", "HOME", "SET", "SET_FILE", "_FILE"}, f.Names())
+}
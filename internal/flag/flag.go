@@ -1,25 +1,46 @@
 package flag
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/gi8lino/vex/internal/config"
+
 	tinyflags "github.com/containeroo/tinyflags"
 )
 
 // Options holds all parsed CLI flags.
 type Options struct {
 	// I/O mode
-	InPlace   bool   // -i, --in-place
-	BackupExt string // --backup
+	InPlace        bool   // -i, --in-place
+	BackupExt      string // --backup
+	BackupMode     string // --backup-mode: simple|numbered|existing|timestamp
+	BackupDir      string // --backup-dir: keep backups here instead of next to the file
+	BackupKeep     int    // --backup-keep: numbered or timestamped backups kept per file (0: all)
+	Restore        bool   // --restore: put the most recent backup of each file back
+	AtomicAll      bool   // --atomic-all: replace the files only when all of them rendered
+	Status         bool   // --status: print whether -i changed each file
+	FollowSymlinks bool   // --follow-symlinks: -i edits the targets of symlinks instead of refusing them
 
 	// Parsing/behavior
 	NoOps    bool // --no-ops
 	NoEscape bool // --literal-dollar
 
+	// Escaping
+	AutoEscape   bool   // --auto-escape (or via --format)
+	EscapeFormat string // --format: yaml|json|xml|shell|toml|env; empty picks by file extension
+
 	// Failure policy
 	ErrorEmpty bool // --error-empty (or via --strict)
 	ErrorUnset bool // --error-unset (or via --strict)
-	Strict     bool // (reserved for future)
+	Strict     bool // --strict (also fails on unterminated ${...})
+	ReportAll  bool // --report-all
 
 	// Replacement policy
 	KeepUnset bool // --keep-unset
@@ -27,22 +48,195 @@ type Options struct {
 	KeepVars  bool // --keep-vars  (implies both)
 
 	// Filter lists
-	Prefix    []string // -p, --prefix
-	Suffix    []string // -s, --suffix
-	Variables []string // -v, --variable
+	Prefix     []string // -p, --prefix
+	Suffix     []string // -s, --suffix
+	Variables  []string // -v, --variable
+	Match      []string // --match: glob patterns
+	MatchRegex []string // --match-regex: regular expressions
+
+	// Deny lists (win over allow lists)
+	ExcludeVariables []string // --exclude-variable
+	ExcludePrefix    []string // --exclude-prefix
+
+	// Filter list files, appended to the lists above by the caller
+	VariablesFiles        []string // --variables-file
+	PrefixFiles           []string // --prefixes-file
+	SuffixFiles           []string // --suffixes-file
+	ExcludeVariablesFiles []string // --exclude-variables-file
+	ExcludePrefixFiles    []string // --exclude-prefixes-file
+	VariablesFromVars     bool     // --variables-from-vars: allow the names vars files and dirs define
+	Restricted            bool     // an allow-list source was given: empty allow-lists match nothing
 
 	// Coloring (content + diagnostics). Incompatible with --in-place.
 	Colored bool // --colored
 
+	// Analysis
+	ListVars bool // --list-vars
+	Check    bool // --check
+	JSON     bool // --json
+
+	// Environment
+	NoEnv    bool     // --no-env: hide the host environment
+	EnvAllow []string // --env-allow: glob patterns of host variables to pass through
+	Set      []string // --set KEY=VALUE [--set KEY=VALUE...]
+
 	// Vars injection (files only, multiple allowed)
 	VarsFiles []string // --vars FILE [--vars FILE...]
 
+	// Structured vars files (JSON/YAML/TOML)
+	VarsSeparator string // --vars-separator: joins nested keys
+	VarsCase      string // --vars-case: upper|lower|keep
+	VarsJSON      bool   // --vars-json: also expose maps and lists as JSON
+
+	VarsInterpolate bool // --vars-interpolate: expand references in dotenv vars files
+
+	// Vars directories (one file per variable, e.g. Kubernetes secret mounts)
+	VarsDirs        []string // --vars-dir DIR [--vars-dir DIR...]
+	VarsDirTrim     bool     // --vars-dir-trim: trim one trailing newline
+	VarsDirSanitize bool     // --vars-dir-sanitize: map file names to valid names
+
+	// VAR_FILE secrets
+	FileEnv        bool     // --file-env: resolve unset VAR from the file named by VAR_FILE
+	FileEnvDirs    []string // --file-env-dir: directories VAR_FILE may point into (implies --file-env)
+	FileEnvMaxSize int64    // --file-env-max-size: largest VAR_FILE read, in bytes
+
+	// Preview of in-place edits
+	Diff   bool // --diff: print a unified diff of what -i would change, write nothing
+	DryRun bool // --dry-run: print the names of files -i would change, write nothing
+
+	// Directory rendering
+	OutputDir   string   // --output-dir: render the source directory into this directory
+	Include     []string // --include: globs of files to render; others are copied verbatim
+	Exclude     []string // --exclude: globs of files to copy verbatim
+	StripSuffix []string // --strip-suffix: suffixes removed from rendered file names
+
+	// Config file
+	Config      string            // --config; after parsing, the file loaded ("" when none)
+	Profile     string            // --profile: named profile of the config file
+	NoConfig    bool              // --no-config: ignore config files
+	PrintConfig bool              // --print-config: print the effective options as a config file
+	Overrides   []config.Override // per-file settings from the config file
+
 	// Positional file args
 	Positional []string
 }
 
+// Backups reports whether in-place edits back up the files they replace:
+// any of --backup, --backup-mode and --backup-dir turns backups on.
+func (o Options) Backups() bool {
+	return o.BackupExt != "" || o.BackupMode != "" || o.BackupDir != ""
+}
+
+// escapeFormats lists the --format choices.
+var escapeFormats = []string{"yaml", "json", "xml", "shell", "toml", "env"}
+
 // ParseFlags parses CLI flags and returns Options or a (help/version) error.
+// Unless --no-config is given, settings from the config file (--config, or
+// .vex.yaml found in the working directory or a parent) fill in the flags
+// the command line leaves unset.
 func ParseFlags(args []string, version, commit string) (Options, error) {
+	args, off, err := negations(args)
+	if err != nil {
+		return Options{}, err
+	}
+	out, changed, err := parse(args, version)
+	if err != nil || out.NoConfig {
+		return out, err
+	}
+	for _, name := range off {
+		changed[name] = false // turned off on the command line
+	}
+	if out.Config == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return Options{}, err
+		}
+		if out.Config, err = config.Find(wd); err != nil {
+			return Options{}, err
+		}
+		if out.Config == "" {
+			if out.Profile != "" {
+				return Options{}, fmt.Errorf("--profile %s: no config file found", out.Profile)
+			}
+			return out, nil
+		}
+	}
+	file, err := config.Load(out.Config)
+	if err != nil {
+		return Options{}, err
+	}
+	prof, err := file.Select(out.Profile)
+	if err != nil {
+		return Options{}, fmt.Errorf("%s: %w", out.Config, err)
+	}
+	for i, o := range prof.Overrides {
+		if o.Format != nil && !slices.Contains(escapeFormats, *o.Format) {
+			return Options{}, fmt.Errorf("%s: overrides[%d]: invalid format %q (allowed: %s)", out.Config, i, *o.Format, strings.Join(escapeFormats, ", "))
+		}
+	}
+
+	// Parse again with the config settings in front; the command line has
+	// already been validated, so errors come from the config file.
+	pre := prof.Args(func(name string) bool {
+		_, onCLI := changed[name]
+		return onCLI && name != "set" || // --set merges per key, the command line last
+			(strings.HasPrefix(name, "backup") || name == "follow-symlinks") && !out.InPlace && !out.Restore || // these only apply with -i or --restore
+			name == "atomic-all" && !out.InPlace
+	})
+	path := out.Config
+	if out, _, err = parse(append(pre, args...), version); err != nil {
+		return Options{}, fmt.Errorf("%s: %w", path, err)
+	}
+	out.Config, out.Overrides = path, prof.Overrides
+	return out, nil
+}
+
+// negations rewrites --FLAG=BOOL and --no-FLAG for the bool flags a config
+// file may set, which the parser only takes as --FLAG, so the command line
+// can turn off what the config file turns on. It returns the remaining
+// args and the flags turned off.
+func negations(args []string) ([]string, []string, error) {
+	bools := config.Bools()
+	var out, off []string
+	for i, arg := range args {
+		if arg == "--" {
+			out = append(out, args[i:]...)
+			break
+		}
+		name, val, hasVal := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		on := true
+		switch {
+		case !strings.HasPrefix(arg, "--"):
+			out = append(out, arg)
+			continue
+		case slices.Contains(bools, name):
+			if hasVal {
+				b, err := strconv.ParseBool(val)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid value for flag --%s: %q", name, val)
+				}
+				on = b
+			}
+		case !hasVal && strings.HasPrefix(name, "no-") && slices.Contains(bools, name[3:]):
+			name, on = name[3:], false
+		default:
+			out = append(out, arg)
+			continue
+		}
+		// the last occurrence wins
+		out = slices.DeleteFunc(out, func(a string) bool { return a == "--"+name })
+		off = slices.DeleteFunc(off, func(o string) bool { return o == name })
+		if on {
+			out = append(out, "--"+name)
+		} else {
+			off = append(off, name)
+		}
+	}
+	return out, off, nil
+}
+
+// parse parses args and also returns the flags they set.
+func parse(args []string, version string) (Options, map[string]any, error) {
 	var out Options
 
 	fs := tinyflags.NewFlagSet("vex", tinyflags.ContinueOnError)
@@ -61,6 +255,32 @@ func ParseFlags(args []string, version, commit string) (Options, error) {
 			return "." + cleaned
 		}).
 		Short("b").
+		Value()
+	fs.StringVar(&out.BackupMode, "backup-mode", "", "when -i, how backups are named: simple (FILE+EXT), numbered (FILE.~N~), existing (numbered if FILE has numbered backups) or timestamp (FILE.~TIME~)").
+		Choices("simple", "numbered", "existing", "timestamp").
+		Placeholder("MODE").
+		Value()
+	fs.StringVar(&out.BackupDir, "backup-dir", "", "when -i, write backups into this directory, below the absolute path of each file's directory").
+		Placeholder("DIR").
+		Value()
+	fs.IntVar(&out.BackupKeep, "backup-keep", 0, "when -i, keep at most this many numbered or timestamped backups per file (0: all)").
+		Validate(func(n int) error {
+			if n < 0 {
+				return errors.New("must not be negative")
+			}
+			return nil
+		}).
+		Placeholder("N").
+		Value()
+	fs.BoolVar(&out.Restore, "restore", false, "replace each file with its most recent backup, found with the same --backup* flags as the edit").
+		OneOfGroup("mode").
+		Value()
+	fs.BoolVar(&out.AtomicAll, "atomic-all", false, "when -i, render every file before replacing any; on failure no file is touched").
+		Requires("in-place").
+		Value()
+	fs.BoolVar(&out.FollowSymlinks, "follow-symlinks", false, "when -i or --restore, edit the file a symlink points to; without it, symlinks are refused").
+		Value()
+	fs.BoolVar(&out.Status, "status", false, "when -i, print 'PATH: changed' or 'PATH: unchanged' for each file (unchanged files are not rewritten)").
 		Requires("in-place").
 		Value()
 
@@ -71,9 +291,16 @@ func ParseFlags(args []string, version, commit string) (Options, error) {
 		Short("l").
 		Value()
 
+	// Escaping
+	fs.BoolVar(&out.AutoEscape, "auto-escape", false, "escape values for where they land (quoted strings, attributes, ...); format from file extension").
+		Value()
+	fs.StringVar(&out.EscapeFormat, "format", "", "with --auto-escape, escape for this format instead of the file extension (implies --auto-escape)").
+		Choices(escapeFormats...).
+		Placeholder("FORMAT").
+		Value()
+
 	// Failure policy
-	var strict bool
-	fs.BoolVar(&strict, "strict", false, "exit on unset or empty (equivalent to --error-unset --error-empty)").
+	fs.BoolVar(&out.Strict, "strict", false, "exit on unset, empty or unterminated ${...} (implies --error-unset --error-empty)").
 		Short("x").
 		Value()
 	fs.BoolVar(&out.ErrorUnset, "error-unset", false, "error if a variable is unset").
@@ -82,6 +309,8 @@ func ParseFlags(args []string, version, commit string) (Options, error) {
 	fs.BoolVar(&out.ErrorEmpty, "error-empty", false, "error if a substitution resolves to empty").
 		Short("e").
 		Value()
+	fs.BoolVar(&out.ReportAll, "report-all", false, "collect all expansion errors across files before failing; in-place targets stay untouched").
+		Value()
 
 	// Replacement policy
 	var keepVars bool
@@ -105,6 +334,42 @@ func ParseFlags(args []string, version, commit string) (Options, error) {
 	fs.StringSliceVar(&out.Variables, "variable", nil, "only replace variables with these exact names").
 		Short("v").
 		Value()
+	fs.StringSliceVar(&out.Match, "match", nil, "only replace variables matching any of these glob patterns (e.g. 'APP_*_URL')").
+		Validate(validGlob).
+		Placeholder("GLOB").
+		Value()
+	fs.StringSliceVar(&out.MatchRegex, "match-regex", nil, "only replace variables matching any of these regular expressions (unanchored)").
+		Delimiter("\x00"). // regexps may contain commas
+		Validate(func(re string) error {
+			_, err := regexp.Compile(re)
+			return err
+		}).
+		Placeholder("REGEX").
+		Value()
+
+	fs.StringSliceVar(&out.VariablesFiles, "variables-file", nil, "read --variable entries from files, one per line ('#' comments)").
+		Placeholder("PATH...").
+		Value()
+	fs.StringSliceVar(&out.PrefixFiles, "prefixes-file", nil, "read --prefix entries from files, one per line ('#' comments)").
+		Placeholder("PATH...").
+		Value()
+	fs.StringSliceVar(&out.SuffixFiles, "suffixes-file", nil, "read --suffix entries from files, one per line ('#' comments)").
+		Placeholder("PATH...").
+		Value()
+	fs.BoolVar(&out.VariablesFromVars, "variables-from-vars", false, "only replace variables defined by --extra-vars files and --vars-dir directories").
+		Value()
+
+	// Deny lists
+	fs.StringSliceVar(&out.ExcludeVariables, "exclude-variable", nil, "never replace variables with these exact names (e.g. HOME, host)").
+		Value()
+	fs.StringSliceVar(&out.ExcludePrefix, "exclude-prefix", nil, "never replace variables starting with any of these prefixes").
+		Value()
+	fs.StringSliceVar(&out.ExcludeVariablesFiles, "exclude-variables-file", nil, "read --exclude-variable entries from files, one per line ('#' comments)").
+		Placeholder("PATH...").
+		Value()
+	fs.StringSliceVar(&out.ExcludePrefixFiles, "exclude-prefixes-file", nil, "read --exclude-prefix entries from files, one per line ('#' comments)").
+		Placeholder("PATH...").
+		Value()
 
 	// Coloring
 	fs.BoolVar(&out.Colored, "colored", false, "colorize formatter (content and diagnostics)").
@@ -112,32 +377,216 @@ func ParseFlags(args []string, version, commit string) (Options, error) {
 		OneOfGroup("mode").
 		Value()
 
+	// Analysis
+	fs.BoolVar(&out.ListVars, "list-vars", false, "print referenced variable names instead of expanding").
+		OneOfGroup("mode").
+		Value()
+	fs.BoolVar(&out.Check, "check", false, "validate templates without writing output (exit 2: malformed, 3: environment incomplete)").
+		OneOfGroup("mode").
+		Value()
+	fs.BoolVar(&out.JSON, "json", false, "with --list-vars, print occurrences, operators and defaults as JSON").
+		Value()
+
+	// Environment
+	fs.BoolVar(&out.NoEnv, "no-env", false, "hide the host environment; only --set, --vars-dir and --extra-vars variables are visible").
+		Value()
+	fs.StringSliceVar(&out.EnvAllow, "env-allow", nil, "only pass through host variables matching these glob patterns (e.g. 'APP_*')").
+		Validate(validGlob).
+		Placeholder("PATTERN").
+		Value()
+	fs.StringSliceVar(&out.Set, "set", nil, "set a variable, overriding files and environment (can be repeated)").
+		Delimiter("\x00"). // values may contain commas
+		PreserveSpace().
+		Validate(func(kv string) error {
+			k, _, ok := strings.Cut(kv, "=")
+			if !ok || k == "" || strings.TrimFunc(k, isNameRune) != "" || k[0] >= '0' && k[0] <= '9' {
+				return errors.New("expected KEY=VALUE with a valid variable name")
+			}
+			return nil
+		}).
+		Placeholder("KEY=VALUE").
+		Value()
+
 	// Vars files
 	fs.StringSliceVar(&out.VarsFiles, "extra-vars", nil, "read variables from file (can be repeated)").
 		Short("e").
 		Placeholder("PATH...").
 		Value()
+	fs.StringVar(&out.VarsSeparator, "vars-separator", "_", "join nested keys of JSON/YAML/TOML vars files with this separator").
+		Validate(func(s string) error {
+			if s == "" || strings.TrimFunc(s, isNameRune) != "" {
+				return errors.New("separator must consist of letters, digits or '_'")
+			}
+			return nil
+		}).
+		Placeholder("SEP").
+		Value()
+	fs.StringVar(&out.VarsCase, "vars-case", "upper", "letter case of names flattened from JSON/YAML/TOML vars files").
+		Choices("upper", "lower", "keep").
+		Placeholder("CASE").
+		Value()
+	fs.BoolVar(&out.VarsJSON, "vars-json", false, "also expose maps and lists of JSON/YAML/TOML vars files as JSON strings").
+		Value()
+	fs.BoolVar(&out.VarsInterpolate, "vars-interpolate", false, "expand ${OTHER} references in dotenv vars files ($$ is a literal $)").
+		Value()
+	fs.StringSliceVar(&out.VarsDirs, "vars-dir", nil, "read variables from a directory, one file per variable (can be repeated; --extra-vars override)").
+		Placeholder("DIR...").
+		Value()
+	fs.BoolVar(&out.VarsDirTrim, "vars-dir-trim", false, "trim one trailing newline from --vars-dir values").
+		Value()
+	fs.BoolVar(&out.VarsDirSanitize, "vars-dir-sanitize", false, "map --vars-dir file names to valid variable names (db-pass.txt -> db_pass_txt)").
+		Value()
+
+	// VAR_FILE secrets
+	fs.BoolVar(&out.FileEnv, "file-env", false, "resolve an unset VAR from the file named by VAR_FILE (trailing newline trimmed)").
+		Value()
+	fs.StringSliceVar(&out.FileEnvDirs, "file-env-dir", nil, "only read VAR_FILE paths inside these directories (implies --file-env)").
+		Placeholder("DIR...").
+		Value()
+	fs.Int64Var(&out.FileEnvMaxSize, "file-env-max-size", 1<<20, "largest VAR_FILE read, in bytes").
+		Validate(func(n int64) error {
+			if n <= 0 {
+				return errors.New("size must be positive")
+			}
+			return nil
+		}).
+		Placeholder("BYTES").
+		Value()
+
+	// Preview of in-place edits
+	fs.BoolVar(&out.Diff, "diff", false, "print a unified diff of the changes -i would make instead of writing (exit 1 when files would change)").
+		Value()
+	fs.BoolVar(&out.DryRun, "dry-run", false, "print the names of the files -i would change instead of writing (exit 1 when files would change)").
+		Value()
+
+	// Directory rendering
+	fs.StringVar(&out.OutputDir, "output-dir", "", "render the source directory (the only argument) recursively into this directory").
+		Short("o").
+		OneOfGroup("mode").
+		Placeholder("DIR").
+		Value()
+	fs.StringSliceVar(&out.Include, "include", nil, "with --output-dir, only render files matching these globs (default all); others are copied verbatim").
+		Validate(validGlob).
+		Requires("output-dir").
+		Placeholder("GLOB").
+		Value()
+	fs.StringSliceVar(&out.Exclude, "exclude", nil, "with --output-dir, copy files matching these globs verbatim").
+		Validate(validGlob).
+		Requires("output-dir").
+		Placeholder("GLOB").
+		Value()
+	fs.StringSliceVar(&out.StripSuffix, "strip-suffix", nil, "with --output-dir, remove these suffixes from rendered file names (e.g. .tmpl,.tpl)").
+		Requires("output-dir").
+		Placeholder("SUFFIX").
+		Value()
+
+	// Config file
+	fs.StringVar(&out.Config, "config", "", "read settings from this config file instead of .vex.yaml in the working directory or a parent").
+		Placeholder("PATH").
+		Value()
+	fs.StringVar(&out.Profile, "profile", "", "apply this profile of the config file").
+		Placeholder("NAME").
+		Value()
+	fs.BoolVar(&out.NoConfig, "no-config", false, "ignore config files").
+		Value()
+	fs.BoolVar(&out.PrintConfig, "print-config", false, "print the effective options as a config file and exit").
+		Value()
 
 	// Parse
 	if err := fs.Parse(args); err != nil {
-		return Options{}, err
+		return Options{}, nil, err
 	}
 	out.Positional = fs.Args()
 
 	// --strict implies both error flags
-	if strict {
+	if out.Strict {
 		out.ErrorUnset, out.ErrorEmpty = true, true
 	}
 
+	// list files and --variables-from-vars restrict even when they turn out empty
+	out.Restricted = len(out.VariablesFiles) > 0 || len(out.PrefixFiles) > 0 || len(out.SuffixFiles) > 0 || out.VariablesFromVars
+
+	// --file-env-dir implies --file-env
+	if len(out.FileEnvDirs) > 0 {
+		out.FileEnv = true
+	}
+
+	// --format implies --auto-escape
+	if out.EscapeFormat != "" {
+		out.AutoEscape = true
+	}
+	// backups are made by -i and put back by --restore
+	changed := fs.OverriddenValues()
+	if !out.InPlace && !out.Restore {
+		for _, name := range []string{"backup", "backup-mode", "backup-dir", "backup-keep", "follow-symlinks"} {
+			if _, ok := changed[name]; ok {
+				return Options{}, nil, fmt.Errorf("--%s requires --in-place or --restore", name)
+			}
+		}
+	}
+
+	// --diff and --dry-run render like -i and only color the diff
+	preview := out.Diff || out.DryRun
+	if preview && (out.Check || out.ListVars || out.OutputDir != "" || out.Restore) {
+		return Options{}, nil, errors.New("--diff and --dry-run cannot be combined with --check, --list-vars, --output-dir or --restore")
+	}
+
+	// escaping would mangle the color codes
+	if out.AutoEscape && out.Colored && !preview {
+		return Options{}, nil, errors.New("--auto-escape cannot be combined with --colored")
+	}
+
 	// --keep-vars implies both keep-*
 	if keepVars {
 		out.KeepUnset, out.KeepEmpty = true, true
 	}
 
 	// if --colored is set, it alwasys should show which variables are missing or empty
-	if out.Colored {
+	if out.Colored && !preview {
 		out.KeepUnset, out.KeepEmpty = true, true
 	}
 
-	return out, nil
+	return out, changed, nil
+}
+
+// validGlob reports whether p is a valid path.Match pattern.
+func validGlob(p string) error {
+	_, err := path.Match(p, "")
+	return err
+}
+
+// isNameRune reports whether r may appear in a variable name.
+func isNameRune(r rune) bool {
+	return r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// Effective returns o as a config file profile, for --print-config. Flags
+// a config file cannot set (modes, positional files) are left out.
+func (o Options) Effective() config.Profile {
+	var s config.Settings
+	s.Backup, s.BackupMode, s.BackupDir, s.BackupKeep = &o.BackupExt, &o.BackupMode, &o.BackupDir, &o.BackupKeep
+	s.AtomicAll, s.FollowSymlinks = &o.AtomicAll, &o.FollowSymlinks
+	s.NoOps, s.LiteralDollar = &o.NoOps, &o.NoEscape
+	s.AutoEscape, s.Format = &o.AutoEscape, &o.EscapeFormat
+	s.Strict, s.ErrorUnset, s.ErrorEmpty, s.ReportAll = &o.Strict, &o.ErrorUnset, &o.ErrorEmpty, &o.ReportAll
+	s.KeepUnset, s.KeepEmpty = &o.KeepUnset, &o.KeepEmpty
+	s.Prefix, s.Suffix, s.Variable = o.Prefix, o.Suffix, o.Variables
+	s.Match, s.MatchRegex = o.Match, o.MatchRegex
+	s.VariablesFile, s.PrefixesFile, s.SuffixesFile = o.VariablesFiles, o.PrefixFiles, o.SuffixFiles
+	s.VariablesFromVars = &o.VariablesFromVars
+	s.ExcludeVariable, s.ExcludePrefix = o.ExcludeVariables, o.ExcludePrefix
+	s.ExcludeVariablesFile, s.ExcludePrefixesFile = o.ExcludeVariablesFiles, o.ExcludePrefixFiles
+	s.NoEnv, s.EnvAllow = &o.NoEnv, o.EnvAllow
+	if len(o.Set) > 0 {
+		s.Set = make(map[string]string, len(o.Set))
+		for _, kv := range o.Set {
+			k, v, _ := strings.Cut(kv, "=") // validated by flag parsing
+			s.Set[k] = v
+		}
+	}
+	s.ExtraVars, s.VarsSeparator, s.VarsCase, s.VarsJSON = o.VarsFiles, &o.VarsSeparator, &o.VarsCase, &o.VarsJSON
+	s.VarsInterpolate = &o.VarsInterpolate
+	s.VarsDir, s.VarsDirTrim, s.VarsDirSanitize = o.VarsDirs, &o.VarsDirTrim, &o.VarsDirSanitize
+	s.FileEnv, s.FileEnvDir, s.FileEnvMaxSize = &o.FileEnv, o.FileEnvDirs, &o.FileEnvMaxSize
+	return config.Profile{Settings: s, Overrides: o.Overrides}
 }
@@ -1,6 +1,8 @@
 package flag
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,7 +15,7 @@ func TestParseFlags(t *testing.T) {
 	t.Run("no args", func(t *testing.T) {
 		t.Parallel()
 
-		flags, err := ParseFlags([]string{}, "1.2.3", "abc123")
+		flags, err := ParseFlags([]string{"--no-config"}, "1.2.3", "abc123")
 		require.NoError(t, err)
 
 		assert.False(t, flags.InPlace)
@@ -41,6 +43,7 @@ func TestParseFlags(t *testing.T) {
 	t.Run("in-place and backup", func(t *testing.T) {
 		t.Parallel()
 		flags, err := ParseFlags([]string{
+			"--no-config",
 			"-i",
 			"--backup", ".bak",
 		}, "1.0.0", "deadbeef")
@@ -53,16 +56,82 @@ func TestParseFlags(t *testing.T) {
 	t.Run("Backup without --in-place", func(t *testing.T) {
 		t.Parallel()
 		flags, err := ParseFlags([]string{
+			"--no-config",
 			"--backup", ".bak",
 		}, "1.0.0", "deadbeef")
 		require.Error(t, err)
-		assert.EqualError(t, err, "--backup requires --in-place")
+		assert.EqualError(t, err, "--backup requires --in-place or --restore")
 		assert.Empty(t, flags)
 	})
 
+	t.Run("backup rotation", func(t *testing.T) {
+		t.Parallel()
+		flags, err := ParseFlags([]string{
+			"--no-config",
+			"-i", "--backup-mode", "numbered", "--backup-dir", "/var/backups", "--backup-keep", "3",
+		}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.Equal(t, "numbered", flags.BackupMode)
+		assert.Equal(t, "/var/backups", flags.BackupDir)
+		assert.Equal(t, 3, flags.BackupKeep)
+		assert.True(t, flags.Backups())
+	})
+
+	t.Run("backup flags without --in-place or --restore", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "--backup-dir", "/tmp"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, "--backup-dir requires --in-place or --restore")
+	})
+
+	t.Run("invalid backup mode and keep", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "-i", "--backup-mode", "daily"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		_, err = ParseFlags([]string{"--no-config", "-i", "--backup-keep", "-1"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		t.Parallel()
+		flags, err := ParseFlags([]string{"--no-config", "--restore", "--backup", "bak", "f.txt"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.Restore)
+		assert.Equal(t, ".bak", flags.BackupExt)
+		assert.Equal(t, []string{"f.txt"}, flags.Positional)
+	})
+
+	t.Run("restore conflicts with in-place", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "--restore", "-i", "f.txt"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("follow-symlinks requires in-place or restore", func(t *testing.T) {
+		t.Parallel()
+		flags, err := ParseFlags([]string{"--no-config", "-i", "--follow-symlinks"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.FollowSymlinks)
+
+		_, err = ParseFlags([]string{"--no-config", "--follow-symlinks"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, "--follow-symlinks requires --in-place or --restore")
+
+		_, err = ParseFlags([]string{"--no-config", "--restore", "--follow-symlinks", "f"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+	})
+
+	t.Run("status requires in-place", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "--status"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, "--status requires --in-place")
+	})
+
 	t.Run("BackupExt with leading dot", func(t *testing.T) {
 		t.Parallel()
 		flags, err := ParseFlags([]string{
+			"--no-config",
 			"--in-place",
 			"--backup", ".bak",
 		}, "1.0.0", "deadbeef")
@@ -73,6 +142,7 @@ func TestParseFlags(t *testing.T) {
 	t.Run("BackupExt without leading dot", func(t *testing.T) {
 		t.Parallel()
 		flags, err := ParseFlags([]string{
+			"--no-config",
 			"--in-place",
 			"--backup", "bak",
 		}, "1.0.0", "deadbeef")
@@ -83,7 +153,7 @@ func TestParseFlags(t *testing.T) {
 	t.Run("no-ops", func(t *testing.T) {
 		t.Parallel()
 
-		flags, err := ParseFlags([]string{"--no-ops", "--literal-dollar"}, "1.0.0", "deadbeef")
+		flags, err := ParseFlags([]string{"--no-config", "--no-ops", "--literal-dollar"}, "1.0.0", "deadbeef")
 		require.NoError(t, err)
 
 		assert.True(t, flags.NoOps)
@@ -93,17 +163,220 @@ func TestParseFlags(t *testing.T) {
 	t.Run("strict implies both error flags", func(t *testing.T) {
 		t.Parallel()
 
-		flags, err := ParseFlags([]string{"--strict"}, "1.0.0", "deadbeef")
+		flags, err := ParseFlags([]string{"--no-config", "--strict"}, "1.0.0", "deadbeef")
 		require.NoError(t, err)
 
+		assert.True(t, flags.Strict)
 		assert.True(t, flags.ErrorUnset)
 		assert.True(t, flags.ErrorEmpty)
 	})
 
+	t.Run("list-vars with json", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--list-vars", "--json"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+
+		assert.True(t, flags.ListVars)
+		assert.True(t, flags.JSON)
+	})
+
+	t.Run("list-vars excludes in-place", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseFlags([]string{"--no-config", "--list-vars", "-i", "f"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("auto-escape", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--auto-escape", "a.yaml"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.AutoEscape)
+		assert.Equal(t, "", flags.EscapeFormat)
+	})
+
+	t.Run("format implies auto-escape", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--format", "json"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.AutoEscape)
+		assert.Equal(t, "json", flags.EscapeFormat)
+	})
+
+	t.Run("format rejects unknown formats", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseFlags([]string{"--no-config", "--format", "ini"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("auto-escape excludes colored", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseFlags([]string{"--no-config", "--auto-escape", "--colored"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, "--auto-escape cannot be combined with --colored")
+	})
+
+	t.Run("vars flattening defaults", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.Equal(t, "_", flags.VarsSeparator)
+		assert.Equal(t, "upper", flags.VarsCase)
+		assert.False(t, flags.VarsJSON)
+		assert.False(t, flags.VarsInterpolate)
+	})
+
+	t.Run("vars flattening options", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--vars-separator", "__", "--vars-case", "lower", "--vars-json"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.Equal(t, "__", flags.VarsSeparator)
+		assert.Equal(t, "lower", flags.VarsCase)
+		assert.True(t, flags.VarsJSON)
+	})
+
+	t.Run("vars interpolation", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--vars-interpolate"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.VarsInterpolate)
+	})
+
+	t.Run("vars flattening rejects bad values", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseFlags([]string{"--no-config", "--vars-separator", "."}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		_, err = ParseFlags([]string{"--no-config", "--vars-case", "title"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("vars dirs", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--vars-dir", "/run/secrets", "--vars-dir", "/etc/config", "--vars-dir-trim", "--vars-dir-sanitize"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/run/secrets", "/etc/config"}, flags.VarsDirs)
+		assert.True(t, flags.VarsDirTrim)
+		assert.True(t, flags.VarsDirSanitize)
+	})
+
+	t.Run("file-env", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.False(t, flags.FileEnv)
+		assert.Equal(t, int64(1<<20), flags.FileEnvMaxSize)
+
+		flags, err = ParseFlags([]string{"--no-config", "--file-env-dir", "/run/secrets", "--file-env-max-size", "64"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.FileEnv)
+		assert.Equal(t, []string{"/run/secrets"}, flags.FileEnvDirs)
+		assert.Equal(t, int64(64), flags.FileEnvMaxSize)
+
+		_, err = ParseFlags([]string{"--no-config", "--file-env-max-size", "0"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("environment isolation", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--no-env", "--env-allow", "APP_*", "--set", "A=1,2", "--set", "B= x ", "--set", "C="}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.NoEnv)
+		assert.Equal(t, []string{"APP_*"}, flags.EnvAllow)
+		assert.Equal(t, []string{"A=1,2", "B= x ", "C="}, flags.Set)
+	})
+
+	t.Run("set rejects bad assignments", func(t *testing.T) {
+		t.Parallel()
+
+		for _, kv := range []string{"NOEQ", "=v", "A-B=v", "1A=v"} {
+			_, err := ParseFlags([]string{"--no-config", "--set", kv}, "1.0.0", "deadbeef")
+			require.Error(t, err, kv)
+		}
+		_, err := ParseFlags([]string{"--no-config", "--env-allow", "[a-"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("match and exclude filters", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{
+			"--no-config",
+			"--match", "APP_*_URL", "--match-regex", "^DB_[A-Z]{2,}$",
+			"--exclude-variable", "HOME,PATH", "--exclude-prefix", "nginx_",
+		}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"APP_*_URL"}, flags.Match)
+		assert.Equal(t, []string{"^DB_[A-Z]{2,}$"}, flags.MatchRegex)
+		assert.Equal(t, []string{"HOME", "PATH"}, flags.ExcludeVariables)
+		assert.Equal(t, []string{"nginx_"}, flags.ExcludePrefix)
+	})
+
+	t.Run("match filters reject bad patterns", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseFlags([]string{"--no-config", "--match", "[A-"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		_, err = ParseFlags([]string{"--no-config", "--match-regex", "("}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("filter list files restrict", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.False(t, flags.Restricted)
+
+		flags, err = ParseFlags([]string{"--no-config", "--variables-file", "vars.txt", "--exclude-prefixes-file", "deny.txt"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"vars.txt"}, flags.VariablesFiles)
+		assert.Equal(t, []string{"deny.txt"}, flags.ExcludePrefixFiles)
+		assert.True(t, flags.Restricted)
+
+		flags, err = ParseFlags([]string{"--no-config", "--exclude-variables-file", "deny.txt"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.False(t, flags.Restricted) // deny lists do not restrict
+
+		flags, err = ParseFlags([]string{"--no-config", "--variables-from-vars"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.Restricted)
+	})
+
+	t.Run("check", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--check", "a.txt"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+
+		assert.True(t, flags.Check)
+		assert.Equal(t, []string{"a.txt"}, flags.Positional)
+	})
+
+	t.Run("report-all", func(t *testing.T) {
+		t.Parallel()
+
+		flags, err := ParseFlags([]string{"--no-config", "--report-all"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+
+		assert.True(t, flags.ReportAll)
+	})
+
 	t.Run("keep-vars implies keep-unset and keep-empty", func(t *testing.T) {
 		t.Parallel()
 
-		flags, err := ParseFlags([]string{"--keep-vars"}, "1.0.0", "deadbeef")
+		flags, err := ParseFlags([]string{"--no-config", "--keep-vars"}, "1.0.0", "deadbeef")
 		require.NoError(t, err)
 
 		// --keep-vars implies both keep-* flags
@@ -118,6 +391,7 @@ func TestParseFlags(t *testing.T) {
 		t.Parallel()
 
 		args := []string{
+			"--no-config",
 			"--prefix", "APP_",
 			"-p", "SYS_",
 			"--suffix", "_TOKEN",
@@ -136,7 +410,7 @@ func TestParseFlags(t *testing.T) {
 	t.Run("colored", func(t *testing.T) {
 		t.Parallel()
 
-		flags, err := ParseFlags([]string{"--colored"}, "1.0.0", "deadbeef")
+		flags, err := ParseFlags([]string{"--no-config", "--colored"}, "1.0.0", "deadbeef")
 		require.NoError(t, err)
 
 		assert.True(t, flags.Colored)
@@ -146,6 +420,7 @@ func TestParseFlags(t *testing.T) {
 		t.Parallel()
 
 		flags, err := ParseFlags([]string{
+			"--no-config",
 			"--no-ops",
 			"file1.txt",
 			"file two.md",
@@ -161,10 +436,201 @@ func TestParseFlags(t *testing.T) {
 	t.Run("invalid args", func(t *testing.T) {
 		t.Parallel()
 		flags, err := ParseFlags([]string{
+			"--no-config",
 			"--invalid-flag",
 		}, "1.0.0", "deadbeef")
 		require.Error(t, err)
 		assert.EqualError(t, err, "unknown flag --invalid-flag")
 		assert.Empty(t, flags)
 	})
+
+	t.Run("config file", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		cfg := filepath.Join(dir, "vex.yaml")
+		require.NoError(t, os.WriteFile(cfg, []byte(`
+strict: true
+prefix: [APP_]
+backup: orig
+vars-case: keep
+extra-vars: [vars.env]
+set: {A: "1", B: "1"}
+overrides:
+  - files: ["*.json"]
+    format: json
+profiles:
+  prod:
+    prefix: [PROD_]
+    set: {B: "2"}
+`), 0o600))
+
+		t.Run("fills unset flags", func(t *testing.T) {
+			t.Parallel()
+			flags, err := ParseFlags([]string{"--config", cfg, "file.txt"}, "1.0.0", "deadbeef")
+			require.NoError(t, err)
+			assert.Equal(t, cfg, flags.Config)
+			assert.True(t, flags.Strict)
+			assert.True(t, flags.ErrorUnset)
+			assert.Equal(t, []string{"APP_"}, flags.Prefix)
+			assert.Equal(t, "keep", flags.VarsCase)
+			assert.Equal(t, []string{filepath.Join(dir, "vars.env")}, flags.VarsFiles)
+			assert.Equal(t, []string{"A=1", "B=1"}, flags.Set)
+			assert.Empty(t, flags.BackupExt, "backup only applies with -i")
+			require.Len(t, flags.Overrides, 1)
+			assert.Equal(t, []string{"file.txt"}, flags.Positional)
+		})
+
+		t.Run("command line wins", func(t *testing.T) {
+			t.Parallel()
+			flags, err := ParseFlags([]string{
+				"--config", cfg,
+				"-i",
+				"-p", "CLI_",
+				"--vars-case", "upper",
+				"--set", "B=3",
+			}, "1.0.0", "deadbeef")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"CLI_"}, flags.Prefix)
+			assert.Equal(t, "upper", flags.VarsCase)
+			assert.Equal(t, []string{"A=1", "B=1", "B=3"}, flags.Set, "later --set wins")
+			assert.Equal(t, ".orig", flags.BackupExt)
+		})
+
+		t.Run("command line turns bools off", func(t *testing.T) {
+			t.Parallel()
+			for _, args := range [][]string{
+				{"--no-strict"},
+				{"--strict=false"},
+				{"--strict", "--no-strict"},
+			} {
+				flags, err := ParseFlags(append([]string{"--config", cfg}, args...), "1.0.0", "deadbeef")
+				require.NoError(t, err, args)
+				assert.False(t, flags.Strict, args)
+				assert.False(t, flags.ErrorUnset, args)
+				assert.Equal(t, []string{"APP_"}, flags.Prefix, args)
+			}
+
+			flags, err := ParseFlags([]string{"--config", cfg, "--no-strict", "--strict=true"}, "1.0.0", "deadbeef")
+			require.NoError(t, err)
+			assert.True(t, flags.Strict, "the last occurrence wins")
+
+			_, err = ParseFlags([]string{"--config", cfg, "--strict=maybe"}, "1.0.0", "deadbeef")
+			require.Error(t, err)
+			assert.EqualError(t, err, `invalid value for flag --strict: "maybe"`)
+		})
+
+		t.Run("profile", func(t *testing.T) {
+			t.Parallel()
+			flags, err := ParseFlags([]string{"--config", cfg, "--profile", "prod"}, "1.0.0", "deadbeef")
+			require.NoError(t, err)
+			assert.Equal(t, "prod", flags.Profile)
+			assert.Equal(t, []string{"PROD_"}, flags.Prefix)
+			assert.Equal(t, []string{"A=1", "B=2"}, flags.Set)
+			assert.True(t, flags.Strict)
+		})
+
+		t.Run("no-config", func(t *testing.T) {
+			t.Parallel()
+			flags, err := ParseFlags([]string{"--config", cfg, "--no-config"}, "1.0.0", "deadbeef")
+			require.NoError(t, err)
+			assert.False(t, flags.Strict)
+			assert.Empty(t, flags.Overrides)
+		})
+
+		t.Run("unknown profile", func(t *testing.T) {
+			t.Parallel()
+			_, err := ParseFlags([]string{"--config", cfg, "--profile", "dev"}, "1.0.0", "deadbeef")
+			require.Error(t, err)
+			assert.EqualError(t, err, cfg+`: unknown profile "dev" (want one of prod)`)
+		})
+	})
+
+	t.Run("invalid config values", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+
+		cfg := filepath.Join(dir, "bad-case.yaml")
+		require.NoError(t, os.WriteFile(cfg, []byte("vars-case: title\n"), 0o600))
+		_, err := ParseFlags([]string{"--config", cfg}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.ErrorContains(t, err, cfg+": invalid value for flag --vars-case")
+
+		cfg = filepath.Join(dir, "bad-format.yaml")
+		require.NoError(t, os.WriteFile(cfg, []byte("overrides:\n  - files: ['*.x']\n    format: ini\n"), 0o600))
+		_, err = ParseFlags([]string{"--config", cfg}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, cfg+`: overrides[0]: invalid format "ini" (allowed: yaml, json, xml, shell, toml, env)`)
+	})
+
+	t.Run("Effective", func(t *testing.T) {
+		t.Parallel()
+		flags, err := ParseFlags([]string{"--no-config", "--strict", "--set", "A=x=y", "-p", "APP_"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+
+		p := flags.Effective()
+		assert.True(t, *p.Strict)
+		assert.True(t, *p.ErrorEmpty)
+		assert.Equal(t, []string{"APP_"}, p.Prefix)
+		assert.Equal(t, map[string]string{"A": "x=y"}, p.Set)
+		assert.Equal(t, "upper", *p.VarsCase)
+	})
+
+	t.Run("output-dir", func(t *testing.T) {
+		t.Parallel()
+		flags, err := ParseFlags([]string{
+			"--no-config",
+			"-o", "out",
+			"--include", "*.tmpl,*.conf",
+			"--exclude", "vendor/*",
+			"--strip-suffix", ".tmpl",
+			"src",
+		}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.Equal(t, "out", flags.OutputDir)
+		assert.Equal(t, []string{"*.tmpl", "*.conf"}, flags.Include)
+		assert.Equal(t, []string{"vendor/*"}, flags.Exclude)
+		assert.Equal(t, []string{".tmpl"}, flags.StripSuffix)
+		assert.Equal(t, []string{"src"}, flags.Positional)
+	})
+
+	t.Run("include requires output-dir", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "--include", "*.tmpl"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, "--include requires --output-dir")
+	})
+
+	t.Run("output-dir conflicts with in-place", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "-o", "out", "-i"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+	})
+
+	t.Run("diff with colored keeps the replacement policy", func(t *testing.T) {
+		t.Parallel()
+		flags, err := ParseFlags([]string{"--no-config", "--diff", "--colored", "--auto-escape", "f"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.Diff)
+		assert.True(t, flags.Colored)
+		assert.False(t, flags.KeepUnset)
+		assert.False(t, flags.KeepEmpty)
+	})
+
+	t.Run("dry-run conflicts with check", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "--dry-run", "--check", "f"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, "--diff and --dry-run cannot be combined with --check, --list-vars, --output-dir or --restore")
+	})
+
+	t.Run("atomic-all requires in-place", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFlags([]string{"--no-config", "--atomic-all", "f"}, "1.0.0", "deadbeef")
+		require.Error(t, err)
+		assert.EqualError(t, err, "--atomic-all requires --in-place")
+
+		flags, err := ParseFlags([]string{"--no-config", "-i", "--atomic-all", "f"}, "1.0.0", "deadbeef")
+		require.NoError(t, err)
+		assert.True(t, flags.AtomicAll)
+	})
 }
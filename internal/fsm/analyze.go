@@ -0,0 +1,47 @@
+package fsm
+
+import "strings"
+
+// Ref describes one variable reference found while parsing.
+type Ref struct {
+	Name    string // variable name
+	Op      string // operator ("" for $VAR and ${VAR}, "#len" for ${#VAR})
+	Word    string // raw operator word, before nested expansion
+	Pos     Pos    // position of the '$' that opened the reference
+	Default bool   // whether the operator supplies a default (-, :-, =, :=)
+}
+
+// providesDefault reports whether op substitutes word when the variable is unset.
+func providesDefault(op string) bool {
+	switch op {
+	case "-", ":-", "=", ":=":
+		return true
+	}
+	return false
+}
+
+// visit reports a reference to Engine.Visit instead of resolving it.
+// Nested references inside word are reported as well; nothing is written.
+// For ${!REF...} the reported name is REF; ${!PREFIX*} references no variable.
+func (ctx *runCtx) visit(name, op string, word []byte) (stateFn, error) {
+	if isPrefixList(name, op, word) {
+		return stateText, nil
+	}
+	name = strings.TrimPrefix(name, "!")
+	if ctx.e.filter(name) {
+		ctx.e.Visit(Ref{
+			Name:    name,
+			Op:      op,
+			Word:    string(word),
+			Pos:     ctx.b.start,
+			Default: providesDefault(op),
+		})
+	}
+	if len(word) > 0 && !literalWord(op) {
+		ctx.e.wordAt = ctx.b.at
+		if _, err := ctx.e.expandBytes(word); err != nil {
+			return nil, err
+		}
+	}
+	return stateText, nil
+}
@@ -0,0 +1,93 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisit(t *testing.T) {
+	t.Parallel()
+	const label = "EngineLabel"
+
+	collect := func(t *testing.T, opts flag.Options, in string) ([]Ref, string) {
+		t.Helper()
+		var refs []Ref
+		e := &Engine{
+			Label:  label,
+			Opts:   opts,
+			Format: formatter.NewFormatter(false),
+			Lookup: func(string) (string, bool) { t.Fatal("lookup must not be called"); return "", false },
+			Visit:  func(r Ref) { refs = append(refs, r) },
+		}
+		out, err := runFSM(t, e, in)
+		require.NoError(t, err)
+		return refs, out
+	}
+
+	t.Run("reports all forms without resolving", func(t *testing.T) {
+		t.Parallel()
+		refs, out := collect(t, flag.Options{}, "$A ${B} ${#C} ${D:-x} ${E?boom}")
+		assert.Equal(t, "    ", out)
+		require.Len(t, refs, 5)
+		assert.Equal(t, Ref{Name: "A", Pos: Pos{Offset: 0, Line: 1, Col: 1}}, refs[0])
+		assert.Equal(t, Ref{Name: "B", Pos: Pos{Offset: 3, Line: 1, Col: 4}}, refs[1])
+		assert.Equal(t, "#len", refs[2].Op)
+		assert.Equal(t, Ref{Name: "D", Op: ":-", Word: "x", Pos: Pos{Offset: 14, Line: 1, Col: 15}, Default: true}, refs[3])
+		assert.Equal(t, "?", refs[4].Op)
+		assert.False(t, refs[4].Default)
+	})
+
+	t.Run("reports references nested in words", func(t *testing.T) {
+		t.Parallel()
+		refs, _ := collect(t, flag.Options{}, "x\n${A:-${B:=${C}}}")
+		require.Len(t, refs, 3)
+		assert.Equal(t, "A", refs[0].Name)
+		assert.Equal(t, "B", refs[1].Name)
+		assert.Equal(t, Pos{Offset: 7, Line: 2, Col: 6}, refs[1].Pos)
+		assert.True(t, refs[1].Default)
+		assert.Equal(t, "C", refs[2].Name)
+		assert.Equal(t, Pos{Offset: 12, Line: 2, Col: 11}, refs[2].Pos)
+	})
+
+	t.Run("indirect references report the referring name", func(t *testing.T) {
+		t.Parallel()
+		refs, _ := collect(t, flag.Options{}, "${!A} ${!B:-x} ${!APP_*}")
+		require.Len(t, refs, 2)
+		assert.Equal(t, "A", refs[0].Name)
+		assert.Equal(t, "B", refs[1].Name)
+		assert.Equal(t, ":-", refs[1].Op)
+	})
+
+	t.Run("regex words are not expanded", func(t *testing.T) {
+		t.Parallel()
+		refs, _ := collect(t, flag.Options{}, "${A~/(x)$/$1}")
+		require.Len(t, refs, 1)
+		assert.Equal(t, "A", refs[0].Name)
+	})
+
+	t.Run("honors filters", func(t *testing.T) {
+		t.Parallel()
+		refs, _ := collect(t, flag.Options{Prefix: []string{"APP_"}}, "$HOME ${APP_X:-$PATH} $APP_Y")
+		require.Len(t, refs, 2)
+		assert.Equal(t, "APP_X", refs[0].Name)
+		assert.Equal(t, "APP_Y", refs[1].Name)
+	})
+}
+
+func TestProvidesDefault(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default operators", func(t *testing.T) {
+		t.Parallel()
+		for _, op := range []string{"-", ":-", "=", ":="} {
+			assert.True(t, providesDefault(op), op)
+		}
+		for _, op := range []string{"", "+", ":+", "?", ":?", "#", "//", "#len"} {
+			assert.False(t, providesDefault(op), op)
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package fsm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/gi8lino/vex/internal/xerr"
+)
+
+// Template is a parsed input that can be rendered repeatedly without
+// re-tokenizing. It is safe for concurrent use when its lookup is.
+type Template struct {
+	eng   Engine // configuration captured at compile time
+	nodes []node
+}
+
+// node is either a literal text segment or a reference.
+type node struct {
+	text string   // literal output (when ref is nil)
+	ref  *refNode // reference to resolve at render time
+}
+
+// refNode is a compiled $VAR, ${VAR} or ${VAR<op>word}.
+type refNode struct {
+	v    VarRef     // variable and its rendering form
+	op   string     // operator ("" for plain references, "#len" for ${#VAR})
+	raw  []byte     // operator word as written
+	word []node     // compiled word; nil when raw needs no expansion
+	pos  Pos        // position of the '$' that opened the reference
+	lit  string     // reference as written (for diagnostics)
+	esc  escContext // where the value lands (--auto-escape)
+}
+
+// treeBuilder collects nodes while the FSM runs in compile mode.
+// Text written by the states lands in text and is cut into a node
+// whenever a reference is captured.
+type treeBuilder struct {
+	text  bytes.Buffer
+	nodes []node
+}
+
+// cut turns the pending text into a node.
+func (t *treeBuilder) cut(w *bufio.Writer) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if t.text.Len() > 0 {
+		t.nodes = append(t.nodes, node{text: t.text.String()})
+		t.text.Reset()
+	}
+	return nil
+}
+
+// capturing reports whether references are captured instead of resolved.
+func (e *Engine) capturing() bool {
+	return e.tree != nil || e.Visit != nil
+}
+
+// capture hands a parsed reference to the tree builder (Compile) or to Visit.
+func (ctx *runCtx) capture(v VarRef, op string, word []byte) (stateFn, error) {
+	if ctx.e.tree == nil {
+		return ctx.visit(v.Name, op, word)
+	}
+	tree := ctx.e.tree
+	if err := tree.cut(ctx.w); err != nil {
+		return nil, err
+	}
+
+	r := &refNode{v: v, op: op, pos: ctx.b.start}
+	if ctx.esc != nil {
+		r.esc = ctx.esc.context()
+		ctx.esc.value()
+	}
+	switch op {
+	case "":
+		r.lit = v.Lit()
+	case "#len":
+		r.lit = "${#" + v.Name + "}"
+	default:
+		r.lit = "${" + v.Name + op + string(word) + "}"
+	}
+	if word != nil {
+		r.raw = bytes.Clone(word) // word is pooled
+		if bytes.IndexByte(word, '$') >= 0 && !literalWord(op) {
+			tok := smallTokPool.Get().(*Tokenizer)
+			tok.noEscape = ctx.e.Opts.NoEscape
+			tok.resetAt(bytes.NewReader(r.raw), ctx.b.at)
+			nodes, err := ctx.e.compileWith(tok, nil)
+			smallTokPool.Put(tok)
+			if err != nil {
+				return nil, err
+			}
+			r.word = nodes
+		}
+	}
+	tree.nodes = append(tree.nodes, node{ref: r})
+	return stateText, nil
+}
+
+// Compile parses r into a Template. Syntax problems that would fail a
+// streaming run (e.g. an unterminated ${ under --strict) fail here;
+// everything that depends on variable values is deferred to Execute.
+func (e *Engine) Compile(r io.Reader) (*Template, error) {
+	e.matcher() // compiled once, shared by every Execute
+	tok := NewTokenizerWithSize(r, e.Opts.NoEscape, 1<<20)
+	nodes, err := e.compileWith(tok, e.escaper())
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{eng: *e, nodes: nodes}
+	t.eng.tree, t.eng.Visit = nil, nil
+	return t, nil
+}
+
+// compileWith runs the FSM over tok in compile mode and returns the nodes.
+// esc tracks the output context (nil for nested words).
+func (e *Engine) compileWith(tok *Tokenizer, esc *escaper) ([]node, error) {
+	c := *e
+	c.tree = &treeBuilder{}
+	w := bufio.NewWriter(&c.tree.text)
+	if err := c.consumeWithTokenizer(tok, w, esc); err != nil {
+		return nil, err
+	}
+	if err := c.tree.cut(w); err != nil {
+		return nil, err
+	}
+	return c.tree.nodes, nil
+}
+
+// Execute renders the template to w, resolving variables with lookup
+// (or the compiling engine's Resolve or Lookup when nil). A lookup cannot
+// enumerate its names, so under a custom lookup ${!PREFIX*} lists none.
+func (t *Template) Execute(lookup func(string) (string, bool), w io.Writer) error {
+	e := t.eng
+	e.regexps = nil // per-run cache; never shared between executions
+	if lookup != nil {
+		e.Lookup, e.Resolve, e.Names = lookup, nil, nil
+	}
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriter(w)
+	}
+	if err := e.render(bw, t.nodes); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// render writes nodes to w.
+func (e *Engine) render(w *bufio.Writer, nodes []node) error {
+	for i := range nodes {
+		n := &nodes[i]
+		if n.ref == nil {
+			if _, err := w.WriteString(n.text); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := e.renderRef(w, n.ref); err != nil {
+			if err = e.failRef(w, n.ref, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderRef resolves a single reference, mirroring the streaming states.
+func (e *Engine) renderRef(w *bufio.Writer, r *refNode) error {
+	if r.op == "" {
+		if r.esc.f != EscapeNone {
+			return e.expandEscaped(w, r.v, r.esc)
+		}
+		return e.expandSimple(w, r.v)
+	}
+	if !isPrefixList(r.v.Name, r.op, r.raw) {
+		if ok, err := e.permits(r.v.Name); err != nil || !ok {
+			if err == nil {
+				_, err = w.WriteString(e.Format.FilterStr(r.lit))
+			}
+			return err
+		}
+	}
+	word := string(r.raw)
+	if r.word != nil {
+		b := bufPool.Get().(*bytes.Buffer)
+		b.Reset()
+		bw := bufio.NewWriter(b)
+		err := e.render(bw, r.word)
+		if err == nil {
+			err = bw.Flush()
+		}
+		word = b.String()
+		bufPool.Put(b)
+		if err != nil {
+			return err
+		}
+	}
+	val, err := e.applyOp(r.v.Name, r.op, r.raw, word)
+	if err != nil {
+		return err
+	}
+	return writeEscaped(w, r.esc, val, r.lit)
+}
+
+// failRef is the render-time counterpart of runCtx.fail: the error is
+// positioned and either returned or recorded with r emitted literally.
+func (e *Engine) failRef(w *bufio.Writer, r *refNode, err error) error {
+	if !xerr.IsExpansion(err) {
+		return err
+	}
+	err = xerr.At(e.Label, r.pos.Line, r.pos.Col, r.lit, err)
+	if e.Errs == nil {
+		return err
+	}
+	e.Errs.Add(err)
+	_, werr := w.WriteString(e.Format.ErrorStr(r.lit))
+	return werr
+}
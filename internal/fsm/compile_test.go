@@ -0,0 +1,161 @@
+package fsm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// execString compiles in with e and renders it against lookup.
+func execString(t *testing.T, e *Engine, in string, lookup func(string) (string, bool)) (string, error) {
+	t.Helper()
+	tpl, err := e.Compile(strings.NewReader(in))
+	require.NoError(t, err)
+	var out bytes.Buffer
+	err = tpl.Execute(lookup, &out)
+	return out.String(), err
+}
+
+func TestTemplate(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"A": "alpha", "B": "bee", "E": "", "P": "/usr/local/bin", "N": "B"}
+	lookup := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+
+	t.Run("prefix lists follow the lookup", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Format: formatter.NewFormatter(false),
+			Lookup: lookup,
+			Names:  func() []string { return []string{"A", "AB"} },
+		}
+		got, err := execString(t, e, "[${!A*}]", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "[A AB]", got, "the compiling engine's names")
+
+		got, err = execString(t, e, "[${!A*}] ${!N}", func(k string) (string, bool) { v, ok := env[k]; return v, ok })
+		require.NoError(t, err)
+		assert.Equal(t, "[] bee", got, "a custom lookup lists no names")
+	})
+
+	t.Run("name filter is compiled once", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{Format: formatter.NewFormatter(false), Opts: flag.Options{Prefix: []string{"A"}}}
+		tpl, err := e.Compile(strings.NewReader("$A $B"))
+		require.NoError(t, err)
+		require.NotNil(t, tpl.eng.Match)
+		m := tpl.eng.Match
+
+		var out bytes.Buffer
+		require.NoError(t, tpl.Execute(lookup, &out))
+		assert.Equal(t, "alpha $B", out.String())
+		assert.Same(t, m, tpl.eng.Match)
+	})
+
+	t.Run("matches streaming output", func(t *testing.T) {
+		t.Parallel()
+		inputs := []string{
+			"",
+			"plain text",
+			"$A and ${B}",
+			"${#A} ${A^^} ${A:1:3} ${A/a/A} ${A//a/A}",
+			"${U:-def} ${U-x} ${E:-empty} ${E-set} ${A:+alt} ${U+alt}",
+			"${U:-${A}-${B:-x}} ${U:-${V:-${B}}}",
+			"${P##*/} ${P%/*}",
+			`\$A $ $1 ${A`,
+			"${A@Q} ${A@Z} ${}",
+			"${A@B@J} ${P@U} ${P@R} ${A@Q@Z}",
+			"line1\n  $A\n${B}\n",
+			"${!N} ${!N:-x} ${!U:-y}",
+			"${P~/^.*\\/(.*)$/$1} ${A~/(a)/[$1]/g}",
+		}
+		for _, in := range inputs {
+			e := &Engine{Lookup: lookup, Format: formatter.NewFormatter(false)}
+			want, err := runFSM(t, e, in)
+			require.NoError(t, err)
+			got, err := execString(t, e, in, nil)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, "input %q", in)
+		}
+	})
+
+	t.Run("renders against different lookups", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{Format: formatter.NewFormatter(false)}
+		tpl, err := e.Compile(strings.NewReader("host=${HOST:-localhost}:$PORT"))
+		require.NoError(t, err)
+
+		for _, tc := range []struct {
+			env  map[string]string
+			want string
+		}{
+			{map[string]string{"PORT": "80"}, "host=localhost:80"},
+			{map[string]string{"HOST": "db", "PORT": "5432"}, "host=db:5432"},
+		} {
+			var out bytes.Buffer
+			err := tpl.Execute(func(k string) (string, bool) { v, ok := tc.env[k]; return v, ok }, &out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, out.String())
+		}
+	})
+
+	t.Run("errors carry positions", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{Label: "tpl", Format: formatter.NewFormatter(false)}
+		_, err := execString(t, e, "ok\n  ${X:?boom}", lookup)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, xerr.ErrUser))
+		assert.EqualError(t, err, "tpl:2:3: X: boom")
+	})
+
+	t.Run("nested word errors keep their own position", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{Label: "tpl", Format: formatter.NewFormatter(false)}
+		_, err := execString(t, e, "${U:-x${Y:?deep}}", lookup)
+		require.Error(t, err)
+		assert.EqualError(t, err, "tpl:1:7: Y: deep")
+	})
+
+	t.Run("errors are collected and rendering continues", func(t *testing.T) {
+		t.Parallel()
+		errs := &xerr.List{}
+		e := &Engine{
+			Label:  "tpl",
+			Opts:   flag.Options{ErrorUnset: true},
+			Format: formatter.NewFormatter(false),
+			Errs:   errs,
+		}
+		got, err := execString(t, e, "$X-$A-${Y}", lookup)
+		require.NoError(t, err)
+		assert.Equal(t, "$X-alpha-${Y}", got)
+		assert.Equal(t, 2, errs.Len())
+	})
+
+	t.Run("unterminated reference fails compile under strict", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{Label: "tpl", Opts: flag.Options{Strict: true}, Format: formatter.NewFormatter(false)}
+		_, err := e.Compile(strings.NewReader("a ${B"))
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, xerr.ErrUnterminated))
+	})
+
+	t.Run("assignments call setenv", func(t *testing.T) {
+		t.Parallel()
+		var set []string
+		e := &Engine{
+			Format: formatter.NewFormatter(false),
+			Setenv: func(k, v string) error { set = append(set, k+"="+v); return nil },
+		}
+		got, err := execString(t, e, "${U:=${B}}", lookup)
+		require.NoError(t, err)
+		assert.Equal(t, "bee", got)
+		assert.Equal(t, []string{"U=bee"}, set)
+	})
+}
@@ -0,0 +1,597 @@
+package fsm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/xerr"
+)
+
+// EscapeFormat selects how --auto-escape escapes resolved values.
+type EscapeFormat uint8
+
+const (
+	EscapeNone  EscapeFormat = iota // EscapeNone writes values unchanged.
+	EscapeYAML                      // EscapeYAML escapes for YAML scalars.
+	EscapeJSON                      // EscapeJSON escapes for JSON strings.
+	EscapeXML                       // EscapeXML escapes for XML text and attributes.
+	EscapeShell                     // EscapeShell quotes for POSIX shell.
+	EscapeTOML                      // EscapeTOML escapes for TOML strings.
+	EscapeEnv                       // EscapeEnv quotes for dotenv files.
+)
+
+// EscapeFormats lists the names accepted by ParseEscapeFormat.
+var EscapeFormats = []string{"yaml", "json", "xml", "shell", "toml", "env"}
+
+// String returns the format name as accepted by ParseEscapeFormat.
+func (f EscapeFormat) String() string {
+	if f == EscapeNone || int(f) > len(EscapeFormats) {
+		return "none"
+	}
+	return EscapeFormats[f-1]
+}
+
+// ParseEscapeFormat returns the format named s (see EscapeFormats).
+func ParseEscapeFormat(s string) (EscapeFormat, error) {
+	for i, name := range EscapeFormats {
+		if strings.EqualFold(s, name) {
+			return EscapeFormat(i + 1), nil
+		}
+	}
+	return EscapeNone, fmt.Errorf("unknown format %q (want one of %s)", s, strings.Join(EscapeFormats, ", "))
+}
+
+// escapeExts maps file extensions to formats.
+var escapeExts = map[string]EscapeFormat{
+	".yaml": EscapeYAML, ".yml": EscapeYAML,
+	".json": EscapeJSON,
+	".xml":  EscapeXML, ".html": EscapeXML, ".htm": EscapeXML, ".xhtml": EscapeXML, ".svg": EscapeXML,
+	".sh": EscapeShell, ".bash": EscapeShell, ".zsh": EscapeShell, ".ksh": EscapeShell,
+	".toml": EscapeTOML,
+	".env":  EscapeEnv,
+}
+
+// templateExts are suffixes stripped before looking at the real extension
+// (config.yaml.tmpl is YAML).
+var templateExts = []string{".tmpl", ".tpl", ".template", ".in"}
+
+// EscapeFormatFor picks the format from path's extension; unknown
+// extensions yield EscapeNone. Dotenv files are also recognized by name
+// (.env, .env.local).
+func EscapeFormatFor(path string) EscapeFormat {
+	base := strings.ToLower(filepath.Base(path))
+	for _, ext := range templateExts {
+		if trimmed, ok := strings.CutSuffix(base, ext); ok && trimmed != "" {
+			base = trimmed
+			break
+		}
+	}
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return EscapeEnv
+	}
+	return escapeExts[filepath.Ext(base)]
+}
+
+// escState is the lexical position inside the output.
+type escState uint8
+
+const (
+	escRaw         escState = iota // unquoted (XML: element text)
+	escDouble                      // "..."
+	escSingle                      // '...'
+	escComment                     // comment up to end of line (XML: <!-- -->)
+	escTag                         // XML: inside <...>, outside attribute values
+	escCDATA                       // XML: <![CDATA[ ... ]]>
+	escMultiDouble                 // TOML: """..."""
+	escMultiSingle                 // TOML: '''...'''
+	escBlock                       // YAML: block scalar (| or >)
+)
+
+// escContext is where a value lands: the format, the lexical state,
+// whether it continues a word and, for YAML block scalars, the
+// indentation of the current line.
+type escContext struct {
+	f      EscapeFormat
+	st     escState
+	mid    bool
+	indent int
+}
+
+// escaper tracks the lexical context of literal output as it is written
+// (see Tokenizer.watch), so resolved values can be escaped for the exact
+// position they land in.
+type escaper struct {
+	f       EscapeFormat
+	st      escState
+	esc     bool    // previous byte was a backslash escape
+	prev    byte    // previous byte (0 at start of input)
+	tail    [9]byte // most recent bytes, for multi-byte delimiters
+	pending byte    // quote of an empty string just closed ("" or ''), for TOML triple quotes
+	run     int     // consecutive closing quotes in a TOML multi-line string
+	content bool    // current quoted string has content (TOML)
+
+	// line tracking (YAML)
+	indent   int          // leading spaces of the current line
+	inIndent bool         // still reading the current line's leading spaces
+	line     bytes.Buffer // current line outside comments, for block indicators
+	block    int          // indentation of the line that opened a block scalar
+}
+
+// newEscaper returns a tracker for f positioned at the start of a file.
+func newEscaper(f EscapeFormat) *escaper {
+	return &escaper{f: f, inIndent: true}
+}
+
+// context returns the current position for escaping a value.
+func (s *escaper) context() escContext {
+	if s.st == escBlock && s.inIndent && s.indent <= s.block {
+		s.st = escRaw // a reference starting a less indented line ends the block
+	}
+	return escContext{f: s.f, st: s.st, mid: !s.wordStart("[{,"), indent: s.indent}
+}
+
+// value records that a value was written at the current position.
+// It behaves like a word character for delimiter and comment detection.
+func (s *escaper) value() {
+	s.esc, s.pending, s.run = false, 0, 0
+	s.prev = 'x'
+	s.push('x')
+	s.content = true
+	s.inIndent = false
+	if s.f == EscapeYAML && s.st == escRaw {
+		s.line.WriteByte('x')
+	}
+}
+
+// feed advances the tracker over literal output.
+func (s *escaper) feed(p []byte) {
+	for _, c := range p {
+		s.push(c)
+		s.step(c)
+		s.prev = c
+	}
+}
+
+// feedString is feed for strings.
+func (s *escaper) feedString(p string) {
+	for i := 0; i < len(p); i++ {
+		s.push(p[i])
+		s.step(p[i])
+		s.prev = p[i]
+	}
+}
+
+// push appends c to tail.
+func (s *escaper) push(c byte) {
+	copy(s.tail[:], s.tail[1:])
+	s.tail[len(s.tail)-1] = c
+}
+
+// ends reports whether the most recent bytes are delim.
+func (s *escaper) ends(delim string) bool {
+	return bytes.HasSuffix(s.tail[:], []byte(delim))
+}
+
+// step dispatches c to the format's state machine.
+func (s *escaper) step(c byte) {
+	switch s.f {
+	case EscapeJSON:
+		s.stepJSON(c)
+	case EscapeYAML:
+		s.stepYAML(c)
+	case EscapeXML:
+		s.stepXML(c)
+	case EscapeShell, EscapeEnv:
+		s.stepShell(c)
+	case EscapeTOML:
+		s.stepTOML(c)
+	}
+}
+
+// quoted handles the body of a backslash-escaping string closed by q,
+// returning to next when it ends.
+func (s *escaper) quoted(c, q byte, next escState) {
+	switch {
+	case s.esc:
+		s.esc = false
+	case c == '\\':
+		s.esc = true
+	case c == q:
+		s.st = next
+	}
+}
+
+func (s *escaper) stepJSON(c byte) {
+	if s.st == escDouble {
+		s.quoted(c, '"', escRaw)
+		return
+	}
+	if c == '"' {
+		s.st = escDouble
+	}
+}
+
+// wordStart reports whether the previous byte ends a word (YAML and shell
+// only open quotes and comments there).
+func (s *escaper) wordStart(extra string) bool {
+	return s.prev == 0 || s.prev == ' ' || s.prev == '\t' || s.prev == '\n' || strings.IndexByte(extra, s.prev) >= 0
+}
+
+func (s *escaper) stepYAML(c byte) {
+	first := s.inIndent && c != ' ' && c != '\n' // first byte of the line's content
+	if c == '\n' {
+		defer s.newline()
+	} else if s.inIndent {
+		if c == ' ' {
+			s.indent++
+		} else {
+			s.inIndent = false
+		}
+	}
+
+	switch s.st {
+	case escBlock:
+		// A line indented no deeper than the block header ends the block.
+		if first && s.indent <= s.block {
+			s.st = escRaw
+			s.stepYAMLRaw(c)
+		}
+	case escDouble:
+		s.quoted(c, '"', escRaw)
+	case escSingle:
+		if c == '\'' {
+			s.st = escRaw
+			s.pending = '\''
+		}
+	case escComment:
+		if c == '\n' {
+			s.st = escRaw
+		}
+	default:
+		s.stepYAMLRaw(c)
+	}
+}
+
+func (s *escaper) stepYAMLRaw(c byte) {
+	if s.pending == '\'' {
+		s.pending = 0
+		if c == '\'' { // '' inside a single-quoted scalar
+			s.st = escSingle
+			return
+		}
+	}
+	switch {
+	case c == '"' && s.wordStart("[{,"):
+		s.st = escDouble
+	case c == '\'' && s.wordStart("[{,"):
+		s.st = escSingle
+	case c == '#' && s.wordStart(""):
+		s.st = escComment
+	case c != '\n':
+		s.line.WriteByte(c)
+	}
+}
+
+// newline finishes a YAML line, entering a block scalar when the line
+// ended with a | or > indicator.
+func (s *escaper) newline() {
+	if s.st == escRaw && isBlockIndicator(s.line.Bytes()) {
+		s.st, s.block = escBlock, s.indent
+	}
+	s.line.Reset()
+	s.indent, s.inIndent = 0, true
+}
+
+// isBlockIndicator reports whether line ends with a block scalar header
+// such as "key: |", "- >-" or "key: |2+".
+func isBlockIndicator(line []byte) bool {
+	line = bytes.TrimRight(line, " \t")
+	i := len(line)
+	for i > 0 && (line[i-1] == '-' || line[i-1] == '+' || isDigit(line[i-1])) {
+		i--
+	}
+	if i == 0 || (line[i-1] != '|' && line[i-1] != '>') {
+		return false
+	}
+	return i == 1 || line[i-2] == ' ' || line[i-2] == ':' || line[i-2] == '-'
+}
+
+func (s *escaper) stepXML(c byte) {
+	switch s.st {
+	case escRaw:
+		if c == '<' {
+			s.st = escTag
+		}
+	case escTag:
+		switch {
+		case s.ends("<!--"):
+			s.st = escComment
+		case s.ends("<![CDATA["):
+			s.st = escCDATA
+		case c == '"':
+			s.st = escDouble
+		case c == '\'':
+			s.st = escSingle
+		case c == '>':
+			s.st = escRaw
+		}
+	case escDouble:
+		if c == '"' {
+			s.st = escTag
+		}
+	case escSingle:
+		if c == '\'' {
+			s.st = escTag
+		}
+	case escComment:
+		if s.ends("-->") {
+			s.st = escRaw
+		}
+	case escCDATA:
+		if s.ends("]]>") {
+			s.st = escRaw
+		}
+	}
+}
+
+func (s *escaper) stepShell(c byte) {
+	switch s.st {
+	case escDouble:
+		s.quoted(c, '"', escRaw)
+	case escSingle:
+		if c == '\'' {
+			s.st = escRaw
+		}
+	case escComment:
+		if c == '\n' {
+			s.st = escRaw
+		}
+	default:
+		switch {
+		case s.esc:
+			s.esc = false
+		case c == '\\':
+			s.esc = true
+		case c == '\'':
+			s.st = escSingle
+		case c == '"':
+			s.st = escDouble
+		case c == '#' && s.wordStart(";&|("):
+			s.st = escComment
+		}
+	}
+}
+
+func (s *escaper) stepTOML(c byte) {
+	switch s.st {
+	case escDouble:
+		if !s.esc && c == '"' && !s.content {
+			s.st, s.pending = escRaw, '"'
+			return
+		}
+		s.content = true
+		s.quoted(c, '"', escRaw)
+	case escSingle:
+		if c == '\'' {
+			s.st = escRaw
+			if !s.content {
+				s.pending = '\''
+			}
+			return
+		}
+		s.content = true
+	case escMultiDouble, escMultiSingle:
+		q := byte('"')
+		if s.st == escMultiSingle {
+			q = '\''
+		}
+		switch {
+		case s.esc:
+			s.esc = false
+		case c == '\\' && q == '"':
+			s.esc = true
+		case c == q:
+			s.run++
+			if s.run == 3 {
+				s.st, s.run = escRaw, 0
+			}
+			return
+		}
+		s.run = 0
+	case escComment:
+		if c == '\n' {
+			s.st = escRaw
+		}
+	default:
+		pending := s.pending
+		s.pending = 0
+		switch {
+		case c == '"' && pending == '"':
+			s.st, s.run = escMultiDouble, 0
+		case c == '\'' && pending == '\'':
+			s.st, s.run = escMultiSingle, 0
+		case c == '"':
+			s.st, s.content = escDouble, false
+		case c == '\'':
+			s.st, s.content = escSingle, false
+		case c == '#':
+			s.st = escComment
+		}
+	}
+}
+
+// escape returns val escaped for the context. Outside of quotes, JSON
+// scalars and safe YAML plain scalars are left as-is so numbers and
+// booleans keep their type, other JSON and YAML values are quoted; shell
+// and dotenv values are quoted when needed.
+func (c escContext) escape(val string) (string, error) {
+	switch c.f {
+	case EscapeJSON:
+		switch c.st {
+		case escRaw:
+			if !isJSONScalar(val) {
+				return jsonQuote(val), nil
+			}
+		case escDouble:
+			return unquote(jsonQuote(val)), nil
+		}
+	case EscapeYAML:
+		switch c.st {
+		case escRaw:
+			if isYAMLPlain(val) {
+				return val, nil
+			}
+			if c.mid {
+				return "", xerr.Invalid("value cannot be placed inside a YAML plain scalar; quote the reference")
+			}
+			return jsonQuote(val), nil // a JSON string is a YAML double-quoted scalar
+		case escDouble:
+			return unquote(jsonQuote(val)), nil
+		case escSingle:
+			// a single line break folds to a space; an empty line keeps it
+			pad := "\n\n" + strings.Repeat(" ", c.indent+2)
+			return strings.ReplaceAll(strings.ReplaceAll(val, "'", "''"), "\n", pad), nil
+		case escBlock:
+			return strings.ReplaceAll(val, "\n", "\n"+strings.Repeat(" ", c.indent)), nil
+		}
+	case EscapeXML:
+		switch c.st {
+		case escRaw:
+			return html.EscapeString(val), nil
+		case escDouble, escSingle:
+			// attribute values normalize raw whitespace to spaces
+			return xmlAttrEscape.Replace(html.EscapeString(val)), nil
+		case escCDATA:
+			return strings.ReplaceAll(val, "]]>", "]]]]><![CDATA[>"), nil
+		}
+	case EscapeShell:
+		switch c.st {
+		case escRaw:
+			if isShellSafe(val) {
+				return val, nil
+			}
+			return shellQuote(val), nil
+		case escSingle:
+			return strings.ReplaceAll(val, "'", `'\''`), nil
+		case escDouble:
+			return shellDoubleEscape.Replace(val), nil
+		}
+	case EscapeEnv:
+		switch c.st {
+		case escRaw:
+			if isShellSafe(val) {
+				return val, nil
+			}
+			return `"` + envDoubleEscape.Replace(val) + `"`, nil
+		case escDouble:
+			return envDoubleEscape.Replace(val), nil
+		case escSingle:
+			if strings.Contains(val, "'") {
+				return "", xerr.Invalid("value contains ' and cannot be placed in a single-quoted dotenv value")
+			}
+		}
+	case EscapeTOML:
+		switch c.st {
+		case escDouble, escMultiDouble:
+			return unquote(tomlQuote(val)), nil
+		case escSingle:
+			if strings.ContainsAny(val, "'\n\r") {
+				return "", xerr.Invalid("value contains a quote or line break and cannot be placed in a TOML literal string")
+			}
+		case escMultiSingle:
+			if strings.Contains(val, "'''") {
+				return "", xerr.Invalid("value contains ''' and cannot be placed in a TOML multi-line literal string")
+			}
+		}
+	}
+	return val, nil
+}
+
+// unquote strips the quotes added by jsonQuote or tomlQuote.
+func unquote(s string) string {
+	return s[1 : len(s)-1]
+}
+
+// isJSONScalar reports whether s is a JSON number, boolean or null.
+func isJSONScalar(s string) bool {
+	switch s {
+	case "true", "false", "null":
+		return true
+	}
+	return jsonNumber.MatchString(s)
+}
+
+// jsonNumber matches the JSON number grammar.
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// isYAMLPlain reports whether s reads back unchanged as a YAML plain
+// scalar in block and flow context: it has no line breaks, no leading
+// indicator and no ": ", " #" or flow characters.
+func isYAMLPlain(s string) bool {
+	if s == "" || s != strings.TrimSpace(s) {
+		return false
+	}
+	if strings.IndexByte("?:,[]{}#&*!|>'\"%@`", s[0]) >= 0 ||
+		s[0] == '-' && (len(s) == 1 || s[1] == ' ') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c == 0x7f || strings.IndexByte(",[]{}", c) >= 0 {
+			return false
+		}
+	}
+	return !strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.HasSuffix(s, ":")
+}
+
+// isShellSafe reports whether s needs no quoting in shell and dotenv files.
+func isShellSafe(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isNameCont(c) && strings.IndexByte("./:=@%+,-", c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	shellDoubleEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	envDoubleEscape   = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+	xmlAttrEscape     = strings.NewReplacer("\n", "&#10;", "\r", "&#13;", "\t", "&#9;")
+)
+
+// writeEscaped writes val escaped for c. A value equal to lit is a
+// reference kept literally (--keep-unset and friends) and is written as-is.
+func writeEscaped(w *bufio.Writer, c escContext, val, lit string) error {
+	if c.f != EscapeNone && val != lit {
+		var err error
+		if val, err = c.escape(val); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString(val)
+	return err
+}
+
+// expandEscaped is expandSimple with the value escaped for c.
+func (e *Engine) expandEscaped(w *bufio.Writer, v VarRef, c escContext) error {
+	b := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(b)
+	b.Reset()
+	bw := bufio.NewWriter(b)
+	if err := e.expandSimple(bw, v); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return writeEscaped(w, c, b.String(), v.Lit())
+}
@@ -0,0 +1,341 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeFormat(t *testing.T) {
+	t.Parallel()
+
+	t.Run("parses names case-insensitively", func(t *testing.T) {
+		t.Parallel()
+		for _, name := range EscapeFormats {
+			f, err := ParseEscapeFormat(name)
+			require.NoError(t, err)
+			assert.Equal(t, name, f.String())
+		}
+		f, err := ParseEscapeFormat("YAML")
+		require.NoError(t, err)
+		assert.Equal(t, EscapeYAML, f)
+	})
+
+	t.Run("rejects unknown names", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseEscapeFormat("ini")
+		assert.EqualError(t, err, `unknown format "ini" (want one of yaml, json, xml, shell, toml, env)`)
+	})
+
+	t.Run("picks the format from the path", func(t *testing.T) {
+		t.Parallel()
+		for path, want := range map[string]EscapeFormat{
+			"deploy/values.yaml":    EscapeYAML,
+			"app.YML":               EscapeYAML,
+			"config.json.tmpl":      EscapeJSON,
+			"pom.xml":               EscapeXML,
+			"index.html.tpl":        EscapeXML,
+			"start.sh":              EscapeShell,
+			"Cargo.toml":            EscapeTOML,
+			"prod.env":              EscapeEnv,
+			".env":                  EscapeEnv,
+			".env.local":            EscapeEnv,
+			"README.md":             EscapeNone,
+			"<stdin>":               EscapeNone,
+			"config.in":             EscapeNone,
+			"nginx.conf.template":   EscapeNone,
+			"settings.toml.in":      EscapeTOML,
+			"dir.yaml/notes.txt":    EscapeNone,
+			"docker-compose.yml.in": EscapeYAML,
+		} {
+			assert.Equal(t, want, EscapeFormatFor(path), path)
+		}
+	})
+}
+
+func TestEngineFSMAutoEscape(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"V": `a"b'c` + "\n<d>&$`",
+		"N": "5",
+		"S": "plain-value",
+		"M": "line1\nline2",
+		"W": "x\r\ny\tz",
+		"K": "x\nother: 2",
+		"I": `1, "inj": true`,
+		"T": "true",
+		"E": "",
+	}
+	engine := func(f EscapeFormat) *Engine {
+		return &Engine{
+			Label:  "tpl",
+			Escape: f,
+			Format: formatter.NewFormatter(false),
+			Lookup: func(k string) (string, bool) { v, ok := env[k]; return v, ok },
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		f    EscapeFormat
+		in   string
+		want string
+	}{
+		{
+			name: "json strings are escaped, bare values are not",
+			f:    EscapeJSON,
+			in:   `{"v": "${V}", "n": $N, "k\"${S}": "x"}`,
+			want: `{"v": "a\"b'c\n<d>&$` + "`" + `", "n": 5, "k\"plain-value": "x"}`,
+		},
+		{
+			name: "json values outside strings become strings unless scalars",
+			f:    EscapeJSON,
+			in:   `{"n": $N, "i": $I, "b": $T, "s": $S, "e": $E}`,
+			want: `{"n": 5, "i": "1, \"inj\": true", "b": true, "s": "plain-value", "e": ""}`,
+		},
+		{
+			name: "yaml plain scalars are quoted unless safe",
+			f:    EscapeYAML,
+			in:   "key: $K\nn: $N\ns: $S\nl: [$I]\ne: $E\nm: -$N\n",
+			want: "key: \"x\\nother: 2\"\nn: 5\ns: plain-value\nl: [\"1, \\\"inj\\\": true\"]\ne: \"\"\nm: -5\n",
+		},
+		{
+			name: "yaml quoted scalars",
+			f:    EscapeYAML,
+			in:   "a: \"${V}\"\nb: '${M}'\nc: $N\nd: it's $S\n",
+			want: "a: \"a\\\"b'c\\n<d>&$`\"\nb: 'line1\n\n  line2'\nc: 5\nd: it's plain-value\n",
+		},
+		{
+			name: "yaml doubles single quotes",
+			f:    EscapeYAML,
+			in:   "- '${V}'",
+			want: "- 'a\"b''c\n\n  <d>&$`'",
+		},
+		{
+			name: "yaml comments do not open quotes",
+			f:    EscapeYAML,
+			in:   "# don't\nk: \"$M\" # it's\n",
+			want: "# don't\nk: \"line1\\nline2\" # it's\n",
+		},
+		{
+			name: "yaml block scalars are re-indented",
+			f:    EscapeYAML,
+			in:   "data:\n  script: |-\n    $M\n    ${M}\n  next: \"$M\"\n",
+			want: "data:\n  script: |-\n    line1\n    line2\n    line1\n    line2\n  next: \"line1\\nline2\"\n",
+		},
+		{
+			name: "xml text, attributes, comments and cdata",
+			f:    EscapeXML,
+			in:   `<a t="$V" u='$V'>$V<!-- "$S" --><![CDATA[${C:-]]>}]]></a>`,
+			want: `<a t="a&#34;b&#39;c&#10;&lt;d&gt;&amp;$` + "`" + `" u='a&#34;b&#39;c&#10;&lt;d&gt;&amp;$` + "`" + `'>a&#34;b&#39;c` + "\n" + `&lt;d&gt;&amp;$` + "`" + `<!-- "plain-value" --><![CDATA[]]]]><![CDATA[>]]></a>`,
+		},
+		{
+			name: "xml attributes keep line breaks and tabs",
+			f:    EscapeXML,
+			in:   `<a t="$W">$W</a>`,
+			want: "<a t=\"x&#13;&#10;y&#9;z\">x\r\ny\tz</a>",
+		},
+		{
+			name: "shell quoting by context",
+			f:    EscapeShell,
+			in:   `echo $S $V "$V" '$V' # '$S`,
+			want: `echo plain-value 'a"b'"'"'c` + "\n" + `<d>&$` + "`' \"a\\\"b'c\n<d>&\\$\\`\" 'a\"b'\\''c\n<d>&$`' # 'plain-value",
+		},
+		{
+			name: "shell escaped quotes stay unquoted",
+			f:    EscapeShell,
+			in:   `echo \'$S`,
+			want: `echo \'plain-value`,
+		},
+		{
+			name: "toml strings",
+			f:    EscapeTOML,
+			in:   "a = \"$V\"\nb = '$S'\nc = \"\"\"$M\"\"\"\nd = $N # \"$N\n",
+			want: "a = \"a\\\"b'c\\n<d>&$`\"\nb = 'plain-value'\nc = \"\"\"line1\\nline2\"\"\"\nd = 5 # \"5\n",
+		},
+		{
+			name: "toml empty strings are not triple quotes",
+			f:    EscapeTOML,
+			in:   "a = \"\"\nb = \"$M\"",
+			want: "a = \"\"\nb = \"line1\\nline2\"",
+		},
+		{
+			name: "dotenv values",
+			f:    EscapeEnv,
+			in:   "A=$S\nB=$M\nC=\"$V\"\n",
+			want: "A=plain-value\nB=\"line1\\nline2\"\nC=\"a\\\"b'c\\n<d>&\\$`\"\n",
+		},
+		{
+			name: "operators and nested words are escaped once",
+			f:    EscapeJSON,
+			in:   `"${U:-${V}}" "${#V}" "${V@J}"`,
+			want: `"a\"b'c\n<d>&$` + "`" + `" "12" "\"a\\\"b'c\\n<d>&$` + "`" + `\""`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := runFSM(t, engine(tc.f), tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+
+			// compiled templates escape the same way
+			got, err = execString(t, engine(tc.f), tc.in, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("kept references are not escaped", func(t *testing.T) {
+		t.Parallel()
+		e := engine(EscapeShell)
+		e.Opts = flag.Options{KeepUnset: true}
+		got, err := runFSM(t, e, `echo ${X} "${Y:-}" $X`)
+		require.NoError(t, err)
+		assert.Equal(t, `echo ${X} "" $X`, got)
+	})
+
+	t.Run("unrepresentable values are positioned errors", func(t *testing.T) {
+		t.Parallel()
+		_, err := runFSM(t, engine(EscapeTOML), "ok = 1\nb = '$V'")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, xerr.ErrInvalid)
+		assert.EqualError(t, err, "tpl:2:6: invalid value: value contains a quote or line break and cannot be placed in a TOML literal string")
+	})
+
+	t.Run("yaml values continuing a plain scalar must be safe", func(t *testing.T) {
+		t.Parallel()
+		_, err := runFSM(t, engine(EscapeYAML), "k: id-$K")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, xerr.ErrInvalid)
+		assert.EqualError(t, err, "tpl:1:7: invalid value: value cannot be placed inside a YAML plain scalar; quote the reference")
+
+		got, err := runFSM(t, engine(EscapeYAML), "k: id-$S")
+		require.NoError(t, err)
+		assert.Equal(t, "k: id-plain-value", got)
+	})
+
+	t.Run("unrepresentable values are collected under report-all", func(t *testing.T) {
+		t.Parallel()
+		e := engine(EscapeEnv)
+		e.Errs = &xerr.List{}
+		got, err := runFSM(t, e, "A='$V'\nB='$S'")
+		require.NoError(t, err)
+		assert.Equal(t, "A='$V'\nB='plain-value'", got)
+		assert.Equal(t, 1, e.Errs.Len())
+	})
+
+	t.Run("disabled without a format", func(t *testing.T) {
+		t.Parallel()
+		got, err := runFSM(t, engine(EscapeNone), `"$V"`)
+		require.NoError(t, err)
+		assert.Equal(t, `"`+env["V"]+`"`, got)
+	})
+}
+
+func TestEscaper(t *testing.T) {
+	t.Parallel()
+
+	t.Run("byte-wise feeding matches bulk feeding", func(t *testing.T) {
+		t.Parallel()
+		in := "a: |\n  x\nb: 'it''s' # c\n<x y=\"1\"><!-- a --><![CDATA[ q ]]>\nc = \"\"\"\n\"\n"
+		for _, f := range []EscapeFormat{EscapeYAML, EscapeJSON, EscapeXML, EscapeShell, EscapeTOML, EscapeEnv} {
+			bulk, bytewise := newEscaper(f), newEscaper(f)
+			bulk.feed([]byte(in))
+			for i := 0; i < len(in); i++ {
+				bytewise.feed([]byte{in[i]})
+			}
+			assert.Equal(t, bulk.context(), bytewise.context(), f.String())
+		}
+	})
+
+	t.Run("yaml single-quoted scalar with escaped quote", func(t *testing.T) {
+		t.Parallel()
+		s := newEscaper(EscapeYAML)
+		s.feedString("k: 'it''s ")
+		assert.Equal(t, escSingle, s.context().st)
+		s.feedString("'")
+		assert.Equal(t, escRaw, s.context().st)
+	})
+
+	t.Run("yaml block scalar ends at a shallower line", func(t *testing.T) {
+		t.Parallel()
+		s := newEscaper(EscapeYAML)
+		s.feedString("a:\n  b: >+\n    text\n    ")
+		assert.Equal(t, escBlock, s.context().st)
+		s.feedString("\n  c: ")
+		assert.Equal(t, escRaw, s.context().st)
+	})
+
+	t.Run("toml multi-line literal string", func(t *testing.T) {
+		t.Parallel()
+		s := newEscaper(EscapeTOML)
+		s.feedString("a = '''x")
+		assert.Equal(t, escMultiSingle, s.context().st)
+		s.feedString("'''")
+		assert.Equal(t, escRaw, s.context().st)
+	})
+}
+
+func TestIsBlockIndicator(t *testing.T) {
+	t.Parallel()
+
+	for line, want := range map[string]bool{
+		"key: |":     true,
+		"key: >-":    true,
+		"- |2+ ":     true,
+		"|":          true,
+		"key: a|":    false,
+		"key: value": false,
+		"":           false,
+	} {
+		assert.Equal(t, want, isBlockIndicator([]byte(line)), line)
+	}
+}
+
+func TestIsYAMLPlain(t *testing.T) {
+	t.Parallel()
+
+	for s, want := range map[string]bool{
+		"value":      true,
+		"5":          true,
+		"-5":         true,
+		"a:b":        true,
+		"a#b":        true,
+		"":           false,
+		" lead":      false,
+		"- item":     false,
+		"a: b":       false,
+		"a #c":       false,
+		"key:":       false,
+		"a,b":        false,
+		"*ref":       false,
+		"line\nnext": false,
+		"tab\there":  false,
+	} {
+		assert.Equal(t, want, isYAMLPlain(s), "%q", s)
+	}
+}
+
+func TestIsJSONScalar(t *testing.T) {
+	t.Parallel()
+
+	for s, want := range map[string]bool{
+		"0":        true,
+		"-1.5e+3":  true,
+		"true":     true,
+		"null":     true,
+		"01":       false,
+		"1.":       false,
+		"True":     false,
+		"":         false,
+		"1, 2":     false,
+		`{"a": 1}`: false,
+	} {
+		assert.Equal(t, want, isJSONScalar(s), "%q", s)
+	}
+}
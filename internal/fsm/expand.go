@@ -25,11 +25,16 @@ func (e *Engine) expandSimple(w *bufio.Writer, v VarRef) error {
 		_, err := w.WriteString(v.Lit())
 		return err
 	}
-	if !e.filter(v.Name) {
-		_, err := w.WriteString(e.Format.FilterStr(v.Lit()))
+	if ok, err := e.permits(v.Name); err != nil || !ok {
+		if err == nil {
+			_, err = w.WriteString(e.Format.FilterStr(v.Lit()))
+		}
+		return err
+	}
+	val, ok, err := e.lookup(v.Name)
+	if err != nil {
 		return err
 	}
-	val, ok := e.Lookup(v.Name)
 	if !ok {
 		if e.Opts.ErrorUnset {
 			return xerr.Unset(e.Format.UnsetStr(v.Lit()))
@@ -47,7 +52,7 @@ func (e *Engine) expandSimple(w *bufio.Writer, v VarRef) error {
 	if e.Opts.ErrorEmpty && val == "" {
 		return xerr.Empty(e.Format.EmptyStr(v.Lit()))
 	}
-	_, err := w.WriteString(e.Format.OkStr(val))
+	_, err = w.WriteString(e.Format.OkStr(val))
 	return err
 }
 
@@ -76,17 +81,38 @@ func (e *Engine) expandWithOp(name, op string, raw []byte) (string, error) {
 		return buf.String(), nil
 	}
 
+	// Filtered variables stay literal whatever the operator; their word is
+	// not expanded either.
+	if !isPrefixList(name, op, raw) {
+		if ok, err := e.permits(name); err != nil || !ok {
+			return e.Format.FilterStr(opLit(name, op, raw)), err
+		}
+	}
+
 	// Fast-path the operator word.
 	word := ""
-	if raw != nil {
+	if literalWord(op) {
+		word = string(raw)
+	} else if raw != nil {
 		w, err := e.fastWord(raw)
 		if err != nil {
 			return "", err
 		}
 		word = w
 	}
+	return e.applyOp(name, op, raw, word)
+}
 
-	val, isSet := e.Lookup(name)
+// applyOp evaluates ${VAR<op>word} given the already-expanded word;
+// raw is only used to render unknown operators literally.
+func (e *Engine) applyOp(name, op string, raw []byte, word string) (string, error) {
+	if isPrefixList(name, op, raw) {
+		return e.opNames(name)
+	}
+	val, isSet, err := e.lookup(name)
+	if err != nil {
+		return "", err
+	}
 	notNull := isSet && val != ""
 
 	switch op {
@@ -100,10 +126,12 @@ func (e *Engine) expandWithOp(name, op string, raw []byte) (string, error) {
 		return e.opCase(name, op, isSet, val)
 	case ":":
 		return e.opSubstr(name, isSet, val, word)
-	case "/", "//":
+	case "/", "//", "/#", "/%":
 		return e.opReplace(name, op, isSet, val, word)
 	case "@":
 		return e.opQuote(name, isSet, val, word)
+	case "~":
+		return e.opRegexReplace(name, op, isSet, val, word)
 	case "-":
 		return e.opDefault(isSet, val, word)
 	case ":-":
@@ -121,10 +149,18 @@ func (e *Engine) expandWithOp(name, op string, raw []byte) (string, error) {
 	case ":?":
 		return e.opErrorNull(name, notNull, word)
 	default:
-		return "${" + name + op + string(raw) + "}", nil
+		return opLit(name, op, raw), nil
 	}
 }
 
+// opLit renders ${VAR<op>word} as written.
+func opLit(name, op string, raw []byte) string {
+	if op == "#len" {
+		return "${#" + name + "}"
+	}
+	return "${" + name + op + string(raw) + "}"
+}
+
 // expandBytes runs nested expansion with a small, pooled tokenizer.
 func (e *Engine) expandBytes(raw []byte) (string, error) {
 	b := bufPool.Get().(*bytes.Buffer)
@@ -135,9 +171,13 @@ func (e *Engine) expandBytes(raw []byte) (string, error) {
 	// Reuse the same engine; no need to construct a child.
 	tok := smallTokPool.Get().(*Tokenizer)
 	tok.noEscape = e.Opts.NoEscape
-	tok.br.Reset(bytes.NewReader(raw))
+	at := e.wordAt
+	if at.Line == 0 {
+		at = startPos // called outside a parse; number from the start
+	}
+	tok.resetAt(bytes.NewReader(raw), at)
 
-	if err := e.consumeWithTokenizer(tok, bw); err != nil {
+	if err := e.consumeWithTokenizer(tok, bw, nil); err != nil {
 		smallTokPool.Put(tok)
 		bufPool.Put(b)
 		return "", err
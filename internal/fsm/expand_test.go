@@ -70,7 +70,7 @@ func TestExpandWithOp(t *testing.T) {
 			Format: formatter.NewFormatter(false), Label: label,
 			Lookup: func(name string) (string, bool) { return "aaab", true },
 		}
-		out, err := e.expandWithOp("VAR", "##", []byte("a"))
+		out, err := e.expandWithOp("VAR", "##", []byte("*a"))
 		require.NoError(t, err)
 		assert.Equal(t, "b", out)
 	})
@@ -92,7 +92,7 @@ func TestExpandWithOp(t *testing.T) {
 			Format: formatter.NewFormatter(false), Label: label,
 			Lookup: func(name string) (string, bool) { return "baaa", true },
 		}
-		out, err := e.expandWithOp("VAR", "%%", []byte("a"))
+		out, err := e.expandWithOp("VAR", "%%", []byte("a*"))
 		require.NoError(t, err)
 		assert.Equal(t, "b", out)
 	})
@@ -301,9 +301,9 @@ func TestExpandWithOp(t *testing.T) {
 			Format: formatter.NewFormatter(false), Label: label,
 			Lookup: func(name string) (string, bool) { return "v", true },
 		}
-		out, err := e.expandWithOp("VAR", "~", []byte("x"))
+		out, err := e.expandWithOp("VAR", "*", []byte("x"))
 		require.NoError(t, err)
-		assert.Equal(t, "${VAR~x}", out)
+		assert.Equal(t, "${VAR*x}", out)
 	})
 
 	t.Run("Fails when unset and FailOnUnset", func(t *testing.T) {
@@ -566,7 +566,7 @@ func TestExpandBytes(t *testing.T) {
 
 		out, err := e.expandBytes([]byte("${VAR?boom}"))
 		require.Error(t, err)
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, ":1:1: VAR: boom")
 		assert.Equal(t, "", out)
 	})
 }
@@ -1,28 +1,168 @@
 package fsm
 
 import (
-	"slices"
+	"fmt"
+	"regexp"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/gi8lino/vex/internal/flag"
 )
 
-// filter checks name against --variable/--prefix/--suffix allowlists.
-// When all lists are empty, everything is allowed.
-func (e *Engine) filter(name string) bool {
-	if len(e.Opts.Variables) == 0 && len(e.Opts.Prefix) == 0 && len(e.Opts.Suffix) == 0 {
+// Matcher decides which variable names are expanded. A name is allowed when
+// it matches any allow-list (--variable, --prefix, --suffix, --match,
+// --match-regex), or when all allow-lists are empty and Opts.Restricted is
+// unset, and no exclusion (--exclude-variable, --exclude-prefix).
+type Matcher struct {
+	all   bool                // no allow-list given
+	names map[string]struct{} // --variable
+	allow *regexp.Regexp      // --prefix, --suffix, --match and --match-regex as one alternation
+
+	excludeNames map[string]struct{} // --exclude-variable
+	exclude      *regexp.Regexp      // --exclude-prefix as one alternation
+}
+
+// NewMatcher compiles the filter options in o. It fails only for invalid
+// --match-regex patterns.
+func NewMatcher(o flag.Options) (*Matcher, error) {
+	var allow []string
+	for _, p := range o.Prefix {
+		allow = append(allow, "^"+regexp.QuoteMeta(p))
+	}
+	for _, s := range o.Suffix {
+		allow = append(allow, regexp.QuoteMeta(s)+"$")
+	}
+	for _, g := range o.Match {
+		allow = append(allow, globRegexp(g))
+	}
+	allow = append(allow, o.MatchRegex...)
+	var exclude []string
+	for _, p := range o.ExcludePrefix {
+		exclude = append(exclude, "^"+regexp.QuoteMeta(p))
+	}
+
+	m := &Matcher{names: set(o.Variables), excludeNames: set(o.ExcludeVariables)}
+	var err error
+	if m.allow, err = alternation(allow); err != nil {
+		return nil, err
+	}
+	if m.exclude, err = alternation(exclude); err != nil {
+		return nil, err
+	}
+	m.all = !o.Restricted && len(m.names) == 0 && m.allow == nil
+	return m, nil
+}
+
+// alternation compiles res as one unanchored regexp matching any of them
+// (nil when res is empty).
+func alternation(res []string) (*regexp.Regexp, error) {
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile("(?:" + strings.Join(res, ")|(?:") + ")")
+}
+
+// globRegexp translates the path.Match pattern g into an anchored regexp.
+// g is valid: flag parsing checks it.
+func globRegexp(g string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(g); i++ {
+		switch g[i] {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			i++
+			b.WriteString(regexp.QuoteMeta(g[i : i+1]))
+		case '[':
+			b.WriteString("[")
+			i++
+			if g[i] == '^' {
+				b.WriteString("^")
+				i++
+			}
+			for ; g[i] != ']'; i++ {
+				if g[i] == '-' {
+					b.WriteString("-")
+					continue
+				}
+				if g[i] == '\\' {
+					i++
+				}
+				r, n := utf8.DecodeRuneInString(g[i:])
+				fmt.Fprintf(&b, "\\x{%X}", r)
+				i += n - 1
+			}
+			b.WriteString("]")
+		default:
+			b.WriteString(regexp.QuoteMeta(g[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// set returns the entries of list as a set (nil when empty).
+func set(list []string) map[string]struct{} {
+	if len(list) == 0 {
+		return nil
+	}
+	s := make(map[string]struct{}, len(list))
+	for _, v := range list {
+		s[v] = struct{}{}
+	}
+	return s
+}
+
+// Match reports whether name is expanded.
+func (m *Matcher) Match(name string) bool {
+	if _, ok := m.excludeNames[name]; ok {
+		return false
+	}
+	if m.exclude != nil && m.exclude.MatchString(name) {
+		return false
+	}
+	if m.all {
 		return true
 	}
-	if slices.Contains(e.Opts.Variables, name) {
+	if _, ok := m.names[name]; ok {
 		return true
 	}
-	for _, p := range e.Opts.Prefix {
-		if strings.HasPrefix(name, p) {
-			return true
+	return m.allow != nil && m.allow.MatchString(name)
+}
+
+// filter checks name against the engine's Matcher.
+func (e *Engine) filter(name string) bool {
+	return e.matcher().Match(name)
+}
+
+// matcher returns the engine's Matcher, compiled from Opts on first use
+// when unset.
+func (e *Engine) matcher() *Matcher {
+	if e.Match == nil {
+		e.Match, _ = NewMatcher(e.Opts) // patterns are validated by flag parsing
+		if e.Match == nil {
+			e.Match = &Matcher{all: true}
 		}
 	}
-	for _, s := range e.Opts.Suffix {
-		if strings.HasSuffix(name, s) {
-			return true
-		}
+	return e.Match
+}
+
+// permits reports whether the reference name may be expanded: the variable
+// must pass the filter and, for ${!REF}, so must the variable REF names.
+func (e *Engine) permits(name string) (bool, error) {
+	ref, indirect := strings.CutPrefix(name, "!")
+	if !e.filter(ref) {
+		return false, nil
+	}
+	if !indirect {
+		return true, nil
+	}
+	target, ok, err := e.resolve(ref)
+	if err != nil || !ok || !isName(target) {
+		return true, err // resolves as unset
 	}
-	return false
+	return e.filter(target), nil
 }
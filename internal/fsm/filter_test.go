@@ -1,6 +1,7 @@
 package fsm
 
 import (
+	"path"
 	"testing"
 
 	"github.com/gi8lino/vex/internal/flag"
@@ -129,4 +130,157 @@ func TestFilter(t *testing.T) {
 		assert.True(t, e.filter("Value Suf"))
 		assert.False(t, e.filter("Value suf")) // different case
 	})
+
+	t.Run("exclusions win over allow lists", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{Opts: flag.Options{
+			Prefix:           []string{"APP_"},
+			ExcludeVariables: []string{"APP_SECRET"},
+			ExcludePrefix:    []string{"APP_INTERNAL_"},
+		}}
+		assert.True(t, e.filter("APP_URL"))
+		assert.False(t, e.filter("APP_SECRET"))
+		assert.False(t, e.filter("APP_INTERNAL_TOKEN"))
+		assert.False(t, e.filter("HOME"))
+	})
+
+	t.Run("exclusions alone allow everything else", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{Opts: flag.Options{ExcludeVariables: []string{"host", "uri"}, ExcludePrefix: []string{"nginx_"}}}
+		assert.True(t, e.filter("UPSTREAM"))
+		assert.False(t, e.filter("host"))
+		assert.False(t, e.filter("uri"))
+		assert.False(t, e.filter("nginx_port"))
+	})
+
+	t.Run("glob and regex allow lists", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{Opts: flag.Options{Match: []string{"APP_*_URL"}, MatchRegex: []string{"^DB_[A-Z]+$", "_PORT$"}}}
+		assert.True(t, e.filter("APP_API_URL"))
+		assert.False(t, e.filter("APP_API_URI"))
+		assert.True(t, e.filter("DB_HOST"))
+		assert.False(t, e.filter("DB_HOST_2"))
+		assert.True(t, e.filter("REDIS_PORT"))
+		assert.False(t, e.filter("PORTS"))
+	})
+}
+
+func TestNewMatcher(t *testing.T) {
+	t.Parallel()
+
+	t.Run("restricted with empty lists matches nothing", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := NewMatcher(flag.Options{Restricted: true})
+		require.NoError(t, err)
+		assert.False(t, m.Match("A"))
+
+		m, err = NewMatcher(flag.Options{Restricted: true, Variables: []string{"A"}})
+		require.NoError(t, err)
+		assert.True(t, m.Match("A"))
+		assert.False(t, m.Match("B"))
+	})
+
+	t.Run("prefixes, suffixes and globs", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := NewMatcher(flag.Options{
+			Prefix:        []string{"APP_", "a.b"},
+			Suffix:        []string{"_URL"},
+			Match:         []string{"DB_?_*", "X[0-9]", "Y[^a-c]", `Z\*`},
+			ExcludePrefix: []string{"APP_SECRET"},
+		})
+		require.NoError(t, err)
+		for name, want := range map[string]bool{
+			"APP_PORT":       true,
+			"APP_SECRET_KEY": false,
+			"a.bc":           true,
+			"axbc":           false,
+			"API_URL":        true,
+			"API_URL2":       false,
+			"DB_1_HOST":      true,
+			"DB_12_HOST":     false,
+			"X5":             true,
+			"X55":            false,
+			"Yd":             true,
+			"Yb":             false,
+			"Z*":             true,
+			"ZZ":             false,
+		} {
+			assert.Equal(t, want, m.Match(name), name)
+		}
+	})
+
+	t.Run("globs match like path.Match", func(t *testing.T) {
+		t.Parallel()
+
+		globs := []string{"*", "A*", "*_B", "A?C", "[AB]*", "[^A]?", "[a-cX]_*", `\[x`, "é*", "[é-ü]"}
+		names := []string{"", "A", "AB", "ABC", "A_B", "B1", "b_", "X_Y", "[x", "éa", "ö", "Z"}
+		for _, g := range globs {
+			m, err := NewMatcher(flag.Options{Match: []string{g}})
+			require.NoError(t, err)
+			for _, n := range names {
+				want, _ := path.Match(g, n)
+				assert.Equal(t, want, m.Match(n), "%q ~ %q", g, n)
+			}
+		}
+	})
+
+	t.Run("rejects invalid regexps", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewMatcher(flag.Options{MatchRegex: []string{"("}})
+		require.Error(t, err)
+	})
+
+	t.Run("shared across engines", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := NewMatcher(flag.Options{Variables: []string{"A"}})
+		require.NoError(t, err)
+		e := &Engine{Match: m, Opts: flag.Options{Variables: []string{"B"}}} // Match wins over Opts
+		assert.True(t, e.filter("A"))
+		assert.False(t, e.filter("B"))
+	})
+
+	t.Run("filtered references are left alone", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{
+			Format: formatter.NewFormatter(false),
+			Opts:   flag.Options{ExcludeVariables: []string{"host"}},
+			Lookup: func(string) (string, bool) { return "x", true },
+		}
+		got, err := runFSM(t, e, "$host ${host} $uri")
+		require.NoError(t, err)
+		assert.Equal(t, "$host ${host} x", got)
+	})
+
+	t.Run("filters apply to every operator form", func(t *testing.T) {
+		t.Parallel()
+
+		env := map[string]string{"HOME": "h", "REF": "HOME", "OK": "ok", "OKREF": "OK"}
+		lookup := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+		newEngine := func() *Engine {
+			return &Engine{
+				Format: formatter.NewFormatter(false),
+				Opts:   flag.Options{ExcludeVariables: []string{"HOME"}},
+				Lookup: lookup,
+				Setenv: func(string, string) error { return nil },
+			}
+		}
+		in := "$HOME ${HOME} ${HOME:-x} ${#HOME} ${HOME^^} ${HOME/h/g} ${HOME:-${OK}} ${!REF} ${!REF:-x} ${!OKREF} ${OK:-x}"
+		want := "$HOME ${HOME} ${HOME:-x} ${#HOME} ${HOME^^} ${HOME/h/g} ${HOME:-${OK}} ${!REF} ${!REF:-x} ok ok"
+
+		got, err := runFSM(t, newEngine(), in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "streaming")
+
+		got, err = execString(t, newEngine(), in, nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "compiled")
+	})
 }
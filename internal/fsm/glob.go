@@ -0,0 +1,313 @@
+package fsm
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// globKind enumerates the elements of a compiled glob.
+type globKind uint8
+
+const (
+	globLit   globKind = iota // literal text
+	globAny                   // '?' (one rune)
+	globStar                  // '*' (any run of runes)
+	globClass                 // bracket expression
+)
+
+// globElem is one element of a compiled glob.
+type globElem struct {
+	kind  globKind
+	lit   string     // text for globLit
+	class *charClass // set for globClass
+}
+
+// glob is a compiled bash pattern (as used by #, %, / and friends).
+type glob struct {
+	elems []globElem
+}
+
+// charClass is a parsed bracket expression like [a-z], [!0-9] or [[:alpha:]].
+type charClass struct {
+	negate bool
+	runes  []rune            // single members
+	ranges [][2]rune         // inclusive ranges
+	named  []func(rune) bool // POSIX classes
+}
+
+// posixClasses maps [:name:] to its predicate.
+var posixClasses = map[string]func(rune) bool{
+	"alpha":  unicode.IsLetter,
+	"digit":  func(r rune) bool { return r >= '0' && r <= '9' },
+	"alnum":  func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) },
+	"upper":  unicode.IsUpper,
+	"lower":  unicode.IsLower,
+	"space":  unicode.IsSpace,
+	"blank":  func(r rune) bool { return r == ' ' || r == '\t' },
+	"punct":  unicode.IsPunct,
+	"print":  unicode.IsPrint,
+	"graph":  func(r rune) bool { return unicode.IsGraphic(r) && !unicode.IsSpace(r) },
+	"cntrl":  unicode.IsControl,
+	"xdigit": func(r rune) bool { return strings.ContainsRune("0123456789abcdefABCDEF", r) },
+	"word":   func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) },
+}
+
+// matches reports whether r is a member of the class.
+func (c *charClass) matches(r rune) bool {
+	in := false
+	for _, m := range c.runes {
+		if m == r {
+			in = true
+			break
+		}
+	}
+	for i := 0; !in && i < len(c.ranges); i++ {
+		in = c.ranges[i][0] <= r && r <= c.ranges[i][1]
+	}
+	for i := 0; !in && i < len(c.named); i++ {
+		in = c.named[i](r)
+	}
+	return in != c.negate
+}
+
+// hasGlobMeta reports whether pat needs the glob matcher.
+func hasGlobMeta(pat string) bool {
+	return strings.ContainsAny(pat, `*?[\`)
+}
+
+// compileGlob parses pat. A '[' without a closing ']' is literal, as in bash.
+func compileGlob(pat string) *glob {
+	g := &glob{}
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			g.elems = append(g.elems, globElem{kind: globLit, lit: lit.String()})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(pat); {
+		switch c := pat[i]; c {
+		case '\\':
+			if i+1 < len(pat) {
+				_, n := utf8.DecodeRuneInString(pat[i+1:])
+				lit.WriteString(pat[i+1 : i+1+n])
+				i += 1 + n
+				continue
+			}
+			lit.WriteByte(c)
+			i++
+		case '*':
+			flush()
+			if n := len(g.elems); n == 0 || g.elems[n-1].kind != globStar {
+				g.elems = append(g.elems, globElem{kind: globStar})
+			}
+			i++
+		case '?':
+			flush()
+			g.elems = append(g.elems, globElem{kind: globAny})
+			i++
+		case '[':
+			class, n := parseClass(pat[i:])
+			if class == nil {
+				lit.WriteByte(c)
+				i++
+				continue
+			}
+			flush()
+			g.elems = append(g.elems, globElem{kind: globClass, class: class})
+			i += n
+		default:
+			lit.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+	return g
+}
+
+// parseClass parses the bracket expression at the start of s and returns it
+// with its length in bytes, or nil when s has no closing ']'.
+func parseClass(s string) (*charClass, int) {
+	c := &charClass{}
+	i := 1
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		c.negate = true
+		i++
+	}
+	first := true
+	for i < len(s) {
+		if s[i] == ']' && !first {
+			return c, i + 1
+		}
+		first = false
+
+		if strings.HasPrefix(s[i:], "[:") {
+			if end := strings.Index(s[i+2:], ":]"); end >= 0 {
+				if fn, ok := posixClasses[s[i+2:i+2+end]]; ok {
+					c.named = append(c.named, fn)
+					i += 2 + end + 2
+					continue
+				}
+			}
+		}
+
+		lo, n := classRune(s[i:])
+		i += n
+		if i+1 < len(s) && s[i] == '-' && s[i+1] != ']' {
+			hi, m := classRune(s[i+1:])
+			c.ranges = append(c.ranges, [2]rune{lo, hi})
+			i += 1 + m
+			continue
+		}
+		c.runes = append(c.runes, lo)
+	}
+	return nil, 0
+}
+
+// classRune decodes one (possibly backslash-escaped) rune of a bracket expression.
+func classRune(s string) (rune, int) {
+	if s[0] == '\\' && len(s) > 1 {
+		r, n := utf8.DecodeRuneInString(s[1:])
+		return r, 1 + n
+	}
+	return utf8.DecodeRuneInString(s)
+}
+
+// match reports whether the whole of s matches g.
+func (g *glob) match(s string) bool {
+	ei, si := 0, 0
+	starEi, starSi := -1, 0
+	for ei < len(g.elems) || si < len(s) {
+		if ei < len(g.elems) {
+			switch el := g.elems[ei]; el.kind {
+			case globStar:
+				starEi, starSi = ei, si
+				ei++
+				continue
+			case globLit:
+				if strings.HasPrefix(s[si:], el.lit) {
+					si += len(el.lit)
+					ei++
+					continue
+				}
+			case globAny:
+				if si < len(s) {
+					_, n := utf8.DecodeRuneInString(s[si:])
+					si += n
+					ei++
+					continue
+				}
+			case globClass:
+				if si < len(s) {
+					r, n := utf8.DecodeRuneInString(s[si:])
+					if el.class.matches(r) {
+						si += n
+						ei++
+						continue
+					}
+				}
+			}
+		}
+		// Mismatch: let the last '*' swallow one more rune and retry.
+		if starEi < 0 || starSi >= len(s) {
+			return false
+		}
+		_, n := utf8.DecodeRuneInString(s[starSi:])
+		starSi += n
+		ei, si = starEi+1, starSi
+	}
+	return true
+}
+
+// boundaries returns the rune boundaries of s, including 0 and len(s).
+func boundaries(s string) []int {
+	idx := make([]int, 0, len(s)+1)
+	for i := range s {
+		idx = append(idx, i)
+	}
+	return append(idx, len(s))
+}
+
+// trimPrefix removes the shortest (or longest) prefix of s matching g.
+func (g *glob) trimPrefix(s string, longest bool) string {
+	b := boundaries(s)
+	for k := range b {
+		if longest {
+			k = len(b) - 1 - k
+		}
+		if g.match(s[:b[k]]) {
+			return s[b[k]:]
+		}
+	}
+	return s
+}
+
+// trimSuffix removes the shortest (or longest) suffix of s matching g.
+func (g *glob) trimSuffix(s string, longest bool) string {
+	b := boundaries(s)
+	for k := range b {
+		if !longest {
+			k = len(b) - 1 - k
+		}
+		if g.match(s[b[k]:]) {
+			return s[:b[k]]
+		}
+	}
+	return s
+}
+
+// replace substitutes the longest non-empty match at the leftmost position
+// (or every such match when all is set) with repl.
+func (g *glob) replace(s, repl string, all bool) string {
+	b := boundaries(s)
+	var out strings.Builder
+	last, replaced := 0, false // last: end of the text already copied to out
+	for i := 0; i < len(b)-1; {
+		end := -1
+		for j := len(b) - 1; j > i; j-- {
+			if g.match(s[b[i]:b[j]]) {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			i++
+			continue
+		}
+		out.WriteString(s[last:b[i]])
+		out.WriteString(repl)
+		last, replaced = b[end], true
+		if !all {
+			break
+		}
+		i = end
+	}
+	if !replaced {
+		return s
+	}
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+// replacePrefix substitutes the longest prefix of s matching g with repl.
+func (g *glob) replacePrefix(s, repl string) string {
+	b := boundaries(s)
+	for k := len(b) - 1; k >= 0; k-- {
+		if g.match(s[:b[k]]) {
+			return repl + s[b[k]:]
+		}
+	}
+	return s
+}
+
+// replaceSuffix substitutes the longest suffix of s matching g with repl.
+func (g *glob) replaceSuffix(s, repl string) string {
+	b := boundaries(s)
+	for k := range b {
+		if g.match(s[b[k]:]) {
+			return s[:b[k]] + repl
+		}
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pat, s string
+		want   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbb", false},
+		{"a**c", "ac", true},
+		{"?", "é", true},
+		{"??", "é", false},
+		{"*.go", "main.go", true},
+		{"*.go", "main.go.bak", false},
+		{"[abc]x", "bx", true},
+		{"[a-c]x", "dx", false},
+		{"[!a-c]x", "dx", true},
+		{"[^a-c]x", "ax", false},
+		{"[]]", "]", true},
+		{"[a-]", "-", true},
+		{"[[:digit:]][[:alpha:]]", "1a", true},
+		{"[[:upper:]]*", "hello", false},
+		{"[[:space:][:punct:]]", ".", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`[\]]`, "]", true},
+		{"[abc", "[abc", true}, // unterminated bracket is literal
+		{`a\`, `a\`, true},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b*", "xxbxxaxx", false},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, compileGlob(tc.pat).match(tc.s), "%q ~ %q", tc.pat, tc.s)
+	}
+}
+
+func TestGlobTrim(t *testing.T) {
+	t.Parallel()
+
+	t.Run("shortest and longest prefix", func(t *testing.T) {
+		t.Parallel()
+		g := compileGlob("*/")
+		assert.Equal(t, "b/c", g.trimPrefix("a/b/c", false))
+		assert.Equal(t, "c", g.trimPrefix("a/b/c", true))
+		assert.Equal(t, "abc", g.trimPrefix("abc", true))
+	})
+
+	t.Run("shortest and longest suffix", func(t *testing.T) {
+		t.Parallel()
+		g := compileGlob(".*")
+		assert.Equal(t, "a.tar", g.trimSuffix("a.tar.gz", false))
+		assert.Equal(t, "a", g.trimSuffix("a.tar.gz", true))
+	})
+
+	t.Run("multibyte runes", func(t *testing.T) {
+		t.Parallel()
+		g := compileGlob("?")
+		assert.Equal(t, "bc", g.trimPrefix("äbc", false))
+		assert.Equal(t, "ab", g.trimSuffix("abç", false))
+	})
+}
+
+func TestGlobReplace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("longest leftmost match", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "X", compileGlob("a*").replace("abcabc", "X", false))
+		assert.Equal(t, "xXc", compileGlob("a?").replace("xabc", "X", false))
+	})
+
+	t.Run("all matches", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "x-x-x", compileGlob("[0-9]").replace("1-2-3", "x", true))
+	})
+
+	t.Run("no match returns input", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "abc", compileGlob("[0-9]").replace("abc", "x", true))
+	})
+
+	t.Run("anchored", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "Xc", compileGlob("*b").replacePrefix("abc", "X"))
+		assert.Equal(t, "aX", compileGlob("b*").replaceSuffix("abc", "X"))
+		assert.Equal(t, "abc", compileGlob("z*").replaceSuffix("abc", "X"))
+	})
+}
@@ -0,0 +1,36 @@
+package fsm
+
+import "bytes"
+
+// lintOp describes what is wrong with operator op and its raw word, or
+// returns "" when the form is valid. Words containing '$' are only known
+// after nested expansion and are not inspected.
+func lintOp(op string, raw []byte) string {
+	dynamic := bytes.IndexByte(raw, '$') >= 0
+	switch op {
+	case "#len", "^", "^^", ",", ",,", ":", "-", ":-", "=", ":=", "+", ":+", "?", ":?":
+		return ""
+	case "#", "##", "%", "%%":
+		if len(raw) == 0 {
+			return "empty pattern"
+		}
+	case "/", "//", "/#", "/%":
+		if dynamic {
+			return ""
+		}
+		if pat, _, _ := cutPattern(string(raw)); pat == "" && (op == "/" || op == "//") {
+			return "empty pattern"
+		}
+	case "@":
+		if !dynamic && !knownQuoteMode(string(raw)) {
+			return "unknown quoting mode"
+		}
+	case "~":
+		if _, _, _, err := parseRegexSpec(string(raw)); err != nil {
+			return err.Error()
+		}
+	default:
+		return "unknown operator"
+	}
+	return ""
+}
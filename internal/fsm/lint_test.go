@@ -0,0 +1,52 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintOp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		op   string
+		word string
+		want string
+	}{
+		{op: ":-", word: "x", want: ""},
+		{op: "#len", want: ""},
+		{op: "#", word: "a", want: ""},
+		{op: "##", want: "empty pattern"},
+		{op: "%", want: "empty pattern"},
+		{op: "/", word: "a/b", want: ""},
+		{op: "//", word: "/b", want: "empty pattern"},
+		{op: "/", word: "a", want: ""},
+		{op: "/", word: "${P}", want: ""},
+		{op: "@", word: "q", want: ""},
+		{op: "@", word: "X", want: "unknown quoting mode"},
+		{op: "@", word: "B@J", want: ""},
+		{op: "@", word: "b", want: ""},
+		{op: "@", word: "B@X", want: "unknown quoting mode"},
+		{op: "@", want: "unknown quoting mode"},
+		{op: "@", word: "$MODE", want: ""},
+		{op: "/#", word: "/x", want: ""},
+		{op: "/%", word: "a", want: ""},
+		{op: "//", word: `\/x/y`, want: ""},
+		{op: "~", word: "/a(b)/$1", want: ""},
+		{op: "~", word: "/(/x", want: "invalid regex: missing closing ): `(`"},
+		{op: "~", word: "a/b", want: "regex replace expects ~/regex/replacement[/flags]"},
+		{op: "%/", word: "*", want: "unknown operator"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.op+tc.word, func(t *testing.T) {
+			t.Parallel()
+			var raw []byte
+			if tc.word != "" {
+				raw = []byte(tc.word)
+			}
+			assert.Equal(t, tc.want, lintOp(tc.op, raw))
+		})
+	}
+}
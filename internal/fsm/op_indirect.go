@@ -0,0 +1,87 @@
+package fsm
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/xerr"
+)
+
+// Indirect references keep their '!' in the name (${!REF} is parsed as
+// name "!REF"), so literals and diagnostics render as written and every
+// operator applies to the resolved variable unchanged.
+
+// lookup resolves name, following one level of indirection for "!REF".
+// A reference that is unset or does not hold a valid variable name
+// resolves as unset.
+func (e *Engine) lookup(name string) (string, bool, error) {
+	ref, indirect := strings.CutPrefix(name, "!")
+	if !indirect {
+		return e.resolve(name)
+	}
+	target, ok, err := e.resolve(ref)
+	if err != nil || !ok || !isName(target) {
+		return "", false, err
+	}
+	return e.resolve(target)
+}
+
+// resolve looks up one variable with Resolve, or Lookup when unset.
+func (e *Engine) resolve(name string) (string, bool, error) {
+	if e.Resolve != nil {
+		return e.Resolve(name)
+	}
+	v, ok := e.Lookup(name)
+	return v, ok, nil
+}
+
+// assign calls Setenv for ${VAR=word} and ${VAR:=word}; for "!REF" the
+// variable named by REF is assigned. Setenv failures are ignored.
+func (e *Engine) assign(name, val string) {
+	if ref, indirect := strings.CutPrefix(name, "!"); indirect {
+		target, ok, err := e.resolve(ref)
+		if err != nil || !ok || !isName(target) {
+			return
+		}
+		name = target
+	}
+	_ = e.Setenv(name, val)
+}
+
+// isPrefixList reports whether ${name<op>} is a prefix listing (${!P*}, ${!P@}).
+func isPrefixList(name, op string, raw []byte) bool {
+	return raw == nil && (op == "*" || op == "@") && strings.HasPrefix(name, "!")
+}
+
+// opNames implements ${!PREFIX*} and ${!PREFIX@}: the names of all known
+// variables starting with PREFIX, sorted and separated by spaces.
+func (e *Engine) opNames(name string) (string, error) {
+	prefix := strings.TrimPrefix(name, "!")
+	var names []string
+	if e.Names != nil {
+		for _, n := range e.Names() {
+			if strings.HasPrefix(n, prefix) {
+				names = append(names, n)
+			}
+		}
+	}
+	slices.Sort(names)
+	out := strings.Join(slices.Compact(names), " ")
+	if e.Opts.ErrorEmpty && out == "" {
+		return "", xerr.Empty(e.Format.EmptyStr(name))
+	}
+	return e.Format.OkStr(out), nil
+}
+
+// isName reports whether s is a valid variable name.
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameCont(s[i]) {
+			return false
+		}
+	}
+	return true
+}
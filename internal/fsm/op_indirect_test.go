@@ -0,0 +1,105 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupIndirect(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"REF": "T", "T": "v", "BAD": "1x"}
+	e := &Engine{Lookup: func(k string) (string, bool) { v, ok := env[k]; return v, ok }}
+
+	t.Run("plain name", func(t *testing.T) {
+		t.Parallel()
+		v, ok, err := e.lookup("T")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "v", v)
+	})
+
+	t.Run("follows one level", func(t *testing.T) {
+		t.Parallel()
+		v, ok, err := e.lookup("!REF")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "v", v)
+	})
+
+	t.Run("unset reference or invalid target is unset", func(t *testing.T) {
+		t.Parallel()
+		_, ok, _ := e.lookup("!NOPE")
+		assert.False(t, ok)
+		_, ok, _ = e.lookup("!BAD")
+		assert.False(t, ok)
+	})
+
+	t.Run("resolve errors are returned", func(t *testing.T) {
+		t.Parallel()
+		r := &Engine{Resolve: func(k string) (string, bool, error) {
+			if k == "REF" {
+				return "T", true, nil
+			}
+			return "", false, errors.New("boom")
+		}}
+		_, _, err := r.lookup("!REF")
+		assert.EqualError(t, err, "boom")
+		_, _, err = r.lookup("!X")
+		assert.EqualError(t, err, "boom")
+	})
+}
+
+func TestOpNames(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lists sorted unique matches", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Format: formatter.NewFormatter(false),
+			Names:  func() []string { return []string{"A_2", "B", "A_1", "A_2"} },
+		}
+		out, err := e.opNames("!A_")
+		require.NoError(t, err)
+		assert.Equal(t, "A_1 A_2", out)
+	})
+
+	t.Run("nil Names lists nothing", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{Format: formatter.NewFormatter(false)}
+		out, err := e.opNames("!A_")
+		require.NoError(t, err)
+		assert.Equal(t, "", out)
+	})
+
+	t.Run("empty result fails under ErrorEmpty", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{Format: formatter.NewFormatter(false), Opts: flag.Options{ErrorEmpty: true}}
+		_, err := e.opNames("!A_")
+		require.Error(t, err)
+		assert.EqualError(t, err, "substitution empty: !A_")
+	})
+}
+
+func TestIsName(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+		for _, s := range []string{"A", "_x", "DB_HOST_1"} {
+			assert.True(t, isName(s), s)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, s := range []string{"", "1A", "A-B", "a b"} {
+			assert.False(t, isName(s), s)
+		}
+	})
+}
@@ -1,8 +1,6 @@
 package fsm
 
-import (
-	"errors"
-)
+import "github.com/gi8lino/vex/internal/xerr"
 
 // opDefault implements ${VAR-word}.
 func (e *Engine) opDefault(isSet bool, val, word string) (string, error) {
@@ -23,7 +21,7 @@ func (e *Engine) opDefaultNull(notNull bool, val, word string) (string, error) {
 // opAssign implements ${VAR=word}.
 func (e *Engine) opAssign(name string, isSet bool, val, word string) (string, error) {
 	if !isSet {
-		_ = e.Setenv(name, word)
+		e.assign(name, word)
 		return e.Format.DefaultStr(word), nil
 	}
 	return e.Format.OkStr(val), nil
@@ -32,7 +30,7 @@ func (e *Engine) opAssign(name string, isSet bool, val, word string) (string, er
 // opAssignNull implements ${VAR:=word}.
 func (e *Engine) opAssignNull(name string, notNull bool, val, word string) (string, error) {
 	if !notNull {
-		_ = e.Setenv(name, word)
+		e.assign(name, word)
 		return e.Format.DefaultStr(word), nil
 	}
 	return e.Format.OkStr(val), nil
@@ -57,7 +55,7 @@ func (e *Engine) opAltNull(name string, notNull bool, word string) (string, erro
 // opErrorUnset implements ${VAR?word}.
 func (e *Engine) opErrorUnset(name string, isSet bool, word string) (string, error) {
 	if !isSet {
-		return "", errors.New(e.Format.UserErrorStr(name + ": " + word))
+		return "", xerr.User(e.Format.UserErrorStr(name + ": " + word))
 	}
 	return e.Format.OkStr(""), nil
 }
@@ -65,7 +63,7 @@ func (e *Engine) opErrorUnset(name string, isSet bool, word string) (string, err
 // opErrorNull implements ${VAR:?word}.
 func (e *Engine) opErrorNull(name string, notNull bool, word string) (string, error) {
 	if !notNull {
-		return "", errors.New(e.Format.UserErrorStr(name + ": " + word))
+		return "", xerr.User(e.Format.UserErrorStr(name + ": " + word))
 	}
 	return e.Format.OkStr(""), nil
 }
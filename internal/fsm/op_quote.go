@@ -1,12 +1,19 @@
 package fsm
 
 import (
+	"encoding/base64"
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/gi8lino/vex/internal/xerr"
 )
 
-// opQuote handles ${VAR@Q}, ${VAR@J}, ${VAR@Y}.
+// opQuote handles ${VAR@M} for the modes in quoteModes. Modes can be
+// chained and apply left to right: ${VAR@B@J} is the JSON string of the
+// base64 encoding.
 func (e *Engine) opQuote(name string, isSet bool, val, modeRaw string) (string, error) {
 	if !isSet {
 		if e.Opts.ErrorUnset {
@@ -17,18 +24,59 @@ func (e *Engine) opQuote(name string, isSet bool, val, modeRaw string) (string,
 		}
 		val = ""
 	}
-	mode := strings.TrimSpace(strings.ToUpper(modeRaw))
-	switch mode {
-	case "Q":
-		return e.Format.OkStr(shellQuote(val)), nil
-	case "J":
-		return e.Format.OkStr(jsonQuote(val)), nil
-	case "Y":
-		return e.Format.OkStr(yamlQuote(val)), nil
-	default:
+	if !knownQuoteMode(modeRaw) {
 		// unknown mode → keep literal
 		return e.Format.ErrorStr("${" + name + "@" + modeRaw + "}"), nil
 	}
+	for _, m := range strings.Split(modeRaw, "@") {
+		out, err := quoteModes[quoteMode(m)](val)
+		if err != nil {
+			return "", xerr.Invalid(name + ": @" + strings.TrimSpace(m) + ": " + err.Error())
+		}
+		val = out
+	}
+	return e.Format.OkStr(val), nil
+}
+
+// quoteModes maps each @ mode to its transform.
+var quoteModes = map[string]func(string) (string, error){
+	"Q": plain(shellQuote),
+	"J": plain(jsonQuote),
+	"Y": plain(yamlQuote),
+	"H": plain(html.EscapeString),
+	"U": plain(url.QueryEscape),
+	"P": plain(url.PathEscape),
+	"B": plain(base64.StdEncoding.EncodeToString),
+	"b": base64Decode,
+	"T": plain(tomlQuote),
+	"C": plain(csvField),
+	"R": plain(regexp.QuoteMeta),
+	"S": plain(sedEscape),
+}
+
+// plain adapts an infallible transform; encoders taking []byte are accepted too.
+func plain[T string | []byte](f func(T) string) func(string) (string, error) {
+	return func(s string) (string, error) { return f(T(s)), nil }
+}
+
+// quoteMode normalizes a mode letter. Modes are case-insensitive except
+// for b (base64 decode), which differs from B (encode).
+func quoteMode(m string) string {
+	m = strings.TrimSpace(m)
+	if m == "b" {
+		return m
+	}
+	return strings.ToUpper(m)
+}
+
+// knownQuoteMode reports whether opQuote understands every mode in modeRaw.
+func knownQuoteMode(modeRaw string) bool {
+	for _, m := range strings.Split(modeRaw, "@") {
+		if _, ok := quoteModes[quoteMode(m)]; !ok {
+			return false
+		}
+	}
+	return true
 }
 
 // shellQuote returns a POSIX single-quoted string literal.
@@ -81,3 +129,33 @@ func jsonQuote(s string) string {
 func yamlQuote(s string) string {
 	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
 }
+
+// tomlQuote returns a TOML basic string; TOML additionally forbids a raw DEL.
+func tomlQuote(s string) string {
+	return strings.ReplaceAll(jsonQuote(s), "\x7f", `\u007f`)
+}
+
+// csvField quotes s as an RFC 4180 field when it contains a delimiter,
+// quote or line break (or leading space), doubling embedded quotes.
+func csvField(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") && !strings.HasPrefix(s, " ") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// sedEscape escapes s for the replacement side of a sed s/// command
+// using '/' as delimiter.
+var sedEscape = strings.NewReplacer(`\`, `\\`, "&", `\&`, "/", `\/`, "\n", "\\\n").Replace
+
+// base64Decode decodes standard base64, padded or not.
+func base64Decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		b, err = base64.RawStdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return "", errors.New("invalid base64")
+	}
+	return string(b), nil
+}
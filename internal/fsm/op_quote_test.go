@@ -1,10 +1,12 @@
 package fsm
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/gi8lino/vex/internal/flag"
 	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -131,6 +133,89 @@ func TestOpQuote(t *testing.T) {
 		assert.Equal(t, `'o''hai'`, out)
 	})
 
+	t.Run("additional modes", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{
+			Label:  label,
+			Format: formatter.NewFormatter(false),
+		}
+		for _, tc := range []struct{ mode, in, want string }{
+			{"H", `<a href="x">&'</a>`, "&lt;a href=&#34;x&#34;&gt;&amp;&#39;&lt;/a&gt;"},
+			{"U", "a b&c=d/é", "a+b%26c%3Dd%2F%C3%A9"},
+			{"P", "a b/c?d", "a%20b%2Fc%3Fd"},
+			{"B", "hello", "aGVsbG8="},
+			{"b", "aGVsbG8=", "hello"},
+			{"b", "aGVsbG8", "hello"},
+			{"T", "a\"b\\c\n\x7f", `"a\"b\\c\n\u007f"`},
+			{"C", "plain", "plain"},
+			{"C", `a,"b"`, `"a,""b"""`},
+			{"C", " lead", `" lead"`},
+			{"R", "1.2.3+[x]", `1\.2\.3\+\[x\]`},
+			{"S", "a/b&c\\d\ne", "a\\/b\\&c\\\\d\\\ne"},
+		} {
+			out, err := e.opQuote("VAR", true /*isSet*/, tc.in, tc.mode)
+			require.NoError(t, err, "mode %s", tc.mode)
+			assert.Equal(t, tc.want, out, "mode %s", tc.mode)
+		}
+	})
+
+	t.Run("modes chain left to right", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{
+			Label:  label,
+			Format: formatter.NewFormatter(false),
+		}
+		out, err := e.opQuote("VAR", true /*isSet*/, "a\nb", "B@J")
+		require.NoError(t, err)
+		assert.Equal(t, `"YQpi"`, out)
+
+		out, err = e.opQuote("VAR", true /*isSet*/, "x y", "B@b@q")
+		require.NoError(t, err)
+		assert.Equal(t, `'x y'`, out)
+	})
+
+	t.Run("chain with unknown mode keeps literal", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{
+			Label:  label,
+			Format: formatter.NewFormatter(false),
+		}
+		for _, mode := range []string{"B@Z", "B@", "@J"} {
+			out, err := e.opQuote("VAR", true /*isSet*/, "value", mode)
+			require.NoError(t, err)
+			assert.Equal(t, "${VAR@"+mode+"}", out)
+		}
+	})
+
+	t.Run("invalid base64 errors", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{
+			Label:  label,
+			Format: formatter.NewFormatter(false),
+		}
+		_, err := e.opQuote("VAR", true /*isSet*/, "not base64!", "b")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, xerr.ErrInvalid))
+		assert.EqualError(t, err, "invalid value: VAR: @b: invalid base64")
+	})
+
+	t.Run("unset new mode keeps literal under NoReplaceUnset", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{
+			Label:  label,
+			Opts:   flag.Options{KeepUnset: true},
+			Format: formatter.NewFormatter(false),
+		}
+		out, err := e.opQuote("VAR", false /*isSet*/, "", "B@J")
+		require.NoError(t, err)
+		assert.Equal(t, "${VAR@B@J}", out)
+	})
+
 	t.Run("unknown mode keeps literal", func(t *testing.T) {
 		t.Parallel()
 
@@ -224,3 +309,31 @@ func TestYamlQuote(t *testing.T) {
 		assert.Equal(t, `'a''b''c'`, yamlQuote("a'b'c"))
 	})
 }
+
+func TestTomlQuote(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty string", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, `""`, tomlQuote(""))
+	})
+
+	t.Run("escapes DEL", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, `"a\u007f"`, tomlQuote("a\x7f"))
+	})
+}
+
+func TestCsvField(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty string", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "", csvField(""))
+	})
+
+	t.Run("line break is quoted", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "\"a\nb\"", csvField("a\nb"))
+	})
+}
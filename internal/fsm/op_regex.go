@@ -0,0 +1,102 @@
+package fsm
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/xerr"
+)
+
+// literalWord reports whether op takes its word verbatim, without nested
+// expansion; regex words keep "$1" backrefs and "$" anchors intact.
+func literalWord(op string) bool {
+	return op == "~"
+}
+
+// errRegexSpec describes the expected shape of a regex replace word.
+var errRegexSpec = errors.New("regex replace expects ~/regex/replacement[/flags]")
+
+// parseRegexSpec splits "/re/repl[/flags]". A '/' inside re or repl must be
+// escaped as "\/". Flags are g (replace all) and i (ignore case).
+func parseRegexSpec(spec string) (re *regexp.Regexp, repl string, global bool, err error) {
+	pat, ok := strings.CutPrefix(spec, "/")
+	if !ok {
+		return nil, "", false, errRegexSpec
+	}
+	pat, rest, found := cutPattern(pat)
+	if !found || pat == "" {
+		return nil, "", false, errRegexSpec
+	}
+	repl, flags, _ := cutPattern(rest)
+	repl = strings.ReplaceAll(repl, `\/`, "/")
+
+	prefix := ""
+	for _, f := range flags {
+		switch f {
+		case 'g':
+			global = true
+		case 'i':
+			prefix = "(?i)"
+		default:
+			return nil, "", false, errors.New("unknown regex flag " + string(f))
+		}
+	}
+	re, err = regexp.Compile(prefix + pat)
+	if err != nil {
+		return nil, "", false, errors.New("invalid regex: " + strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+	}
+	return re, repl, global, nil
+}
+
+// regexSpec parses spec, caching compiled patterns for the rest of the run.
+func (e *Engine) regexSpec(spec string) (*regexp.Regexp, string, bool, error) {
+	pat, rest, _ := cutPattern(strings.TrimPrefix(spec, "/"))
+	repl, flags, _ := cutPattern(rest)
+	key := flags + "/" + pat
+	if re, ok := e.regexps[key]; ok {
+		return re, strings.ReplaceAll(repl, `\/`, "/"), strings.Contains(flags, "g"), nil
+	}
+	re, repl, global, err := parseRegexSpec(spec)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if e.regexps == nil {
+		e.regexps = make(map[string]*regexp.Regexp)
+	}
+	e.regexps[key] = re
+	return re, repl, global, nil
+}
+
+// opRegexReplace implements ${VAR~/re/repl} and ${VAR~/re/repl/g}.
+// repl may reference groups as $1, ${1} or ${name}.
+func (e *Engine) opRegexReplace(name, op string, isSet bool, val, spec string) (string, error) {
+	re, repl, global, err := e.regexSpec(spec)
+	if err != nil {
+		return "", xerr.Syntax(err.Error())
+	}
+	if !isSet {
+		if e.Opts.ErrorUnset {
+			return "", xerr.Unset(e.Format.UnsetStr(name))
+		}
+		if e.Opts.KeepUnset {
+			return e.Format.UnsetStr("${" + name + op + spec + "}"), nil
+		}
+		return e.Format.OkStr(""), nil
+	}
+
+	var out string
+	if global {
+		out = re.ReplaceAllString(val, repl)
+	} else if m := re.FindStringSubmatchIndex(val); m != nil {
+		dst := re.ExpandString([]byte(val[:m[0]]), repl, val, m)
+		out = string(dst) + val[m[1]:]
+	} else {
+		out = val
+	}
+
+	if e.Opts.ErrorEmpty && out == "" {
+		return "", xerr.Empty(e.Format.EmptyStr(name))
+	}
+	return e.Format.OkStr(out), nil
+}
@@ -0,0 +1,124 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRegexSpec(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pattern, replacement and flags", func(t *testing.T) {
+		t.Parallel()
+		re, repl, global, err := parseRegexSpec(`/a\/(b)/x\/$1/g`)
+		require.NoError(t, err)
+		assert.Equal(t, `a\/(b)`, re.String())
+		assert.Equal(t, "x/$1", repl)
+		assert.True(t, global)
+	})
+
+	t.Run("ignore case flag", func(t *testing.T) {
+		t.Parallel()
+		re, _, global, err := parseRegexSpec("/abc/x/i")
+		require.NoError(t, err)
+		assert.True(t, re.MatchString("ABC"))
+		assert.False(t, global)
+	})
+
+	t.Run("malformed specs", func(t *testing.T) {
+		t.Parallel()
+		for spec, want := range map[string]string{
+			"abc/x":   errRegexSpec.Error(),
+			"/abc":    errRegexSpec.Error(),
+			"//x":     errRegexSpec.Error(),
+			"/a/x/q":  "unknown regex flag q",
+			"/(/x":    "invalid regex: missing closing ): `(`",
+			"/a**/x/": "invalid regex: invalid nested repetition operator: `**`",
+		} {
+			_, _, _, err := parseRegexSpec(spec)
+			require.Error(t, err, spec)
+			assert.EqualError(t, err, want, spec)
+		}
+	})
+}
+
+func TestOpRegexReplace(t *testing.T) {
+	t.Parallel()
+
+	newEngine := func(opts flag.Options) *Engine {
+		return &Engine{Opts: opts, Format: formatter.NewFormatter(false)}
+	}
+
+	t.Run("first match with backrefs", func(t *testing.T) {
+		t.Parallel()
+		out, err := newEngine(flag.Options{}).opRegexReplace("IMG", "~", true, "registry.example.com/team/app:1.2.3", `/^.*:(.*)$/$1`)
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3", out)
+	})
+
+	t.Run("first match only keeps the rest", func(t *testing.T) {
+		t.Parallel()
+		out, err := newEngine(flag.Options{}).opRegexReplace("V", "~", true, "a1b22", `/(\d)/<$1>`)
+		require.NoError(t, err)
+		assert.Equal(t, "a<1>b22", out)
+	})
+
+	t.Run("global", func(t *testing.T) {
+		t.Parallel()
+		out, err := newEngine(flag.Options{}).opRegexReplace("V", "~", true, "a1b22", `/\d+/#/g`)
+		require.NoError(t, err)
+		assert.Equal(t, "a#b#", out)
+	})
+
+	t.Run("no match returns value", func(t *testing.T) {
+		t.Parallel()
+		out, err := newEngine(flag.Options{}).opRegexReplace("V", "~", true, "abc", `/\d/x`)
+		require.NoError(t, err)
+		assert.Equal(t, "abc", out)
+	})
+
+	t.Run("invalid regex is a syntax error", func(t *testing.T) {
+		t.Parallel()
+		_, err := newEngine(flag.Options{}).opRegexReplace("V", "~", true, "abc", "/(/x")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, xerr.ErrSyntax))
+	})
+
+	t.Run("unset follows the usual policy", func(t *testing.T) {
+		t.Parallel()
+		out, err := newEngine(flag.Options{}).opRegexReplace("V", "~", false, "", "/a/b")
+		require.NoError(t, err)
+		assert.Equal(t, "", out)
+
+		out, err = newEngine(flag.Options{KeepUnset: true}).opRegexReplace("V", "~", false, "", "/a/b")
+		require.NoError(t, err)
+		assert.Equal(t, "${V~/a/b}", out)
+
+		_, err = newEngine(flag.Options{ErrorUnset: true}).opRegexReplace("V", "~", false, "", "/a/b")
+		assert.True(t, errors.Is(err, xerr.ErrSubst))
+	})
+
+	t.Run("empty result fails under ErrorEmpty", func(t *testing.T) {
+		t.Parallel()
+		_, err := newEngine(flag.Options{ErrorEmpty: true}).opRegexReplace("V", "~", true, "abc", "/.*/")
+		assert.True(t, errors.Is(err, xerr.ErrEmpty))
+	})
+
+	t.Run("compiled patterns are cached per engine", func(t *testing.T) {
+		t.Parallel()
+		e := newEngine(flag.Options{})
+		for range 3 {
+			_, err := e.opRegexReplace("V", "~", true, "abc", "/b/x/g")
+			require.NoError(t, err)
+		}
+		_, err := e.opRegexReplace("V", "~", true, "abc", "/b/y")
+		require.NoError(t, err)
+		assert.Len(t, e.regexps, 2)
+	})
+}
@@ -1,12 +1,10 @@
 package fsm
 
-import (
-	"strings"
+import "github.com/gi8lino/vex/internal/xerr"
 
-	"github.com/gi8lino/vex/internal/xerr"
-)
-
-// opReplace handles ${VAR/pat/repl} and ${VAR//pat/repl}.
+// opReplace handles ${VAR/pat/repl}, ${VAR//pat/repl} and the anchored
+// forms ${VAR/#pat/repl} and ${VAR/%pat/repl}. Without a replacement, as
+// in ${VAR/pat}, matches are deleted.
 func (e *Engine) opReplace(name, op string, isSet bool, val, spec string) (string, error) {
 	if !isSet {
 		if e.Opts.ErrorUnset {
@@ -18,17 +16,13 @@ func (e *Engine) opReplace(name, op string, isSet bool, val, spec string) (strin
 		return e.Format.OkStr(""), nil // unset→empty; replace on empty stays empty
 	}
 
-	pat, repl, found := strings.Cut(spec, "/")
-	if !found || pat == "" {
+	pat, repl, _ := cutPattern(spec) // no separator: empty replacement
+	anchored := op == "/#" || op == "/%"
+	if pat == "" && !anchored {
 		return e.Format.ErrorStr("${" + name + op + spec + "}"), nil
 	}
 
-	var out string
-	if op == "/" {
-		out = strings.Replace(val, pat, repl, 1) // first only
-	} else {
-		out = strings.ReplaceAll(val, pat, repl) // all
-	}
+	out := replacePattern(op, val, pat, repl)
 
 	if e.Opts.ErrorEmpty && out == "" {
 		return "", xerr.Empty(e.Format.EmptyStr(name))
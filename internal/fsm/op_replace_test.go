@@ -136,6 +136,27 @@ func TestOpReplace(t *testing.T) {
 		assert.Equal(t, "${VAR//repl}", out) // op + spec preserved exactly
 	})
 
+	t.Run("no replacement deletes matches", func(t *testing.T) {
+		t.Parallel()
+
+		e := &Engine{
+			Format: formatter.NewFormatter(false),
+			Label:  label,
+			Opts:   flag.Options{},
+		}
+		out, err := e.opReplace("VAR", "/", true /*isSet*/, "a-b-c", "-")
+		require.NoError(t, err)
+		assert.Equal(t, "ab-c", out)
+
+		out, err = e.opReplace("VAR", "//", true /*isSet*/, "a-b-c", "-")
+		require.NoError(t, err)
+		assert.Equal(t, "abc", out)
+
+		out, err = e.opReplace("VAR", "/%", true /*isSet*/, "a-b-c", "-c")
+		require.NoError(t, err)
+		assert.Equal(t, "a-b", out)
+	})
+
 	t.Run("error when result empty and FailOnEmpty single", func(t *testing.T) {
 		t.Parallel()
 
@@ -1,10 +1,6 @@
 package fsm
 
-import (
-	"strings"
-
-	"github.com/gi8lino/vex/internal/xerr"
-)
+import "github.com/gi8lino/vex/internal/xerr"
 
 // opTrimPrefix implements ${VAR#pat} and ${VAR##pat}.
 func (e *Engine) opTrimPrefix(name, op string, isSet bool, val, pat string) (string, error) {
@@ -20,12 +16,7 @@ func (e *Engine) opTrimPrefix(name, op string, isSet bool, val, pat string) (str
 	if pat == "" {
 		return e.Format.ErrorStr("${" + name + op + pat + "}"), nil
 	}
-	var out string
-	if op == "#" {
-		out = strings.TrimPrefix(val, pat)
-	} else {
-		out = trimPrefixAll(val, pat)
-	}
+	out := trimPattern(op, val, pat)
 	if e.Opts.ErrorEmpty && out == "" {
 		return "", xerr.Empty(e.Format.EmptyStr(name))
 	}
@@ -46,12 +37,7 @@ func (e *Engine) opTrimSuffix(name, op string, isSet bool, val, pat string) (str
 	if pat == "" {
 		return e.Format.ErrorStr("${" + name + op + pat + "}"), nil
 	}
-	var out string
-	if op == "%" {
-		out = strings.TrimSuffix(val, pat)
-	} else {
-		out = trimSuffixAll(val, pat)
-	}
+	out := trimPattern(op, val, pat)
 	if e.Opts.ErrorEmpty && out == "" {
 		return "", xerr.Empty(e.Format.EmptyStr(name))
 	}
@@ -103,13 +103,13 @@ func TestOpTrimPrefix(t *testing.T) {
 		assert.Equal(t, "aab", out)
 	})
 
-	t.Run("trim all when matches prefix repeatedly", func(t *testing.T) {
+	t.Run("trim longest prefix match", func(t *testing.T) {
 		t.Parallel()
 		e := &Engine{
 			Label:  label,
 			Format: formatter.NewFormatter(false),
 		}
-		out, err := e.opTrimPrefix("VAR", "##", true /*isSet*/, "aaab", "a")
+		out, err := e.opTrimPrefix("VAR", "##", true /*isSet*/, "aaab", "*a")
 		require.NoError(t, err)
 		assert.Equal(t, "b", out)
 	})
@@ -134,7 +134,7 @@ func TestOpTrimPrefix(t *testing.T) {
 				ErrorEmpty: true,
 			},
 		}
-		out, err := e.opTrimPrefix("VAR", "##", true /*isSet*/, "aaa", "a")
+		out, err := e.opTrimPrefix("VAR", "##", true /*isSet*/, "aaa", "*a")
 		require.Error(t, err)
 		assert.EqualError(t, err, "substitution empty: VAR")
 		assert.Empty(t, out)
@@ -235,13 +235,13 @@ func TestOpTrimSuffix(t *testing.T) {
 		assert.Equal(t, "baa", out)
 	})
 
-	t.Run("trim all when matches suffix repeatedly", func(t *testing.T) {
+	t.Run("trim longest suffix match", func(t *testing.T) {
 		t.Parallel()
 		e := &Engine{
 			Format: formatter.NewFormatter(false),
 			Label:  label,
 		}
-		out, err := e.opTrimSuffix("VAR", "%%", true /*isSet*/, "baaa", "a")
+		out, err := e.opTrimSuffix("VAR", "%%", true /*isSet*/, "baaa", "a*")
 		require.NoError(t, err)
 		assert.Equal(t, "b", out)
 	})
@@ -266,7 +266,7 @@ func TestOpTrimSuffix(t *testing.T) {
 				ErrorEmpty: true,
 			},
 		}
-		out, err := e.opTrimSuffix("VAR", "%%", true /*isSet*/, "aaa", "a")
+		out, err := e.opTrimSuffix("VAR", "%%", true /*isSet*/, "aaa", "a*")
 		require.Error(t, err)
 		assert.EqualError(t, err, "substitution empty: VAR")
 		assert.Empty(t, out)
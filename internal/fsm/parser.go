@@ -4,19 +4,33 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"regexp"
+	"strings"
 	"sync"
 
 	"github.com/gi8lino/vex/internal/flag"
 	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
 )
 
 // Engine is the top-level expander state machine.
 type Engine struct {
-	Label  string                      // label used in error reporting (e.g., file name)
-	Opts   flag.Options                // parsed CLI options controlling expansion
-	Lookup func(string) (string, bool) // environment lookup (name → value, ok)
-	Setenv func(string, string) error  // environment setter (for := and = operators)
-	Format formatter.Formatter         // formatter (plain/colored)
+	Label   string                             // label used in error reporting (e.g., file name)
+	Opts    flag.Options                       // parsed CLI options controlling expansion
+	Lookup  func(string) (string, bool)        // environment lookup (name → value, ok)
+	Resolve func(string) (string, bool, error) // when set, used instead of Lookup; an error fails the reference
+	Setenv  func(string, string) error         // environment setter (for := and = operators)
+	Format  formatter.Formatter                // formatter (plain/colored)
+	Errs    *xerr.List                         // when set, expansion errors are collected here and expansion continues
+	Visit   func(Ref)                          // when set, references are reported here instead of resolved (analysis only)
+	Names   func() []string                    // enumerates known variable names for ${!PREFIX*}; nil lists none
+	Escape  EscapeFormat                       // --auto-escape: escape resolved values for where they land; EscapeNone disables
+	Match   *Matcher                           // compiled name filter (see NewMatcher); nil compiles one from Opts
+
+	wordAt Pos          // start of the operator word being expanded (for nested positions)
+	tree   *treeBuilder // set while compiling (see Compile)
+
+	regexps map[string]*regexp.Regexp // compiled ${VAR~/re/repl} patterns, cached for the run
 }
 
 // pool for op-word buffers to avoid per-expression allocations
@@ -37,12 +51,33 @@ func (o *smallOp) addByte(c byte) {
 }
 func (o *smallOp) String() string { return string(o.b[:o.n]) }
 
+// extends reports whether c turns the single-char operator so far into a
+// known two-char one; otherwise c starts the word (e.g. ${V%/*}, ${V#/x}).
+func (o *smallOp) extends(c byte) bool {
+	if o.n != 1 {
+		return false
+	}
+	switch string([]byte{o.b[0], c}) {
+	case "##", "%%", "^^", ",,", "//", "/#", "/%", ":-", ":=", ":+", ":?":
+		return true
+	}
+	return false
+}
+
 // contextBuffers holds transient data while parsing a ${...} expression.
 type contextBuffers struct {
 	name  bytes.Buffer  // variable name being parsed
 	op    smallOp       // operator accumulator (no heap)
 	word  *bytes.Buffer // pooled buffer for operator word (may be nil until used)
 	depth int           // nesting depth inside {...} while reading word
+	start Pos           // position of the '$' that opened the expression
+	at    Pos           // position of the first byte of word
+}
+
+// hasName reports whether a variable name (beyond an indirect '!') was read.
+func (b *contextBuffers) hasName() bool {
+	n := b.name.Len()
+	return n > 1 || (n == 1 && b.name.Bytes()[0] != '!')
 }
 
 func (b *contextBuffers) reset() {
@@ -63,12 +98,112 @@ type runCtx struct {
 	e   *Engine       // owning Engine instance
 	w   *bufio.Writer // destination writer for expanded output
 	tok *Tokenizer    // tokenizer producing tokens from input
+	esc *escaper      // lexical context of the output (--auto-escape), nil otherwise
 	b   contextBuffers
 }
 
-// consumeWithTokenizer runs the FSM using a provided tokenizer.
-func (e *Engine) consumeWithTokenizer(tok *Tokenizer, w *bufio.Writer) error {
-	ctx := &runCtx{e: e, w: w, tok: tok}
+// literal writes lit, a piece of the input kept as-is, formatted as error.
+func (ctx *runCtx) literal(lit string) error {
+	if ctx.esc != nil {
+		ctx.esc.feedString(lit)
+	}
+	_, err := ctx.w.WriteString(ctx.e.Format.ErrorStr(lit))
+	return err
+}
+
+// text writes p, a piece of the input that is neither a reference nor an error.
+func (ctx *runCtx) text(p []byte) error {
+	if ctx.esc != nil {
+		ctx.esc.feed(p)
+	}
+	_, err := ctx.w.Write(p)
+	return err
+}
+
+// emit writes the resolved value of the reference lit, escaped for its
+// position under --auto-escape.
+func (ctx *runCtx) emit(val, lit string) error {
+	if ctx.esc == nil {
+		_, err := ctx.w.WriteString(val)
+		return err
+	}
+	defer ctx.esc.value()
+	return writeEscaped(ctx.w, ctx.esc.context(), val, lit)
+}
+
+// simple resolves $VAR or ${VAR} into the output.
+func (ctx *runCtx) simple(v VarRef) error {
+	if ctx.esc == nil {
+		return ctx.e.expandSimple(ctx.w, v)
+	}
+	defer ctx.esc.value()
+	return ctx.e.expandEscaped(ctx.w, v, ctx.esc.context())
+}
+
+// located annotates an expansion error with the position of the current reference.
+// I/O errors and errors that already carry a position pass through unchanged.
+func (ctx *runCtx) located(ref string, err error) error {
+	if err == nil || !xerr.IsExpansion(err) {
+		return err
+	}
+	return xerr.At(ctx.e.Label, ctx.b.start.Line, ctx.b.start.Col, ref, err)
+}
+
+// fail handles an error raised while expanding ref. Without a collector the
+// error ends the run; with one it is recorded, ref is emitted literally
+// (formatted as error) and parsing resumes.
+func (ctx *runCtx) fail(ref string, err error) (stateFn, error) {
+	err = ctx.located(ref, err)
+	if ctx.e.Errs == nil || !xerr.IsExpansion(err) {
+		return nil, err
+	}
+	ctx.e.Errs.Add(err)
+	if werr := ctx.literal(ref); werr != nil {
+		return nil, werr
+	}
+	return stateText, nil
+}
+
+// malformed emits lit (formatted as error) for a reference that cannot be
+// parsed, recording why under --check.
+func (ctx *runCtx) malformed(lit, why string) (stateFn, error) {
+	if ctx.e.Opts.Check && ctx.e.Errs != nil {
+		shown := strings.TrimRight(lit, "\r\n") // keep the report one line per problem
+		ctx.e.Errs.Add(ctx.located(shown, xerr.Syntax(why+": "+shown)))
+	}
+	if err := ctx.literal(lit); err != nil {
+		return nil, err
+	}
+	return stateText, nil
+}
+
+// lint returns what is wrong with an operator form under --check, or "".
+func (ctx *runCtx) lint(op string, word []byte) string {
+	if !ctx.e.Opts.Check || isPrefixList(ctx.b.name.String(), op, word) {
+		return ""
+	}
+	return lintOp(op, word)
+}
+
+// unterminated handles a ${... cut off by EOF: an error under --strict
+// (reported by --check), otherwise the literal is emitted (formatted as error).
+func (ctx *runCtx) unterminated(lit string) (stateFn, error) {
+	if ctx.e.Opts.Strict || ctx.e.Opts.Check {
+		return ctx.fail(lit, xerr.Unterminated(lit))
+	}
+	if err := ctx.literal(lit); err != nil {
+		return nil, err
+	}
+	return nil, ctx.w.Flush()
+}
+
+// consumeWithTokenizer runs the FSM using a provided tokenizer. esc tracks
+// the output context for --auto-escape; nested operator words pass nil.
+func (e *Engine) consumeWithTokenizer(tok *Tokenizer, w *bufio.Writer, esc *escaper) error {
+	ctx := &runCtx{e: e, w: w, tok: tok, esc: esc}
+	if esc != nil {
+		tok.watch = esc.feed
+	}
 	state := stateText
 	for {
 		next, err := state(ctx)
@@ -85,7 +220,15 @@ func (e *Engine) consumeWithTokenizer(tok *Tokenizer, w *bufio.Writer) error {
 // Consume runs the FSM on an input stream and writes expanded output.
 func (e *Engine) Consume(r io.Reader, w *bufio.Writer) error {
 	tok := NewTokenizerWithSize(r, e.Opts.NoEscape, 1<<20)
-	return e.consumeWithTokenizer(tok, w)
+	return e.consumeWithTokenizer(tok, w, e.escaper())
+}
+
+// escaper returns a fresh context tracker under --auto-escape, or nil.
+func (e *Engine) escaper() *escaper {
+	if e.Escape == EscapeNone {
+		return nil
+	}
+	return newEscaper(e.Escape)
 }
 
 // stateText streams text to '$' or EOF using EmitUntilDollar (zero-alloc).
@@ -96,6 +239,7 @@ func stateText(ctx *runCtx) (stateFn, error) {
 	}
 	switch tok.Type {
 	case TOK_DOLLAR:
+		ctx.b.start = tok.Pos
 		return stateAfterDollar, nil
 	case TOK_EOF:
 		return nil, ctx.w.Flush()
@@ -112,27 +256,33 @@ func stateAfterDollar(ctx *runCtx) (stateFn, error) {
 	}
 	switch t.Type {
 	case TOK_LBRACE:
+		start := ctx.b.start
 		ctx.b.reset()
+		ctx.b.start = start
 		return stateBracedName, nil
 	case TOK_NAME:
 		// Avoid building a long-lived string; but expandSimple needs a string today.
 		// This path is single-token name => convert once.
-		if err := ctx.e.expandSimple(ctx.w, BareRef(string(t.Lit))); err != nil {
-			return nil, err
+		v := BareRef(string(t.Lit))
+		if ctx.e.capturing() {
+			return ctx.capture(v, "", nil)
+		}
+		if err := ctx.simple(v); err != nil {
+			return ctx.fail(v.Lit(), err)
 		}
 		return stateText, nil
 	case TOK_EOF:
-		if err := ctx.w.WriteByte('$'); err != nil {
+		if err := ctx.text(dollar); err != nil {
 			return nil, err
 		}
 		return nil, ctx.w.Flush()
 	default:
 		// "$<non-name>" => emit '$' then that literal token (if not EOF)
-		if err := ctx.w.WriteByte('$'); err != nil {
+		if err := ctx.text(dollar); err != nil {
 			return nil, err
 		}
 		if t.Type != TOK_EOF {
-			if _, err := ctx.w.Write(t.Lit); err != nil {
+			if err := ctx.text(t.Lit); err != nil {
 				return nil, err
 			}
 		}
@@ -158,19 +308,39 @@ func stateBracedName(ctx *runCtx) (stateFn, error) {
 			// Keep accumulating name/op; actual dispatch happens on RBRACE.
 			return stateBracedName, nil
 		}
+		if ctx.b.name.Len() == 1 && !ctx.b.hasName() {
+			return ctx.malformed("${!#", "missing variable name")
+		}
 		ctx.b.op.addByte(t.Lit[0])
 		return stateBracedOp, nil
 
-	case TOK_PERCENT, TOK_CARET, TOK_COMMA, TOK_SLASH, TOK_COLON, TOK_OP, TOK_AT:
-		if ctx.b.name.Len() != 0 && !ctx.e.Opts.NoOps {
+	case TOK_PERCENT, TOK_CARET, TOK_COMMA, TOK_SLASH, TOK_COLON, TOK_OP, TOK_AT, TOK_TILDE:
+		if ctx.b.hasName() && !ctx.e.Opts.NoOps {
 			ctx.b.op.addByte(t.Lit[0])
 			return stateBracedOp, nil
 		}
 		// Operators disabled/unexpected → keep literal (format as error).
-		if _, err := ctx.w.WriteString(ctx.e.Format.ErrorStr("${" + ctx.b.name.String() + string(t.Lit))); err != nil {
-			return nil, err
+		why := "missing variable name"
+		if ctx.e.Opts.NoOps {
+			why = "operator not allowed with --no-ops"
 		}
-		return stateText, nil
+		return ctx.malformed("${"+ctx.b.name.String()+string(t.Lit), why)
+
+	case TOK_BANG:
+		// ${!REF...}: indirect expansion; the '!' stays part of the name.
+		if ctx.b.name.Len() == 0 && ctx.b.op.n == 0 && !ctx.e.Opts.NoOps {
+			ctx.b.name.WriteByte('!')
+			return stateBracedName, nil
+		}
+		why := "invalid character in reference"
+		if ctx.e.Opts.NoOps {
+			why = "operator not allowed with --no-ops"
+		}
+		lit := "${" + ctx.b.name.String() + "!"
+		if ctx.b.op.n == 1 && ctx.b.op.b[0] == '#' {
+			lit = "${#" + ctx.b.name.String() + "!"
+		}
+		return ctx.malformed(lit, why)
 
 	case TOK_NAME:
 		_, _ = ctx.b.name.Write(t.Lit)
@@ -180,32 +350,49 @@ func stateBracedName(ctx *runCtx) (stateFn, error) {
 		// Handle the #len sentinel (name must follow later tokens)
 		if ctx.b.op.n == 1 && ctx.b.op.b[0] == '#' && ctx.b.name.Len() == 0 {
 			// "${#}" is not valid -> treat as literal error (consistent behavior)
-			if _, err := ctx.w.WriteString(ctx.e.Format.ErrorStr("${#}")); err != nil {
-				return nil, err
-			}
-			return stateText, nil
+			return ctx.malformed("${#}", "missing variable name")
 		}
 		if ctx.b.op.n == 1 && ctx.b.op.b[0] == '#' && ctx.b.name.Len() > 0 {
+			if ctx.e.capturing() {
+				return ctx.capture(BracedRef(ctx.b.name.String()), "#len", nil)
+			}
+			lit := "${#" + ctx.b.name.String() + "}"
 			val, err := ctx.e.expandWithOp(ctx.b.name.String(), "#len", nil)
-			if err != nil {
-				return nil, err
+			if err == nil {
+				err = ctx.emit(val, lit)
 			}
-			if _, err := ctx.w.WriteString(val); err != nil {
-				return nil, err
+			if err != nil {
+				return ctx.fail(lit, err)
 			}
 			return stateText, nil
 		}
-		if err := ctx.e.expandSimple(ctx.w, BracedRef(ctx.b.name.String())); err != nil {
-			return nil, err
+		if ctx.b.name.Len() == 1 && !ctx.b.hasName() {
+			return ctx.malformed("${!}", "missing variable name")
+		}
+		v := BracedRef(ctx.b.name.String())
+		if ctx.e.capturing() {
+			return ctx.capture(v, "", nil)
+		}
+		if err := ctx.simple(v); err != nil {
+			return ctx.fail(v.Lit(), err)
 		}
 		return stateText, nil
 
+	case TOK_EOF:
+		lit := "${" + ctx.b.name.String()
+		if ctx.b.op.n == 1 && ctx.b.op.b[0] == '#' {
+			lit = "${#" + ctx.b.name.String()
+		}
+		return ctx.unterminated(lit)
+
 	default:
-		// Unexpected token inside braces → keep literal (format as error).
-		if _, err := ctx.w.WriteString(ctx.e.Format.ErrorStr("${" + ctx.b.name.String() + string(t.Lit))); err != nil {
-			return nil, err
+		// ${!PREFIX*} lists names; '*' is not an operator character otherwise.
+		if t.Type == TOK_TEXT && string(t.Lit) == "*" && ctx.b.hasName() && ctx.b.name.Bytes()[0] == '!' {
+			ctx.b.op.addByte('*')
+			return stateBracedOp, nil
 		}
-		return stateText, nil
+		// Unexpected token inside braces → keep literal (format as error).
+		return ctx.malformed("${"+ctx.b.name.String()+string(t.Lit), "invalid character in reference")
 	}
 }
 
@@ -216,9 +403,9 @@ func stateBracedOp(ctx *runCtx) (stateFn, error) {
 		return nil, err
 	}
 	switch t.Type {
-	case TOK_HASH, TOK_PERCENT, TOK_CARET, TOK_COMMA, TOK_SLASH, TOK_COLON, TOK_OP, TOK_AT:
-		// up to 2-char operators; if more arrives, it belongs to word
-		if ctx.b.op.n < 2 {
+	case TOK_HASH, TOK_PERCENT, TOK_CARET, TOK_COMMA, TOK_SLASH, TOK_COLON, TOK_OP, TOK_AT, TOK_TILDE:
+		// longest known operator wins; anything else belongs to word
+		if ctx.b.op.extends(t.Lit[0]) {
 			ctx.b.op.addByte(t.Lit[0])
 			return stateBracedOp, nil
 		}
@@ -227,16 +414,24 @@ func stateBracedOp(ctx *runCtx) (stateFn, error) {
 			ctx.b.word.Reset()
 		}
 		ctx.b.depth = 0
+		ctx.b.at = t.Pos
 		ctx.b.word.Write(t.Lit)
 		return stateBracedWord, nil
 
 	case TOK_RBRACE:
+		if ctx.e.capturing() {
+			return ctx.capture(BracedRef(ctx.b.name.String()), ctx.b.op.String(), nil)
+		}
+		if why := ctx.lint(ctx.b.op.String(), nil); why != "" {
+			return ctx.malformed("${"+ctx.b.name.String()+ctx.b.op.String()+"}", why)
+		}
+		lit := "${" + ctx.b.name.String() + ctx.b.op.String() + "}"
 		val, err := ctx.e.expandWithOp(ctx.b.name.String(), ctx.b.op.String(), nil)
-		if err != nil {
-			return nil, err
+		if err == nil {
+			err = ctx.emit(val, lit)
 		}
-		if _, err := ctx.w.WriteString(val); err != nil {
-			return nil, err
+		if err != nil {
+			return ctx.fail(lit, err)
 		}
 		return stateText, nil
 
@@ -246,6 +441,7 @@ func stateBracedOp(ctx *runCtx) (stateFn, error) {
 			ctx.b.word.Reset()
 		}
 		ctx.b.depth = 0
+		ctx.b.at = t.Pos
 		ctx.b.word.Write(t.Lit)
 		return stateBracedWord, nil
 	}
@@ -269,15 +465,29 @@ func stateBracedWord(ctx *runCtx) (stateFn, error) {
 			ctx.b.word.Write(t.Lit)
 			return stateBracedWord, nil
 		}
+		if ctx.e.capturing() {
+			next, err := ctx.capture(BracedRef(ctx.b.name.String()), ctx.b.op.String(), ctx.b.word.Bytes())
+			wordPool.Put(ctx.b.word)
+			ctx.b.word = nil
+			return next, err
+		}
+		if why := ctx.lint(ctx.b.op.String(), ctx.b.word.Bytes()); why != "" {
+			lit := "${" + ctx.b.name.String() + ctx.b.op.String() + ctx.b.word.String() + "}"
+			wordPool.Put(ctx.b.word)
+			ctx.b.word = nil
+			return ctx.malformed(lit, why)
+		}
+		ctx.e.wordAt = ctx.b.at
 		val, err := ctx.e.expandWithOp(ctx.b.name.String(), ctx.b.op.String(), ctx.b.word.Bytes())
+		ref := "${" + ctx.b.name.String() + ctx.b.op.String() + ctx.b.word.String() + "}"
 		// return word buffer to pool now that we’re done with it
 		wordPool.Put(ctx.b.word)
 		ctx.b.word = nil
-		if err != nil {
-			return nil, err
+		if err == nil {
+			err = ctx.emit(val, ref)
 		}
-		if _, err := ctx.w.WriteString(val); err != nil {
-			return nil, err
+		if err != nil {
+			return ctx.fail(ref, err)
 		}
 		return stateText, nil
 
@@ -286,10 +496,7 @@ func stateBracedWord(ctx *runCtx) (stateFn, error) {
 		lit := "${" + ctx.b.name.String() + ctx.b.op.String() + ctx.b.word.String()
 		wordPool.Put(ctx.b.word)
 		ctx.b.word = nil
-		if _, err := ctx.w.WriteString(ctx.e.Format.ErrorStr(lit)); err != nil {
-			return nil, err
-		}
-		return nil, ctx.w.Flush()
+		return ctx.unterminated(lit)
 
 	default:
 		ctx.b.word.Write(t.Lit)
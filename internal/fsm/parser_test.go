@@ -8,6 +8,7 @@ import (
 
 	"github.com/gi8lino/vex/internal/flag"
 	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -182,7 +183,7 @@ func TestEngineFSM(t *testing.T) {
 				return "", false
 			},
 		}
-		got, err := runFSM(t, e, "${V##a}")
+		got, err := runFSM(t, e, "${V##*a}")
 		require.NoError(t, err)
 		assert.Equal(t, "b", got)
 	})
@@ -247,7 +248,7 @@ func TestEngineFSM(t *testing.T) {
 			Format: formatter.NewFormatter(false),
 			Lookup: func(name string) (string, bool) { return "v", true },
 		}
-		in := "${VAR~x}"
+		in := "${VAR*x}"
 		got, err := runFSM(t, e, in)
 		require.NoError(t, err)
 		assert.Equal(t, in, got)
@@ -263,7 +264,414 @@ func TestEngineFSM(t *testing.T) {
 		}
 		got, err := runFSM(t, e, "${VAR?boom}")
 		require.Error(t, err)
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, "EngineLabel:1:1: VAR: boom")
 		assert.Equal(t, "", got)
 	})
 }
+
+func TestEngineFSMPatterns(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"HOME": "/home/alice", "FILE": "app.tar.gz", "V": "a1b22", "E": ""}
+	e := &Engine{
+		Format: formatter.NewFormatter(false),
+		Lookup: func(k string) (string, bool) { v, ok := env[k]; return v, ok },
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"${HOME#/home/}", "alice"},
+		{"${HOME%/*}", "/home"},
+		{"${HOME##*/}", "alice"},
+		{"${FILE%.*}", "app.tar"},
+		{"${FILE%%.*}", "app"},
+		{"${V//[0-9]/x}", "axbxx"},
+		{"${V/[[:digit:]]/#}", "a#b22"},
+		{"${V/#a/A}", "A1b22"},
+		{"${V/%2/!}", "a1b2!"},
+		{"${V/#/>}", ">a1b22"},
+		{`${HOME//\//:}`, ":home:alice"},
+		{"${E:-/x}", "/x"},
+		{"${E-=x}", ""},
+	}
+	for _, tc := range tests {
+		got, err := runFSM(t, e, tc.in)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, tc.in)
+	}
+}
+
+func TestEngineFSMRegex(t *testing.T) {
+	t.Parallel()
+
+	e := func() *Engine {
+		return &Engine{
+			Label:  "tpl",
+			Format: formatter.NewFormatter(false),
+			Lookup: func(k string) (string, bool) {
+				if k == "IMG" {
+					return "registry.example.com/team/app:1.2.3", true
+				}
+				return "", false
+			},
+		}
+	}
+
+	t.Run("backrefs survive the word", func(t *testing.T) {
+		t.Parallel()
+		got, err := runFSM(t, e(), `${IMG~/^.*:(.*)$/$1} ${IMG~/^([^\/]+)\/.*/${1}}`)
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3 registry.example.com", got)
+	})
+
+	t.Run("invalid regex is positioned", func(t *testing.T) {
+		t.Parallel()
+		_, err := runFSM(t, e(), "ok\n  ${IMG~/(/x}")
+		require.Error(t, err)
+		assert.EqualError(t, err, "tpl:2:3: syntax error: invalid regex: missing closing ): `(`")
+	})
+
+	t.Run("invalid regex is collected under report-all", func(t *testing.T) {
+		t.Parallel()
+		eng := e()
+		eng.Errs = &xerr.List{}
+		got, err := runFSM(t, eng, "${IMG~/(/x} done")
+		require.NoError(t, err)
+		assert.Equal(t, "${IMG~/(/x} done", got)
+		assert.Equal(t, 1, eng.Errs.Len())
+	})
+}
+
+func TestEngineFSMIndirect(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"REF": "TARGET", "TARGET": "value", "EMPTYREF": "", "BAD": "not a name",
+		"APP_B": "2", "APP_A": "1", "OTHER": "x",
+	}
+	newEngine := func(opts flag.Options) *Engine {
+		return &Engine{
+			Label:  "tpl",
+			Opts:   opts,
+			Format: formatter.NewFormatter(false),
+			Lookup: func(k string) (string, bool) { v, ok := env[k]; return v, ok },
+			Names:  func() []string { return []string{"OTHER", "APP_B", "APP_A"} },
+			Setenv: func(string, string) error { return nil },
+		}
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"${!REF}", "value"},
+		{"${!REF^^}", "VALUE"},
+		{"${!REF:-d}", "value"},
+		{"${!REF/a/A}", "vAlue"},
+		{"${#!REF}", "${#!REF}"},
+		{"${!NOPE:-d}", "d"},
+		{"${!EMPTYREF-d}", "d"},
+		{"${!BAD:-d}", "d"},
+		{"${!APP_*}", "APP_A APP_B"},
+		{"${!APP_@}", "APP_A APP_B"},
+		{"${!NONE*}", ""},
+		{"${!}", "${!}"},
+		{"${!#}", "${!#}"},
+		{"${A!}", "${A!}"},
+		{"$!x", "$!x"},
+		{"${U:-wow!}", "wow!"},
+	}
+	for _, tc := range tests {
+		got, err := runFSM(t, newEngine(flag.Options{}), tc.in)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, tc.in)
+	}
+
+	t.Run("unset target reports the reference as written", func(t *testing.T) {
+		t.Parallel()
+		_, err := runFSM(t, newEngine(flag.Options{ErrorUnset: true}), "${!NOPE}")
+		require.Error(t, err)
+		assert.EqualError(t, err, "tpl:1:1: variable not set: ${!NOPE}")
+	})
+
+	t.Run("keep unset keeps the literal", func(t *testing.T) {
+		t.Parallel()
+		got, err := runFSM(t, newEngine(flag.Options{KeepUnset: true}), "${!NOPE}")
+		require.NoError(t, err)
+		assert.Equal(t, "${!NOPE}", got)
+	})
+
+	t.Run("assignment targets the referenced variable", func(t *testing.T) {
+		t.Parallel()
+		e := newEngine(flag.Options{})
+		e.Lookup = func(k string) (string, bool) {
+			if k == "REF" {
+				return "NEW", true
+			}
+			return "", false
+		}
+		var set string
+		e.Setenv = func(k, v string) error { set = k + "=" + v; return nil }
+		got, err := runFSM(t, e, "${!REF:=x}")
+		require.NoError(t, err)
+		assert.Equal(t, "x", got)
+		assert.Equal(t, "NEW=x", set)
+	})
+
+	t.Run("no-ops keeps indirect literal", func(t *testing.T) {
+		t.Parallel()
+		got, err := runFSM(t, newEngine(flag.Options{NoOps: true}), "${!REF}")
+		require.NoError(t, err)
+		assert.Equal(t, "${!", got[:3])
+	})
+}
+
+func TestEngineFSMPositions(t *testing.T) {
+	t.Parallel()
+	const label = "manifest.yaml"
+
+	unset := func(string) (string, bool) { return "", false }
+
+	t.Run("unset error carries line and column", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Label:  label,
+			Opts:   flag.Options{ErrorUnset: true},
+			Format: formatter.NewFormatter(false),
+			Lookup: unset,
+		}
+		_, err := runFSM(t, e, "a: 1\nb: 2\n  c: ${MISSING}\n")
+		require.Error(t, err)
+		assert.EqualError(t, err, "manifest.yaml:3:6: variable not set: ${MISSING}")
+
+		var pe *xerr.PosError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, label, pe.Label)
+		assert.Equal(t, 3, pe.Line)
+		assert.Equal(t, 6, pe.Col)
+		assert.Equal(t, "${MISSING}", pe.Ref)
+		assert.ErrorIs(t, err, xerr.ErrSubst)
+	})
+
+	t.Run("bare reference position", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Label:  label,
+			Opts:   flag.Options{ErrorUnset: true},
+			Format: formatter.NewFormatter(false),
+			Lookup: unset,
+		}
+		_, err := runFSM(t, e, "x\n\tport=$PORT")
+		var pe *xerr.PosError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, 2, pe.Line)
+		assert.Equal(t, 7, pe.Col)
+		assert.Equal(t, "$PORT", pe.Ref)
+	})
+
+	t.Run("user error keeps full reference", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Label:  label,
+			Format: formatter.NewFormatter(false),
+			Lookup: unset,
+		}
+		_, err := runFSM(t, e, "\n  ${DB:?must be set}")
+		require.EqualError(t, err, "manifest.yaml:2:3: DB: must be set")
+
+		var pe *xerr.PosError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, "${DB:?must be set}", pe.Ref)
+		assert.ErrorIs(t, err, xerr.ErrUser)
+	})
+
+	t.Run("nested reference reports inner position", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Label:  label,
+			Opts:   flag.Options{ErrorUnset: true},
+			Format: formatter.NewFormatter(false),
+			Lookup: unset,
+		}
+		_, err := runFSM(t, e, "v=${A:-${B}}")
+		var pe *xerr.PosError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, 1, pe.Line)
+		assert.Equal(t, 8, pe.Col)
+		assert.Equal(t, "${B}", pe.Ref)
+	})
+
+	t.Run("length error position", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Label:  label,
+			Opts:   flag.Options{ErrorUnset: true},
+			Format: formatter.NewFormatter(false),
+			Lookup: unset,
+		}
+		_, err := runFSM(t, e, "n=${#N}")
+		var pe *xerr.PosError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, 3, pe.Col)
+		assert.Equal(t, "${#N}", pe.Ref)
+	})
+
+	t.Run("unterminated is literal without strict", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Label:  label,
+			Format: formatter.NewFormatter(false),
+			Lookup: unset,
+		}
+		got, err := runFSM(t, e, "a ${B:-c")
+		require.NoError(t, err)
+		assert.Equal(t, "a ${B:-c", got)
+	})
+
+	t.Run("unterminated is an error under strict", func(t *testing.T) {
+		t.Parallel()
+		e := &Engine{
+			Label:  label,
+			Opts:   flag.Options{Strict: true},
+			Format: formatter.NewFormatter(false),
+			Lookup: unset,
+		}
+		_, err := runFSM(t, e, "ok\na ${B:-c")
+		require.EqualError(t, err, "manifest.yaml:2:3: unterminated reference: ${B:-c")
+		assert.ErrorIs(t, err, xerr.ErrUnterminated)
+
+		_, err = runFSM(t, e, "${NAME")
+		require.EqualError(t, err, "manifest.yaml:1:1: unterminated reference: ${NAME")
+	})
+}
+
+func TestEngineFSMCollect(t *testing.T) {
+	t.Parallel()
+
+	t.Run("collects every error and keeps going", func(t *testing.T) {
+		t.Parallel()
+		var errs xerr.List
+		e := &Engine{
+			Label:  "f",
+			Opts:   flag.Options{ErrorUnset: true},
+			Format: formatter.NewFormatter(false),
+			Lookup: func(name string) (string, bool) { return "v", name == "OK" },
+			Errs:   &errs,
+		}
+		got, err := runFSM(t, e, "$A ${OK}\n${B:?need b} ${C:-${D}}")
+		require.NoError(t, err)
+		assert.Equal(t, "$A v\n${B:?need b} ${D}", got)
+
+		require.Equal(t, 3, errs.Len())
+		assert.Equal(t, "f:\n"+
+			"  1:1: variable not set: $A\n"+
+			"  2:1: B: need b\n"+
+			"  2:19: variable not set: ${D}\n"+
+			"3 errors in 1 file", errs.Error())
+	})
+
+	t.Run("collects unterminated under strict", func(t *testing.T) {
+		t.Parallel()
+		var errs xerr.List
+		e := &Engine{
+			Label:  "f",
+			Opts:   flag.Options{Strict: true},
+			Format: formatter.NewFormatter(false),
+			Lookup: func(string) (string, bool) { return "", false },
+			Errs:   &errs,
+		}
+		got, err := runFSM(t, e, "x ${A:-b")
+		require.NoError(t, err)
+		assert.Equal(t, "x ${A:-b", got)
+		assert.ErrorIs(t, errs.Err(), xerr.ErrUnterminated)
+	})
+}
+
+func TestEngineFSMCheck(t *testing.T) {
+	t.Parallel()
+
+	check := func(t *testing.T, opts flag.Options, in string) *xerr.List {
+		t.Helper()
+		var errs xerr.List
+		opts.Check = true
+		e := &Engine{
+			Label:  "t",
+			Opts:   opts,
+			Format: formatter.NewFormatter(false),
+			Lookup: func(name string) (string, bool) { return "v", name == "SET" },
+			Setenv: func(string, string) error { return nil },
+			Errs:   &errs,
+		}
+		_, err := runFSM(t, e, in)
+		require.NoError(t, err)
+		return &errs
+	}
+
+	t.Run("valid template has no findings", func(t *testing.T) {
+		t.Parallel()
+		errs := check(t, flag.Options{}, "$SET ${SET:-x} ${SET#v} ${SET@J}")
+		assert.NoError(t, errs.Err())
+	})
+
+	t.Run("reports malformed references", func(t *testing.T) {
+		t.Parallel()
+		errs := check(t, flag.Options{}, "${SET@Z} ${SET%} ${#}\n${:-x} ${SET")
+		assert.Equal(t, "t:\n"+
+			"  1:1: syntax error: unknown quoting mode: ${SET@Z}\n"+
+			"  1:10: syntax error: empty pattern: ${SET%}\n"+
+			"  1:18: syntax error: missing variable name: ${#}\n"+
+			"  2:1: syntax error: missing variable name: ${:\n"+
+			"  2:8: unterminated reference: ${SET\n"+
+			"5 errors in 1 file", errs.Error())
+		assert.True(t, xerr.IsSyntax(errs.Err()))
+	})
+
+	t.Run("reports operators under no-ops", func(t *testing.T) {
+		t.Parallel()
+		errs := check(t, flag.Options{NoOps: true}, "${SET:-x}")
+		assert.EqualError(t, errs.Err(), "t:\n  1:1: syntax error: operator not allowed with --no-ops: ${SET:\n1 error in 1 file")
+	})
+
+	t.Run("reports environment failures under strict", func(t *testing.T) {
+		t.Parallel()
+		errs := check(t, flag.Options{ErrorUnset: true}, "$SET ${MISSING} ${NEED:?set it}")
+		require.Equal(t, 2, errs.Len())
+		assert.False(t, xerr.IsSyntax(errs.Err()))
+		assert.ErrorIs(t, errs.Err(), xerr.ErrSubst)
+		assert.ErrorIs(t, errs.Err(), xerr.ErrUser)
+	})
+}
+
+func TestEngineFSMQuoteModes(t *testing.T) {
+	t.Parallel()
+
+	e := func() *Engine {
+		return &Engine{
+			Label:  "tpl",
+			Format: formatter.NewFormatter(false),
+			Lookup: func(k string) (string, bool) {
+				switch k {
+				case "V":
+					return `a&b "c"`, true
+				case "ENC":
+					return "!!", true
+				}
+				return "", false
+			},
+		}
+	}
+
+	t.Run("chained modes", func(t *testing.T) {
+		t.Parallel()
+		got, err := runFSM(t, e(), "${V@H} ${V@U} ${V@B@J} ${V@B@b}")
+		require.NoError(t, err)
+		assert.Equal(t, `a&amp;b &#34;c&#34; a%26b+%22c%22 "YSZiICJjIg==" a&b "c"`, got)
+	})
+
+	t.Run("invalid base64 is positioned", func(t *testing.T) {
+		t.Parallel()
+		_, err := runFSM(t, e(), "x ${ENC@b}")
+		require.Error(t, err)
+		assert.EqualError(t, err, "tpl:1:3: invalid value: ENC: @b: invalid base64")
+	})
+}
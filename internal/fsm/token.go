@@ -2,6 +2,7 @@ package fsm
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"io"
 )
@@ -25,18 +26,34 @@ const (
 	TOK_HASH                      // '#' (length/trim ops)
 	TOK_PERCENT                   // '%' (trim ops)
 	TOK_AT                        // '@' (quoting ops)
+	TOK_BANG                      // '!' (indirect expansion)
+	TOK_TILDE                     // '~' (regex replace)
 )
 
+// Pos is a location in the input stream.
+type Pos struct {
+	Offset int // 0-based byte offset
+	Line   int // 1-based line
+	Col    int // 1-based byte column
+}
+
+// startPos is the position of the first byte of an input.
+var startPos = Pos{Line: 1, Col: 1}
+
 // Token represents a lexical token with its type and literal bytes.
 type Token struct {
 	Type TokType // token type
 	Lit  []byte  // literal bytes (may be empty for structural tokens)
+	Pos  Pos     // position of the first byte of the token
 }
 
 // Tokenizer reads from a buffered stream and emits Tokens.
 type Tokenizer struct {
 	br       *bufio.Reader // input reader
 	noEscape bool          // whether to disable \$ escape
+	pos      Pos           // position of the next unread byte
+	last     Pos           // position before the last readByte (for unreadByte)
+	watch    func([]byte)  // when set, sees all text written by EmitUntilDollar
 }
 
 // NewTokenizerWithSize constructs a tokenizer with a specific buffer size.
@@ -48,14 +65,56 @@ func NewTokenizerWithSize(r io.Reader, noEscape bool, size int) *Tokenizer {
 	return &Tokenizer{
 		br:       bufio.NewReaderSize(r, size),
 		noEscape: noEscape,
+		pos:      startPos,
+	}
+}
+
+// resetAt points the tokenizer at r, numbering positions from p.
+func (t *Tokenizer) resetAt(r io.Reader, p Pos) {
+	t.br.Reset(r)
+	t.pos = p
+}
+
+// readByte reads one byte and advances the position.
+func (t *Tokenizer) readByte() (byte, error) {
+	b, err := t.br.ReadByte()
+	if err != nil {
+		return b, err
 	}
+	t.last = t.pos
+	t.pos.Offset++
+	if b == '\n' {
+		t.pos.Line++
+		t.pos.Col = 1
+	} else {
+		t.pos.Col++
+	}
+	return b, nil
+}
+
+// unreadByte steps back over the byte returned by the last readByte.
+func (t *Tokenizer) unreadByte() {
+	if t.br.UnreadByte() == nil {
+		t.pos = t.last
+	}
+}
+
+// advance moves the position past p, which was consumed in one read.
+func (t *Tokenizer) advance(p []byte) {
+	t.pos.Offset += len(p)
+	if i := bytes.LastIndexByte(p, '\n'); i >= 0 {
+		t.pos.Line += bytes.Count(p, []byte{'\n'})
+		t.pos.Col = len(p) - i
+		return
+	}
+	t.pos.Col += len(p)
 }
 
 // specialTable builds the sentinel table of bytes considered "special".
 func specialTable() (t [256]bool) {
 	for _, c := range [...]byte{
 		'$', '{', '}', ':', '-', '+', '=', '?', '\\',
-		'^', ',', '/', '#', '%', '@',
+		'^', ',', '/', '#', '%', '@', '!', '~',
 	} {
 		t[c] = true
 	}
@@ -67,7 +126,15 @@ var isSpecial = specialTable()
 
 // Next returns the next token in the stream or TOK_EOF at end of input.
 func (t *Tokenizer) Next() (Token, error) {
-	b, err := t.br.ReadByte()
+	at := t.pos
+	tok, err := t.next()
+	tok.Pos = at
+	return tok, err
+}
+
+// next scans one token; Next stamps it with its start position.
+func (t *Tokenizer) next() (Token, error) {
+	b, err := t.readByte()
 	switch {
 	case err == nil:
 		// Note: this is a hot path; avoid allocating a string for single-char tokens.
@@ -79,13 +146,13 @@ func (t *Tokenizer) Next() (Token, error) {
 
 	// "\$" escape (when enabled) → produce TOK_ESC_DOLLAR
 	if b == '\\' && !t.noEscape {
-		n, err := t.br.ReadByte()
+		n, err := t.readByte()
 		switch {
 		case err == nil:
 			if n == '$' {
 				return Token{Type: TOK_ESC_DOLLAR, Lit: []byte("$")}, nil
 			}
-			_ = t.br.UnreadByte()
+			t.unreadByte()
 		case errors.Is(err, io.EOF):
 			return Token{Type: TOK_TEXT, Lit: []byte{'\\'}}, nil
 		default:
@@ -118,13 +185,17 @@ func (t *Tokenizer) Next() (Token, error) {
 		return Token{Type: TOK_PERCENT, Lit: []byte{'%'}}, nil
 	case '@':
 		return Token{Type: TOK_AT, Lit: []byte{'@'}}, nil
+	case '!':
+		return Token{Type: TOK_BANG, Lit: []byte{'!'}}, nil
+	case '~':
+		return Token{Type: TOK_TILDE, Lit: []byte{'~'}}, nil
 	}
 
 	// NAME token (variable identifiers or digits).
 	if isNameStart(b) || isDigit(b) {
 		name := []byte{b}
 		for {
-			nx, err := t.br.ReadByte()
+			nx, err := t.readByte()
 			if err != nil {
 				if errors.Is(err, io.EOF) {
 					return Token{Type: TOK_NAME, Lit: name}, nil
@@ -135,7 +206,7 @@ func (t *Tokenizer) Next() (Token, error) {
 				name = append(name, nx)
 				continue
 			}
-			_ = t.br.UnreadByte()
+			t.unreadByte()
 			return Token{Type: TOK_NAME, Lit: name}, nil
 		}
 	}
@@ -143,7 +214,7 @@ func (t *Tokenizer) Next() (Token, error) {
 	// TEXT run: accumulate until encountering a special or EOF.
 	text := []byte{b}
 	for {
-		nx, err := t.br.ReadByte()
+		nx, err := t.readByte()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				return Token{Type: TOK_TEXT, Lit: text}, nil
@@ -151,7 +222,7 @@ func (t *Tokenizer) Next() (Token, error) {
 			return Token{}, err
 		}
 		if isSpecial[nx] || isNameStart(nx) || isDigit(nx) {
-			_ = t.br.UnreadByte()
+			t.unreadByte()
 			return Token{Type: TOK_TEXT, Lit: text}, nil
 		}
 		text = append(text, nx)
@@ -162,6 +233,7 @@ func (t *Tokenizer) Next() (Token, error) {
 func (t *Tokenizer) EmitUntilDollar(w *bufio.Writer) (Token, error) {
 	for {
 		chunk, err := t.br.ReadSlice('$') // includes '$' if found
+		t.advance(chunk)
 		switch {
 		case err == nil:
 			// Found '$' at end; decide if it's escaped when escapes are enabled.
@@ -176,10 +248,10 @@ func (t *Tokenizer) EmitUntilDollar(w *bufio.Writer) (Token, error) {
 				if bs%2 == 1 {
 					// Escaped: write prefix up to the backslash, then literal '$', continue.
 					// Example: "abc\$" → write "abc", then '$'.
-					if _, werr := w.Write(chunk[:len(chunk)-2]); werr != nil {
+					if werr := t.emit(w, chunk[:len(chunk)-2]); werr != nil {
 						return Token{}, werr
 					}
-					if err := w.WriteByte('$'); err != nil {
+					if err := t.emit(w, dollar); err != nil {
 						return Token{}, err
 					}
 					continue
@@ -187,16 +259,19 @@ func (t *Tokenizer) EmitUntilDollar(w *bufio.Writer) (Token, error) {
 			}
 			// Unescaped '$': write preceding bytes (not the '$') and return.
 			if len(chunk) > 1 {
-				if _, werr := w.Write(chunk[:len(chunk)-1]); werr != nil {
+				if werr := t.emit(w, chunk[:len(chunk)-1]); werr != nil {
 					return Token{}, werr
 				}
 			}
-			return Token{Type: TOK_DOLLAR, Lit: []byte{'$'}}, nil
+			at := t.pos
+			at.Offset--
+			at.Col--
+			return Token{Type: TOK_DOLLAR, Lit: []byte{'$'}, Pos: at}, nil
 
 		case errors.Is(err, bufio.ErrBufferFull):
 			// No '$' yet; stream the buffer and keep going.
 			if len(chunk) > 0 {
-				if _, werr := w.Write(chunk); werr != nil {
+				if werr := t.emit(w, chunk); werr != nil {
 					return Token{}, werr
 				}
 			}
@@ -205,7 +280,7 @@ func (t *Tokenizer) EmitUntilDollar(w *bufio.Writer) (Token, error) {
 		case errors.Is(err, io.EOF):
 			// EOF: flush remainder and signal EOF.
 			if len(chunk) > 0 {
-				if _, werr := w.Write(chunk); werr != nil {
+				if werr := t.emit(w, chunk); werr != nil {
 					return Token{}, werr
 				}
 			}
@@ -217,6 +292,18 @@ func (t *Tokenizer) EmitUntilDollar(w *bufio.Writer) (Token, error) {
 	}
 }
 
+// dollar is the literal '$' written for an escaped \$.
+var dollar = []byte{'$'}
+
+// emit writes text to w, showing it to watch first.
+func (t *Tokenizer) emit(w *bufio.Writer, p []byte) error {
+	if t.watch != nil {
+		t.watch(p)
+	}
+	_, err := w.Write(p)
+	return err
+}
+
 // isNameStart reports whether a byte can start a variable name.
 func isNameStart(b byte) bool { return (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || b == '_' }
 
@@ -1,6 +1,8 @@
 package fsm
 
 import (
+	"bufio"
+	"bytes"
 	"strings"
 	"testing"
 
@@ -88,8 +90,8 @@ func TestNewTokenizerWithSize(t *testing.T) {
 
 	t.Run("single char tokens all", func(t *testing.T) {
 		t.Parallel()
-		// Sequence covers: $, {, }, :, -, +, =, ?, ^, ,, /, #, %, @
-		input := "${}:-+=?^,/#%@"
+		// Sequence covers: $, {, }, :, -, +, =, ?, ^, ,, /, #, %, @, !, ~
+		input := "${}:-+=?^,/#%@!~"
 		tok := NewTokenizerWithSize(strings.NewReader(input), false, 1<<20)
 
 		expect := []struct {
@@ -110,6 +112,8 @@ func TestNewTokenizerWithSize(t *testing.T) {
 			{TOK_HASH, "#"},
 			{TOK_PERCENT, "%"},
 			{TOK_AT, "@"},
+			{TOK_BANG, "!"},
+			{TOK_TILDE, "~"},
 		}
 
 		for i := range expect {
@@ -174,6 +178,69 @@ func TestNewTokenizerWithSize(t *testing.T) {
 	})
 }
 
+func TestTokenizerPositions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Next stamps line and column", func(t *testing.T) {
+		t.Parallel()
+		tok := NewTokenizerWithSize(strings.NewReader("ab\n${X}"), false, 64)
+
+		t1, err := tok.Next()
+		require.NoError(t, err)
+		assert.Equal(t, Pos{Offset: 0, Line: 1, Col: 1}, t1.Pos)
+
+		t2, err := tok.Next() // "\n" text
+		require.NoError(t, err)
+		assert.Equal(t, Pos{Offset: 2, Line: 1, Col: 3}, t2.Pos)
+
+		t3, err := tok.Next() // '$'
+		require.NoError(t, err)
+		assert.Equal(t, TOK_DOLLAR, t3.Type)
+		assert.Equal(t, Pos{Offset: 3, Line: 2, Col: 1}, t3.Pos)
+
+		t4, err := tok.Next() // '{'
+		require.NoError(t, err)
+		assert.Equal(t, Pos{Offset: 4, Line: 2, Col: 2}, t4.Pos)
+	})
+
+	t.Run("unread restores position", func(t *testing.T) {
+		t.Parallel()
+		tok := NewTokenizerWithSize(strings.NewReader("AB-"), false, 64)
+
+		t1, err := tok.Next() // NAME "AB" unreads '-'
+		require.NoError(t, err)
+		assert.Equal(t, "AB", lit(t, t1))
+
+		t2, err := tok.Next()
+		require.NoError(t, err)
+		assert.Equal(t, TOK_OP, t2.Type)
+		assert.Equal(t, Pos{Offset: 2, Line: 1, Col: 3}, t2.Pos)
+	})
+
+	t.Run("EmitUntilDollar tracks newlines in chunks", func(t *testing.T) {
+		t.Parallel()
+		tok := NewTokenizerWithSize(strings.NewReader("one\ntwo\nthree $X"), false, 64)
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+
+		got, err := tok.EmitUntilDollar(w)
+		require.NoError(t, err)
+		assert.Equal(t, TOK_DOLLAR, got.Type)
+		assert.Equal(t, Pos{Offset: 14, Line: 3, Col: 7}, got.Pos)
+	})
+
+	t.Run("escaped dollar counts both bytes", func(t *testing.T) {
+		t.Parallel()
+		tok := NewTokenizerWithSize(strings.NewReader(`\$a $X`), false, 64)
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+
+		got, err := tok.EmitUntilDollar(w)
+		require.NoError(t, err)
+		assert.Equal(t, Pos{Offset: 4, Line: 1, Col: 5}, got.Pos)
+	})
+}
+
 func TestNameAndDigitHelpers(t *testing.T) {
 	t.Parallel()
 
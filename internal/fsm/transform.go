@@ -89,30 +89,69 @@ func atoiSafe(s string) int {
 	return sign * n
 }
 
-// trimPrefixAll removes repeated matching prefixes until none remain.
-func trimPrefixAll(s, prefix string) string {
-	if prefix == "" {
-		return s
-	}
-	for {
-		var ok bool
-		s, ok = strings.CutPrefix(s, prefix)
-		if !ok {
-			return s
+// trimPattern applies #, ##, % or %% to s. Patterns without glob
+// metacharacters take the literal fast path, where shortest and longest
+// matches coincide.
+func trimPattern(op, s, pat string) string {
+	prefix, longest := op[0] == '#', len(op) == 2
+	if !hasGlobMeta(pat) {
+		if prefix {
+			return strings.TrimPrefix(s, pat)
 		}
+		return strings.TrimSuffix(s, pat)
 	}
+	g := compileGlob(pat)
+	if prefix {
+		return g.trimPrefix(s, longest)
+	}
+	return g.trimSuffix(s, longest)
 }
 
-// trimSuffixAll removes repeated matching suffixes until none remain.
-func trimSuffixAll(s, suffix string) string {
-	if suffix == "" {
+// replacePattern applies /, //, /# or /% to s.
+func replacePattern(op, s, pat, repl string) string {
+	if !hasGlobMeta(pat) {
+		switch op {
+		case "/":
+			if pat == "" {
+				return s
+			}
+			return strings.Replace(s, pat, repl, 1)
+		case "//":
+			if pat == "" {
+				return s
+			}
+			return strings.ReplaceAll(s, pat, repl)
+		case "/#":
+			if rest, ok := strings.CutPrefix(s, pat); ok {
+				return repl + rest
+			}
+		case "/%":
+			if rest, ok := strings.CutSuffix(s, pat); ok {
+				return rest + repl
+			}
+		}
 		return s
 	}
-	for {
-		var ok bool
-		s, ok = strings.CutSuffix(s, suffix)
-		if !ok {
-			return s
+	g := compileGlob(pat)
+	switch op {
+	case "/#":
+		return g.replacePrefix(s, repl)
+	case "/%":
+		return g.replaceSuffix(s, repl)
+	default:
+		return g.replace(s, repl, op == "//")
+	}
+}
+
+// cutPattern splits a replace spec "pat/repl" at the first unescaped '/'.
+func cutPattern(spec string) (pat, repl string, found bool) {
+	for i := 0; i < len(spec); i++ {
+		switch spec[i] {
+		case '\\':
+			i++
+		case '/':
+			return spec[:i], spec[i+1:], true
 		}
 	}
+	return spec, "", false
 }
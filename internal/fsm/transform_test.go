@@ -158,30 +158,77 @@ func TestAtoiSafe(t *testing.T) {
 	})
 }
 
-func TestTrimPrefixAll(t *testing.T) {
+func TestTrimPattern(t *testing.T) {
 	t.Parallel()
 
-	t.Run("removes repeated prefixes", func(t *testing.T) {
-		t.Parallel()
-		assert.Equal(t, "d", trimPrefixAll("aaad", "a"))
-	})
+	tests := []struct {
+		op, s, pat, want string
+	}{
+		{"#", "aaab", "a", "aab"},
+		{"##", "aaab", "a", "aab"}, // literal: shortest == longest
+		{"%", "file.tar.gz", ".*", "file.tar"},
+		{"%%", "file.tar.gz", ".*", "file"},
+		{"#", "/usr/local/bin", "*/", "usr/local/bin"},
+		{"##", "/usr/local/bin", "*/", "bin"},
+		{"%", "/usr/local/bin", "/*", "/usr/local"},
+		{"##", "abc", "x*", "abc"},
+		{"#", "abc", "", "abc"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, trimPattern(tc.op, tc.s, tc.pat), "%s%s on %q", tc.op, tc.pat, tc.s)
+	}
+}
 
-	t.Run("empty pattern no change", func(t *testing.T) {
-		t.Parallel()
-		assert.Equal(t, "abc", trimPrefixAll("abc", ""))
-	})
+func TestReplacePattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		op, s, pat, repl, want string
+	}{
+		{"/", "a1b22", "[0-9]", "x", "ax" + "b22"},
+		{"//", "a1b22", "[0-9]", "x", "axbxx"},
+		{"/", "foo foo", "foo", "bar", "bar foo"},
+		{"//", "foo foo", "foo", "bar", "bar bar"},
+		{"/", "hello world", "o*", "0", "hell0"},
+		{"/#", "foofoo", "foo", "X", "Xfoo"},
+		{"/#", "barfoo", "foo", "X", "barfoo"},
+		{"/%", "foofoo", "foo", "X", "fooX"},
+		{"/#", "abc", "", "X", "Xabc"},
+		{"/%", "abc", "", "X", "abcX"},
+		{"/#", "a-b-c", "*-", "X", "Xc"},
+		{"/%", "a-b-c", "-*", "X", "aX"},
+		{"//", "héllo", "?", "_", "_____"},
+		{"/", "abc", "", "X", "abc"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, replacePattern(tc.op, tc.s, tc.pat, tc.repl), "%s%s/%s on %q", tc.op, tc.pat, tc.repl, tc.s)
+	}
 }
 
-func TestTrimSuffixAll(t *testing.T) {
+func TestCutPattern(t *testing.T) {
 	t.Parallel()
 
-	t.Run("removes repeated suffixes", func(t *testing.T) {
+	t.Run("splits at first slash", func(t *testing.T) {
+		t.Parallel()
+		pat, repl, ok := cutPattern("a/b/c")
+		assert.True(t, ok)
+		assert.Equal(t, "a", pat)
+		assert.Equal(t, "b/c", repl)
+	})
+
+	t.Run("escaped slash belongs to the pattern", func(t *testing.T) {
 		t.Parallel()
-		assert.Equal(t, "b", trimSuffixAll("baaa", "a"))
+		pat, repl, ok := cutPattern(`a\/b/c`)
+		assert.True(t, ok)
+		assert.Equal(t, `a\/b`, pat)
+		assert.Equal(t, "c", repl)
 	})
 
-	t.Run("empty pattern no change", func(t *testing.T) {
+	t.Run("no separator leaves an empty replacement", func(t *testing.T) {
 		t.Parallel()
-		assert.Equal(t, "abc", trimSuffixAll("abc", ""))
+		pat, repl, ok := cutPattern("abc")
+		assert.False(t, ok)
+		assert.Equal(t, "abc", pat)
+		assert.Empty(t, repl)
 	})
 }
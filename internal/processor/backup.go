@@ -0,0 +1,264 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultBackupSuffix names simple backups when --backup is not given, as
+// in GNU cp.
+const defaultBackupSuffix = "~"
+
+// stampLayout formats the time in timestamped backup names; it sorts in
+// time order.
+const stampLayout = "20060102T150405.000Z"
+
+// backup saves the file pe replaces under the name --backup-mode picks.
+// A simple backup it replaces is moved aside to pe.prev until settle, so
+// unbackup can put it back.
+func (p *Processor) backup(pe *pending) error {
+	dir, base, err := p.backupLoc(pe.path)
+	if err != nil {
+		return err
+	}
+	if p.opts.BackupDir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+
+	var name string
+	switch kind := p.backupKind(dir, base); kind {
+	case "numbered":
+		n := 0
+		if list := listBackups(dir, base, kind); len(list) > 0 {
+			n, _ = backupNumber(base, filepath.Base(list[len(list)-1]))
+		}
+		name = base + ".~" + strconv.Itoa(n+1) + "~"
+	case "timestamp":
+		name = base + ".~" + time.Now().UTC().Format(stampLayout) + "~"
+	default:
+		name = base + p.backupSuffix()
+	}
+	bak := filepath.Join(dir, name)
+	if _, err := os.Lstat(bak); err == nil { // simple backups replace the previous one
+		prev, err := aside(bak)
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		pe.prev = prev
+	}
+	pe.bak = bak
+	if err := os.Link(pe.path, bak); err != nil {
+		if err := copyFile(pe.path, bak, pe.info.Mode()); err != nil { // fallback to copy
+			pe.unbackup()
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+	return nil
+}
+
+// aside renames name to a free name next to it and returns that name.
+func aside(name string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".vex-prev-*")
+	if err != nil {
+		return "", err
+	}
+	_ = f.Close()
+	if err := os.Rename(name, f.Name()); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// unbackup removes the backup backup made for pe and puts back the one it
+// replaced.
+func (pe *pending) unbackup() {
+	if pe.bak != "" {
+		_ = os.Remove(pe.bak)
+	}
+	if pe.prev != "" {
+		_ = os.Rename(pe.prev, pe.bak)
+	}
+	pe.bak, pe.prev = "", ""
+}
+
+// prune drops the oldest numbered or timestamped backups of path beyond
+// --backup-keep.
+func (p *Processor) prune(path string) {
+	keep := p.opts.BackupKeep
+	if keep <= 0 || !p.opts.Backups() {
+		return
+	}
+	dir, base, err := p.backupLoc(path)
+	if err != nil {
+		return
+	}
+	if kind := p.backupKind(dir, base); kind != "simple" {
+		list := listBackups(dir, base, kind)
+		for _, old := range list[:max(len(list)-keep, 0)] {
+			_ = os.Remove(old) // best-effort
+		}
+	}
+}
+
+// Restore replaces path with its most recent backup (--restore) and removes
+// that backup, so restoring again steps back through numbered or
+// timestamped backups. Backups are looked up with the --backup* flags the
+// edit used. Like an in-place edit, the file keeps its owner and extended
+// attributes, and a symlink is only followed with --follow-symlinks.
+func (p *Processor) Restore(path string) error {
+	target, err := p.target(path)
+	if err != nil {
+		return err
+	}
+	dir, base, err := p.backupLoc(target) // backups are made of the target
+	if err != nil {
+		return err
+	}
+	var bak string
+	switch kind := p.backupKind(dir, base); kind {
+	case "numbered", "timestamp":
+		if list := listBackups(dir, base, kind); len(list) > 0 {
+			bak = list[len(list)-1]
+		}
+	default:
+		if _, err := os.Lstat(filepath.Join(dir, base+p.backupSuffix())); err == nil {
+			bak = filepath.Join(dir, base+p.backupSuffix())
+		}
+	}
+	if bak == "" {
+		return fmt.Errorf("%s: no backup found in %s", path, dir)
+	}
+
+	in, err := os.Open(bak)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// replace the file like an in-place edit, without backing it up
+	pe, err := p.stage(target, func(_ *pending, _ io.Reader, tmp io.Writer) (bool, error) {
+		_, err := io.Copy(tmp, in)
+		return err == nil, err
+	})
+	if err != nil {
+		return err
+	}
+	if err := p.replace(pe, info.ModTime()); err != nil {
+		pe.discard()
+		return err
+	}
+	return os.Remove(bak)
+}
+
+// backupLoc returns the directory the backups of path live in and the base
+// name they start with. Under --backup-dir, the absolute path of path's
+// directory is mirrored below it, so files of the same name do not clash.
+func (p *Processor) backupLoc(path string) (string, string, error) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	if p.opts.BackupDir == "" {
+		return dir, base, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(p.opts.BackupDir, strings.TrimPrefix(abs, filepath.VolumeName(abs))), base, nil
+}
+
+// backupKind resolves --backup-mode for the file base in dir to simple,
+// numbered or timestamp.
+func (p *Processor) backupKind(dir, base string) string {
+	switch p.opts.BackupMode {
+	case "numbered", "timestamp":
+		return p.opts.BackupMode
+	case "existing":
+		if len(listBackups(dir, base, "numbered")) > 0 {
+			return "numbered"
+		}
+	}
+	return "simple"
+}
+
+// backupSuffix returns the suffix of simple backups.
+func (p *Processor) backupSuffix() string {
+	if p.opts.BackupExt != "" {
+		return p.opts.BackupExt
+	}
+	return defaultBackupSuffix
+}
+
+// listBackups returns the numbered or timestamped backups of the file base
+// in dir, oldest first.
+func listBackups(dir, base, kind string) []string {
+	entries, _ := os.ReadDir(dir) // a missing directory holds no backups
+	type backup struct {
+		path string
+		n    int
+	}
+	var list []backup
+	for _, e := range entries {
+		b := backup{path: filepath.Join(dir, e.Name())}
+		var ok bool
+		if kind == "numbered" {
+			b.n, ok = backupNumber(base, e.Name())
+		} else {
+			ok = backupStamped(base, e.Name())
+		}
+		if ok {
+			list = append(list, b)
+		}
+	}
+	// numbered backups sort by number, timestamped ones by name
+	slices.SortFunc(list, func(a, b backup) int {
+		if a.n != b.n {
+			return a.n - b.n
+		}
+		return strings.Compare(a.path, b.path)
+	})
+	out := make([]string, len(list))
+	for i, b := range list {
+		out[i] = b.path
+	}
+	return out
+}
+
+// backupNumber returns N if name is base.~N~.
+func backupNumber(base, name string) (int, bool) {
+	s, ok := backupTag(base, name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n > 0 && strconv.Itoa(n) == s
+}
+
+// backupStamped reports whether name is base.~TIME~.
+func backupStamped(base, name string) bool {
+	s, ok := backupTag(base, name)
+	if !ok {
+		return false
+	}
+	_, err := time.Parse(stampLayout, s)
+	return err == nil
+}
+
+// backupTag returns X if name is base.~X~.
+func backupTag(base, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, base+".~")
+	if !ok {
+		return "", false
+	}
+	return strings.CutSuffix(rest, "~")
+}
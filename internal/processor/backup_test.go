@@ -0,0 +1,209 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backupNames returns the names of the entries of dir other than keep.
+func backupNames(t *testing.T, dir, keep string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var out []string
+	for _, e := range entries {
+		if e.Name() != keep {
+			out = append(out, e.Name())
+		}
+	}
+	return out
+}
+
+func TestBackup(t *testing.T) {
+	t.Parallel()
+
+	// edit writes content followed by $X to path and edits it in place.
+	edit := func(t *testing.T, opts flag.Options, path, content string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(path, []byte(content+"$X"), 0o600))
+		lookup := func(string) (string, bool) { return "!", true }
+		p := NewProcessor(opts, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessInPlace(path, testBufSize))
+	}
+	read := func(t *testing.T, path string) string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("simple replaces the previous backup", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.conf")
+		opts := flag.Options{BackupMode: "simple"}
+		edit(t, opts, path, "one")
+		edit(t, opts, path, "two")
+
+		assert.Equal(t, []string{"app.conf~"}, backupNames(t, dir, "app.conf"))
+		assert.Equal(t, "two$X", read(t, path+"~"))
+	})
+
+	t.Run("numbered keeps every original", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.conf")
+		opts := flag.Options{BackupMode: "numbered"}
+		for _, c := range []string{"one", "two", "three"} {
+			edit(t, opts, path, c)
+		}
+
+		assert.Equal(t, []string{"app.conf.~1~", "app.conf.~2~", "app.conf.~3~"}, backupNames(t, dir, "app.conf"))
+		assert.Equal(t, "one$X", read(t, path+".~1~"))
+		assert.Equal(t, "three$X", read(t, path+".~3~"))
+	})
+
+	t.Run("numbered with keep drops the oldest", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.conf")
+		opts := flag.Options{BackupMode: "numbered", BackupKeep: 2}
+		for _, c := range []string{"one", "two", "three"} {
+			edit(t, opts, path, c)
+		}
+
+		assert.Equal(t, []string{"app.conf.~2~", "app.conf.~3~"}, backupNames(t, dir, "app.conf"))
+	})
+
+	t.Run("existing follows the backups present", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		simple, numbered := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+		require.NoError(t, os.WriteFile(numbered+".~4~", []byte("old"), 0o600))
+
+		opts := flag.Options{BackupMode: "existing", BackupExt: ".bak"}
+		edit(t, opts, simple, "a")
+		edit(t, opts, numbered, "b")
+
+		assert.Equal(t, []string{"a.bak", "b", "b.~4~", "b.~5~"}, backupNames(t, dir, "a"))
+		assert.Equal(t, "b$X", read(t, numbered+".~5~"))
+	})
+
+	t.Run("timestamp with keep", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.conf")
+		// older backups, as written by earlier runs
+		for _, stamp := range []string{"20240101T000000.000Z", "20250101T000000.000Z"} {
+			require.NoError(t, os.WriteFile(path+".~"+stamp+"~", []byte(stamp), 0o600))
+		}
+		edit(t, flag.Options{BackupMode: "timestamp", BackupKeep: 2}, path, "now")
+
+		names := backupNames(t, dir, "app.conf")
+		require.Len(t, names, 2)
+		assert.Equal(t, "app.conf.~20250101T000000.000Z~", names[0])
+		assert.True(t, strings.HasPrefix(names[1], "app.conf.~20"), names[1])
+		assert.Equal(t, "now$X", read(t, filepath.Join(dir, names[1])))
+	})
+
+	t.Run("backup-dir mirrors the file's directory", func(t *testing.T) {
+		t.Parallel()
+		dir, bdir := t.TempDir(), t.TempDir()
+		path := filepath.Join(dir, "app.conf")
+		edit(t, flag.Options{BackupDir: bdir}, path, "one")
+
+		abs, err := filepath.Abs(dir)
+		require.NoError(t, err)
+		assert.Equal(t, "one$X", read(t, filepath.Join(bdir, abs, "app.conf~")))
+		assert.Empty(t, backupNames(t, dir, "app.conf"))
+	})
+}
+
+func TestRestore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("numbered steps back", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.conf")
+		require.NoError(t, os.WriteFile(path, []byte("current"), 0o640))
+		require.NoError(t, os.WriteFile(path+".~1~", []byte("first"), 0o600))
+		require.NoError(t, os.WriteFile(path+".~2~", []byte("second"), 0o600))
+
+		p := NewProcessor(flag.Options{BackupMode: "numbered"}, nil, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.Restore(path))
+		got, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(got))
+		assert.Equal(t, []string{"app.conf.~1~"}, backupNames(t, dir, "app.conf"))
+
+		require.NoError(t, p.Restore(path))
+		got, err = os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "first", string(got))
+
+		err = p.Restore(path)
+		require.Error(t, err)
+		assert.EqualError(t, err, path+": no backup found in "+dir)
+	})
+
+	t.Run("through a symlink", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks need privileges on Windows")
+		}
+		dir := t.TempDir()
+		target, link := filepath.Join(dir, "real", "app.conf"), filepath.Join(dir, "app.conf")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0o755))
+		require.NoError(t, os.WriteFile(target, []byte("edited"), 0o640))
+		require.NoError(t, os.WriteFile(target+".bak", []byte("original"), 0o600))
+		require.NoError(t, os.Symlink(filepath.Join("real", "app.conf"), link))
+
+		p := NewProcessor(flag.Options{BackupExt: ".bak"}, nil, nil, nil, formatter.NewFormatter(false), testBufSize)
+		err := p.Restore(link)
+		require.Error(t, err)
+		assert.EqualError(t, err, link+": is a symlink; use --follow-symlinks to edit its target")
+
+		p = NewProcessor(flag.Options{BackupExt: ".bak", FollowSymlinks: true}, nil, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.Restore(link))
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink, "the link is kept")
+		got, err := os.ReadFile(link)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(got))
+		info, err = os.Stat(target)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm(), "the restored file keeps the current mode")
+		assert.NoFileExists(t, target+".bak")
+	})
+
+	t.Run("simple from backup-dir", func(t *testing.T) {
+		t.Parallel()
+		dir, bdir := t.TempDir(), t.TempDir()
+		path := filepath.Join(dir, "app.conf")
+		require.NoError(t, os.WriteFile(path, []byte("edited"), 0o600))
+
+		opts := flag.Options{BackupExt: ".bak", BackupDir: bdir}
+		p := NewProcessor(opts, nil, nil, nil, formatter.NewFormatter(false), testBufSize)
+		loc, _, err := p.backupLoc(path)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(loc, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(loc, "app.conf.bak"), []byte("original"), 0o600))
+
+		require.NoError(t, p.Restore(path))
+		got, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(got))
+		assert.NoFileExists(t, filepath.Join(loc, "app.conf.bak"))
+	})
+}
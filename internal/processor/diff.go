@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/gi8lino/vex/internal/diff"
+)
+
+// DiffFiles renders paths as ProcessInPlace would but writes nothing back:
+// for every file that would change it prints a unified diff (--diff) or
+// its name (--dry-run) to out. It returns the number of such files. Under
+// --report-all, files with expansion errors are skipped. The output for the
+// files before a failing one is still written.
+func (p *Processor) DiffFiles(paths []string, out *bufio.Writer, bufSize int) (changed int, err error) {
+	defer func() { err = errors.Join(err, out.Flush()) }()
+	for _, path := range paths {
+		orig, rendered, ok, err := p.preview(path, bufSize)
+		if err != nil {
+			return changed, err
+		}
+		if !ok {
+			continue
+		}
+		changed++
+		if p.opts.Diff {
+			_, err = out.Write(diff.Unified(path, path, orig, rendered, p.opts.Colored))
+		} else {
+			_, err = out.WriteString(path + "\n")
+		}
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// preview renders path like prepare, into memory, and returns the original
+// and rendered contents. ok is false when the edit would leave the file
+// untouched.
+func (p *Processor) preview(path string, bufSize int) (orig, rendered []byte, ok bool, err error) {
+	_, src, err := p.open(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer func() { _ = src.Close() }()
+
+	var in, out bytes.Buffer
+	same, ok, err := p.render(path, io.TeeReader(src, &in), &out, bufSize)
+	if err != nil || !ok || same {
+		return nil, nil, false, err
+	}
+	return in.Bytes(), out.Bytes(), true, nil
+}
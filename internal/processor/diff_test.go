@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffFiles(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(k string) (string, bool) { return "1", k == "A" }
+
+	// setup writes a changing and an unchanged file and returns their paths.
+	setup := func(t *testing.T) (string, string) {
+		t.Helper()
+		dir := t.TempDir()
+		changing, static := filepath.Join(dir, "a.conf"), filepath.Join(dir, "b.conf")
+		require.NoError(t, os.WriteFile(changing, []byte("a=$A\nb=2\n"), 0o644))
+		require.NoError(t, os.WriteFile(static, []byte("static\n"), 0o644))
+		return changing, static
+	}
+
+	t.Run("diff", func(t *testing.T) {
+		t.Parallel()
+		changing, static := setup(t)
+		p := NewProcessor(flag.Options{Diff: true, BackupExt: ".bak"}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		var out bytes.Buffer
+		n, err := p.DiffFiles([]string{changing, static}, bufio.NewWriter(&out), testBufSize)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, "--- "+changing+"\n+++ "+changing+"\n@@ -1,2 +1,2 @@\n-a=$A\n+a=1\n b=2\n", out.String())
+
+		b, err := os.ReadFile(changing)
+		require.NoError(t, err)
+		assert.Equal(t, "a=$A\nb=2\n", string(b), "file is untouched")
+		assert.NoFileExists(t, changing+".bak")
+	})
+
+	t.Run("output before a failing file is kept", func(t *testing.T) {
+		t.Parallel()
+		changing, _ := setup(t)
+		bad := filepath.Join(filepath.Dir(changing), "bad.conf")
+		require.NoError(t, os.WriteFile(bad, []byte("$MISSING"), 0o644))
+		p := NewProcessor(flag.Options{DryRun: true, ErrorUnset: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		var out bytes.Buffer
+		n, err := p.DiffFiles([]string{changing, bad}, bufio.NewWriter(&out), testBufSize)
+		require.Error(t, err)
+		assert.True(t, xerr.IsExpansion(err))
+		assert.Equal(t, 1, n)
+		assert.Equal(t, changing+"\n", out.String())
+	})
+
+	t.Run("dry-run lists changed files", func(t *testing.T) {
+		t.Parallel()
+		changing, static := setup(t)
+		p := NewProcessor(flag.Options{DryRun: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		var out bytes.Buffer
+		n, err := p.DiffFiles([]string{static, changing}, bufio.NewWriter(&out), testBufSize)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, changing+"\n", out.String())
+	})
+
+	t.Run("expansion error", func(t *testing.T) {
+		t.Parallel()
+		changing, _ := setup(t)
+		p := NewProcessor(flag.Options{Diff: true, ErrorUnset: true}, func(string) (string, bool) { return "", false }, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		var out bytes.Buffer
+		_, err := p.DiffFiles([]string{changing}, bufio.NewWriter(&out), testBufSize)
+		require.Error(t, err)
+		assert.True(t, xerr.IsExpansion(err))
+	})
+
+	t.Run("report-all skips failing files", func(t *testing.T) {
+		t.Parallel()
+		changing, _ := setup(t)
+		bad := filepath.Join(filepath.Dir(changing), "bad.conf")
+		require.NoError(t, os.WriteFile(bad, []byte("$MISSING"), 0o644))
+		p := NewProcessor(flag.Options{DryRun: true, ErrorUnset: true, ReportAll: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		var out bytes.Buffer
+		n, err := p.DiffFiles([]string{bad, changing}, bufio.NewWriter(&out), testBufSize)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, changing+"\n", out.String())
+		require.Error(t, p.Report())
+	})
+
+	t.Run("symlinks are refused like in-place edits", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks need privileges on Windows")
+		}
+		changing, _ := setup(t)
+		link := filepath.Join(filepath.Dir(changing), "link.conf")
+		require.NoError(t, os.Symlink(filepath.Base(changing), link))
+
+		opts := flag.Options{Diff: true}
+		p := NewProcessor(opts, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		var out bytes.Buffer
+		_, err := p.DiffFiles([]string{link}, bufio.NewWriter(&out), testBufSize)
+		require.Error(t, err)
+		assert.EqualError(t, err, link+": is a symlink; use --follow-symlinks to edit its target")
+		assert.EqualError(t, p.ProcessInPlace(link, testBufSize), err.Error(), "the preview fails as the edit does")
+		assert.Empty(t, out.String())
+
+		opts.FollowSymlinks = true
+		p = NewProcessor(opts, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		n, err := p.DiffFiles([]string{link}, bufio.NewWriter(&out), testBufSize)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, "--- "+link+"\n+++ "+link+"\n@@ -1,2 +1,2 @@\n-a=$A\n+a=1\n b=2\n", out.String())
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+		p := NewProcessor(flag.Options{Diff: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		_, err := p.DiffFiles([]string{"/does/not/exist"}, bufio.NewWriter(&bytes.Buffer{}), testBufSize)
+		require.Error(t, err)
+		assert.EqualError(t, err, "open /does/not/exist: no such file or directory")
+	})
+}
@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/gi8lino/vex/internal/fsm"
+)
+
+// VarUsage summarizes how one variable is referenced across inputs.
+type VarUsage struct {
+	Name        string       `json:"name"`
+	Default     bool         `json:"default"`   // every occurrence supplies a default
+	Operators   []string     `json:"operators"` // distinct operators in first-seen order
+	Occurrences []Occurrence `json:"occurrences"`
+}
+
+// Occurrence is a single reference to a variable.
+type Occurrence struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Operator string `json:"operator,omitempty"`
+	Default  bool   `json:"default"`
+}
+
+// ListVars parses paths (or in, when paths is empty) without resolving
+// anything and returns the referenced variables in first-seen order.
+// References inside operator words (e.g. ${A:-${B}}) are included.
+func (p *Processor) ListVars(paths []string, in io.Reader, bufSize int) ([]VarUsage, error) {
+	var usages []VarUsage
+	index := make(map[string]int)
+
+	scan := func(label string, r io.Reader) error {
+		eng := &fsm.Engine{
+			Label:  label,
+			Opts:   p.optsFor(label),
+			Format: p.formatter,
+			Errs:   p.report,
+			Match:  p.match,
+			Visit: func(ref fsm.Ref) {
+				i, ok := index[ref.Name]
+				if !ok {
+					i = len(usages)
+					index[ref.Name] = i
+					usages = append(usages, VarUsage{Name: ref.Name, Default: true, Operators: []string{}})
+				}
+				u := &usages[i]
+				u.Default = u.Default && ref.Default
+				if ref.Op != "" && !slices.Contains(u.Operators, ref.Op) {
+					u.Operators = append(u.Operators, ref.Op)
+				}
+				u.Occurrences = append(u.Occurrences, Occurrence{
+					File:     label,
+					Line:     ref.Pos.Line,
+					Column:   ref.Pos.Col,
+					Operator: ref.Op,
+					Default:  ref.Default,
+				})
+			},
+		}
+		return eng.Consume(r, bufio.NewWriterSize(io.Discard, bufSize))
+	}
+
+	if len(paths) == 0 {
+		if err := scan("<stdin>", in); err != nil {
+			return nil, err
+		}
+		return usages, nil
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = scan(path, bufio.NewReaderSize(f, bufSize))
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return usages, nil
+}
+
+// WriteVarList writes one variable name per line, or the full usages as JSON.
+func WriteVarList(w io.Writer, usages []VarUsage, asJSON bool) error {
+	if asJSON {
+		if usages == nil {
+			usages = []VarUsage{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(usages)
+	}
+	bw := bufio.NewWriter(w)
+	for _, u := range usages {
+		if _, err := bw.WriteString(u.Name + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
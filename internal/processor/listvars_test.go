@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListVars(t *testing.T) {
+	t.Parallel()
+
+	newProc := func(opts flag.Options) *Processor {
+		return NewProcessor(opts, nil, nil, nil, formatter.NewFormatter(false), testBufSize)
+	}
+
+	t.Run("stdin lists unique names in order", func(t *testing.T) {
+		t.Parallel()
+		p := newProc(flag.Options{})
+		usages, err := p.ListVars(nil, strings.NewReader("$B ${A:-x} $B ${C:-${A}}"), testBufSize)
+		require.NoError(t, err)
+
+		var names []string
+		for _, u := range usages {
+			names = append(names, u.Name)
+		}
+		assert.Equal(t, []string{"B", "A", "C"}, names)
+
+		assert.False(t, usages[1].Default, "A is also used without default")
+		assert.Equal(t, []string{":-"}, usages[1].Operators)
+		assert.Len(t, usages[1].Occurrences, 2)
+		assert.True(t, usages[2].Default)
+		assert.Equal(t, "<stdin>", usages[0].Occurrences[0].File)
+	})
+
+	t.Run("files record per-file occurrences", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		a := filepath.Join(dir, "a.txt")
+		b := filepath.Join(dir, "b.txt")
+		require.NoError(t, os.WriteFile(a, []byte("${X}"), 0o600))
+		require.NoError(t, os.WriteFile(b, []byte("\n  ${X:=1}"), 0o600))
+
+		p := newProc(flag.Options{})
+		usages, err := p.ListVars([]string{a, b}, nil, testBufSize)
+		require.NoError(t, err)
+		require.Len(t, usages, 1)
+		assert.Equal(t, []Occurrence{
+			{File: a, Line: 1, Column: 1},
+			{File: b, Line: 2, Column: 3, Operator: ":=", Default: true},
+		}, usages[0].Occurrences)
+	})
+
+	t.Run("missing file is an error", func(t *testing.T) {
+		t.Parallel()
+		p := newProc(flag.Options{})
+		_, err := p.ListVars([]string{filepath.Join(t.TempDir(), "nope")}, nil, testBufSize)
+		require.Error(t, err)
+	})
+}
+
+func TestWriteVarList(t *testing.T) {
+	t.Parallel()
+
+	usages := []VarUsage{
+		{Name: "A", Default: true, Operators: []string{":-"}, Occurrences: []Occurrence{{File: "<stdin>", Line: 1, Column: 1, Operator: ":-", Default: true}}},
+		{Name: "B", Operators: []string{}, Occurrences: []Occurrence{{File: "<stdin>", Line: 1, Column: 9}}},
+	}
+
+	t.Run("plain prints names", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		require.NoError(t, WriteVarList(&out, usages, false))
+		assert.Equal(t, "A\nB\n", out.String())
+	})
+
+	t.Run("json prints details", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		require.NoError(t, WriteVarList(&out, usages[1:], true))
+		assert.JSONEq(t, `[{"name":"B","default":false,"operators":[],"occurrences":[{"file":"<stdin>","line":1,"column":9,"default":false}]}]`, out.String())
+	})
+
+	t.Run("json of nothing is an empty list", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		require.NoError(t, WriteVarList(&out, nil, true))
+		assert.Equal(t, "[]\n", out.String())
+	})
+}
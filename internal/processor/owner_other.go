@@ -0,0 +1,8 @@
+//go:build !unix
+
+package processor
+
+import "io/fs"
+
+// chown is a no-op where files have no unix owner.
+func chown(string, fs.FileInfo) error { return nil }
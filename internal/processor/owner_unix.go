@@ -0,0 +1,28 @@
+//go:build unix
+
+package processor
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// chown gives the file name the owner and group of info, as far as
+// permitted: without privileges, only the group may change, and only to
+// one the user belongs to.
+func chown(name string, info fs.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := os.Chown(name, int(st.Uid), int(st.Gid))
+	if errors.Is(err, fs.ErrPermission) {
+		err = os.Chown(name, -1, int(st.Gid))
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChown(t *testing.T) {
+	t.Parallel()
+
+	t.Run("in-place edits keep owner and group", func(t *testing.T) {
+		t.Parallel()
+		if os.Geteuid() != 0 {
+			t.Skip("changing the owner needs root")
+		}
+		path := filepath.Join(t.TempDir(), "app.conf")
+		require.NoError(t, os.WriteFile(path, []byte("v=$V"), 0o640))
+		require.NoError(t, os.Chown(path, 1234, 5678))
+
+		p := NewProcessor(flag.Options{}, func(string) (string, bool) { return "x", true }, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessInPlace(path, testBufSize))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		st := info.Sys().(*syscall.Stat_t)
+		assert.Equal(t, uint32(1234), st.Uid)
+		assert.Equal(t, uint32(5678), st.Gid)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	})
+
+	t.Run("an owner that cannot be set is not an error", func(t *testing.T) {
+		t.Parallel()
+		if os.Geteuid() == 0 {
+			t.Skip("root may set any owner")
+		}
+		dir := t.TempDir()
+		src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+		require.NoError(t, os.WriteFile(src, nil, 0o600))
+		require.NoError(t, os.WriteFile(dst, nil, 0o600))
+		info, err := os.Stat(src)
+		require.NoError(t, err)
+		info.Sys().(*syscall.Stat_t).Uid = 0 // pretend src belongs to root
+
+		require.NoError(t, chown(dst, info))
+	})
+}
@@ -9,12 +9,18 @@ import (
 
 // ProcessStream runs the FSM on the given reader and writer and flushes the writer.
 func (p *Processor) ProcessStream(label string, r io.Reader, w *bufio.Writer) error {
+	opts := p.optsFor(label)
 	eng := &fsm.Engine{
-		Label:  label,
-		Opts:   p.opts,
-		Lookup: p.lookup,
-		Setenv: p.setenv,
-		Format: p.formatter,
+		Label:   label,
+		Opts:    opts,
+		Lookup:  p.lookup,
+		Resolve: p.resolve,
+		Names:   p.names,
+		Setenv:  p.setenv,
+		Format:  p.formatter,
+		Errs:    p.report,
+		Escape:  escapeFor(opts, label),
+		Match:   p.match,
 	}
 	if err := eng.Consume(r, w); err != nil {
 		return err
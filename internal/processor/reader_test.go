@@ -6,8 +6,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/gi8lino/vex/internal/config"
 	"github.com/gi8lino/vex/internal/flag"
 	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,6 +30,7 @@ func TestProcessStream(t *testing.T) {
 				}
 				return "", false
 			},
+			nil,
 			nil, // no Setenv needed
 			formatter.NewFormatter(false),
 			testBufSize,
@@ -42,6 +45,26 @@ func TestProcessStream(t *testing.T) {
 		assert.Equal(t, "hello Ada", out.String())
 	})
 
+	t.Run("resolve takes precedence and fails the reference", func(t *testing.T) {
+		t.Parallel()
+
+		p := NewProcessor(flag.Options{}, func(string) (string, bool) { return "lookup", true }, nil, nil, formatter.NewFormatter(false), testBufSize)
+		p.SetResolve(func(name string) (string, bool, error) {
+			if name == "BAD" {
+				return "", false, xerr.Lookup("BAD_FILE: unreadable")
+			}
+			return "resolved", true, nil
+		})
+
+		var out bytes.Buffer
+		w := bufio.NewWriterSize(&out, testBufSize)
+		require.NoError(t, p.ProcessStream("test.txt", strings.NewReader("$A"), w))
+		assert.Equal(t, "resolved", out.String())
+
+		err := p.ProcessStream("test.txt", strings.NewReader("x $BAD"), w)
+		assert.EqualError(t, err, "test.txt:1:3: lookup failed: BAD_FILE: unreadable")
+	})
+
 	t.Run("propagates error from engine", func(t *testing.T) {
 		t.Parallel()
 
@@ -52,6 +75,7 @@ func TestProcessStream(t *testing.T) {
 				return "", false
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -63,7 +87,7 @@ func TestProcessStream(t *testing.T) {
 		err := p.ProcessStream("EngineLabel", r, w)
 		require.Error(t, err)
 		// exact message depends on your xerr formatting; keep if stable:
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, "EngineLabel:1:1: VAR: boom")
 		// no flush on error path; output should be empty
 		assert.Equal(t, "", out.String())
 	})
@@ -80,6 +104,7 @@ func TestProcessStream(t *testing.T) {
 				// set but empty -> triggers := assignment
 				return "", true
 			},
+			nil,
 			func(name, val string) error {
 				calls++
 				gotName, gotVal = name, val
@@ -113,6 +138,7 @@ func TestProcessStream(t *testing.T) {
 				return "", false
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -126,4 +152,73 @@ func TestProcessStream(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, input, out.String())
 	})
+
+	t.Run("auto-escape picks the format from the label", func(t *testing.T) {
+		t.Parallel()
+
+		lookup := func(string) (string, bool) { return `say "hi"`, true }
+		for label, want := range map[string]string{
+			"config.json": `{"msg": "say \"hi\""}`,
+			"config.txt":  `{"msg": "say "hi""}`,
+		} {
+			p := NewProcessor(flag.Options{AutoEscape: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+			var out bytes.Buffer
+			w := bufio.NewWriterSize(&out, testBufSize)
+			require.NoError(t, p.ProcessStream(label, strings.NewReader(`{"msg": "$MSG"}`), w))
+			assert.Equal(t, want, out.String(), label)
+		}
+	})
+
+	t.Run("auto-escape format overrides the label", func(t *testing.T) {
+		t.Parallel()
+
+		p := NewProcessor(
+			flag.Options{AutoEscape: true, EscapeFormat: "yaml"},
+			func(string) (string, bool) { return "it's", true },
+			nil,
+			nil,
+			formatter.NewFormatter(false),
+			testBufSize,
+		)
+		var out bytes.Buffer
+		w := bufio.NewWriterSize(&out, testBufSize)
+		require.NoError(t, p.ProcessStream("<stdin>", strings.NewReader("k: '$V'"), w))
+		assert.Equal(t, "k: 'it''s'", out.String())
+	})
+
+	t.Run("config overrides apply per file", func(t *testing.T) {
+		t.Parallel()
+
+		json, yes := "json", true
+		opts := flag.Options{Overrides: []config.Override{
+			{Files: []string{"*.json"}, Format: &json},
+			{Files: []string{"strict/*"}, Strict: &yes},
+		}}
+		p := NewProcessor(opts, func(n string) (string, bool) {
+			return `"q"`, n == "V"
+		}, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		render := func(label, in string) (string, error) {
+			var out bytes.Buffer
+			w := bufio.NewWriterSize(&out, testBufSize)
+			err := p.ProcessStream(label, strings.NewReader(in), w)
+			return out.String(), err
+		}
+
+		got, err := render("app.json", `{"v": "$V"}`)
+		require.NoError(t, err)
+		assert.Equal(t, `{"v": "\"q\""}`, got)
+
+		got, err = render("app.txt", `{"v": "$V"}`)
+		require.NoError(t, err)
+		assert.Equal(t, `{"v": ""q""}`, got)
+
+		_, err = render("strict/app.txt", "$MISSING")
+		require.Error(t, err)
+		assert.True(t, xerr.IsExpansion(err))
+
+		got, err = render("app.txt", "[$MISSING]")
+		require.NoError(t, err)
+		assert.Equal(t, "[]", got)
+	})
 }
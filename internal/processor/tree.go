@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/config"
+)
+
+// ProcessTree renders the directory src recursively into dst, mirroring
+// its layout (--output-dir). Files matching --include (default all) and
+// not --exclude are rendered, with a --strip-suffix suffix removed from
+// their names; other files are copied verbatim. File modes are preserved.
+// Symlinks to files are followed, symlinks to directories and entries
+// starting with ".." (Kubernetes volume internals) are skipped, as is dst
+// when it lies inside src. Under --report-all, a file with expansion
+// errors is not written.
+func (p *Processor) ProcessTree(src, dst string, bufSize int) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New(src + ": not a directory")
+	}
+	skip, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), "..") && rel != "." {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == skip {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0o755)
+		}
+
+		info, err := os.Stat(path) // follows symlinks
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if !p.renders(rel) {
+			return copyTo(path, target, info.Mode())
+		}
+		dir, name := filepath.Split(target)
+		for _, s := range p.opts.StripSuffix {
+			if t, ok := strings.CutSuffix(name, s); ok && t != "" {
+				target = dir + t
+				break
+			}
+		}
+		return p.renderTo(path, target, info.Mode(), bufSize)
+	})
+}
+
+// renders reports whether the file rel (relative to the source directory)
+// is rendered rather than copied.
+func (p *Processor) renders(rel string) bool {
+	if len(p.opts.Include) > 0 && !config.MatchFiles(p.opts.Include, rel) {
+		return false
+	}
+	return !config.MatchFiles(p.opts.Exclude, rel)
+}
+
+// renderTo writes the file src, rendered, to dst with the given mode.
+func (p *Processor) renderTo(src, dst string, mode fs.FileMode, bufSize int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	return writeFile(dst, mode, func(w io.Writer) (bool, error) {
+		seen := p.report.Len()
+		if err := p.ProcessStream(src, bufio.NewReaderSize(in, bufSize), bufio.NewWriterSize(w, bufSize)); err != nil {
+			return false, err
+		}
+		return p.report.Len() == seen, nil
+	})
+}
+
+// copyTo copies the file src verbatim to dst with the given mode.
+func copyTo(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	return writeFile(dst, mode, func(w io.Writer) (bool, error) {
+		_, err := io.Copy(w, in)
+		return err == nil, err
+	})
+}
+
+// writeFile replaces dst with what fill writes, through a temporary file
+// in the same directory so readers never see a partial file. Nothing is
+// written when fill fails or reports false.
+func writeFile(dst string, mode fs.FileMode, fill func(io.Writer) (bool, error)) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".vex-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tmp.Close() }() // safety net; we also close explicitly before rename
+
+	cleanup := func() { _ = os.Remove(tmp.Name()) }
+
+	keep, err := fill(tmp)
+	if err != nil || !keep {
+		cleanup()
+		return err
+	}
+	// match the source mode regardless of the umask
+	if err := tmp.Chmod(mode); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		cleanup()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/xerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates files (relative path -> content) under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		p := filepath.Join(dir, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+// readTree returns the files under dir (relative path -> content).
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	require.NoError(t, filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		got[filepath.ToSlash(rel)] = string(b)
+		return nil
+	}))
+	return got
+}
+
+func TestProcessTree(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(k string) (string, bool) {
+		if k == "V" {
+			return "x", true
+		}
+		return "", false
+	}
+
+	t.Run("renders and copies into the mirrored layout", func(t *testing.T) {
+		t.Parallel()
+		src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+		writeTree(t, src, map[string]string{
+			"a.conf.tmpl":    "a=$V",
+			"sub/b.yaml.tpl": "b: $V",
+			"sub/c.txt":      "c=$V",
+			"img/logo.svg":   "$V",
+			".env.tmpl":      "E=$V",
+		})
+
+		opts := flag.Options{Exclude: []string{"*.svg"}, StripSuffix: []string{".tmpl", ".tpl"}}
+		p := NewProcessor(opts, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessTree(src, dst, testBufSize))
+
+		assert.Equal(t, map[string]string{
+			"a.conf":       "a=x",
+			"sub/b.yaml":   "b: x",
+			"sub/c.txt":    "c=x",
+			"img/logo.svg": "$V",
+			".env":         "E=x",
+		}, readTree(t, dst))
+	})
+
+	t.Run("include limits rendering", func(t *testing.T) {
+		t.Parallel()
+		src, dst := t.TempDir(), t.TempDir()
+		writeTree(t, src, map[string]string{
+			"app/a.tmpl": "$V",
+			"app/b.txt":  "$V",
+			"c.tmpl":     "$V",
+		})
+
+		p := NewProcessor(flag.Options{Include: []string{"app/*.tmpl"}}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessTree(src, dst, testBufSize))
+
+		assert.Equal(t, map[string]string{
+			"app/a.tmpl": "x",
+			"app/b.txt":  "$V",
+			"c.tmpl":     "$V",
+		}, readTree(t, dst))
+	})
+
+	t.Run("preserves modes", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS == "windows" {
+			t.Skip("file modes are not preserved on Windows")
+		}
+		src, dst := t.TempDir(), t.TempDir()
+		writeTree(t, src, map[string]string{"run.sh": "echo $V", "data.bin": "$V"})
+		require.NoError(t, os.Chmod(filepath.Join(src, "run.sh"), 0o750))
+		require.NoError(t, os.Chmod(filepath.Join(src, "data.bin"), 0o600))
+
+		p := NewProcessor(flag.Options{Exclude: []string{"*.bin"}}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessTree(src, dst, testBufSize))
+
+		for name, mode := range map[string]os.FileMode{"run.sh": 0o750, "data.bin": 0o600} {
+			info, err := os.Stat(filepath.Join(dst, name))
+			require.NoError(t, err)
+			assert.Equal(t, mode, info.Mode().Perm(), name)
+		}
+	})
+
+	t.Run("symlinks and volume internals", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks need privileges on Windows")
+		}
+		src, dst := t.TempDir(), t.TempDir()
+		// the layout kubelet uses for ConfigMap volumes
+		writeTree(t, src, map[string]string{"..2025_01_01/app.conf": "$V"})
+		require.NoError(t, os.Symlink("..2025_01_01", filepath.Join(src, "..data")))
+		require.NoError(t, os.Symlink(filepath.Join("..data", "app.conf"), filepath.Join(src, "app.conf")))
+		require.NoError(t, os.Symlink("..2025_01_01", filepath.Join(src, "dirlink")))
+
+		p := NewProcessor(flag.Options{}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessTree(src, dst, testBufSize))
+
+		assert.Equal(t, map[string]string{"app.conf": "x"}, readTree(t, dst))
+	})
+
+	t.Run("output directory inside the source is skipped", func(t *testing.T) {
+		t.Parallel()
+		src := t.TempDir()
+		writeTree(t, src, map[string]string{"a": "$V", "out/stale": "old"})
+
+		p := NewProcessor(flag.Options{}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessTree(src, filepath.Join(src, "out"), testBufSize))
+
+		assert.Equal(t, map[string]string{"a": "$V", "out/a": "x", "out/stale": "old"}, readTree(t, src))
+	})
+
+	t.Run("expansion error leaves no partial file", func(t *testing.T) {
+		t.Parallel()
+		src, dst := t.TempDir(), t.TempDir()
+		writeTree(t, src, map[string]string{"a": "$MISSING"})
+
+		p := NewProcessor(flag.Options{ErrorUnset: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		err := p.ProcessTree(src, dst, testBufSize)
+		require.Error(t, err)
+		assert.True(t, xerr.IsExpansion(err))
+		assert.Empty(t, readTree(t, dst))
+	})
+
+	t.Run("report-all skips failing files and continues", func(t *testing.T) {
+		t.Parallel()
+		src, dst := t.TempDir(), t.TempDir()
+		writeTree(t, src, map[string]string{"a": "$MISSING", "b": "$V"})
+
+		p := NewProcessor(flag.Options{ErrorUnset: true, ReportAll: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessTree(src, dst, testBufSize))
+		require.Error(t, p.Report())
+		assert.Equal(t, map[string]string{"b": "x"}, readTree(t, dst))
+	})
+
+	t.Run("source must be a directory", func(t *testing.T) {
+		t.Parallel()
+		file := filepath.Join(t.TempDir(), "f")
+		require.NoError(t, os.WriteFile(file, nil, 0o600))
+
+		p := NewProcessor(flag.Options{}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		err := p.ProcessTree(file, t.TempDir(), testBufSize)
+		require.Error(t, err)
+		assert.EqualError(t, err, file+": not a directory")
+	})
+}
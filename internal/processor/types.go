@@ -2,38 +2,119 @@ package processor
 
 import (
 	"bufio"
+	"io"
 	"os"
-	"path/filepath"
 
 	"github.com/gi8lino/vex/internal/flag"
 	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/fsm"
+	"github.com/gi8lino/vex/internal/xerr"
 )
 
 // Processor coordinates options, I/O streams, and env access.
 type Processor struct {
 	opts      flag.Options
 	lookup    func(string) (string, bool)
+	resolve   func(string) (string, bool, error) // error-aware lookup (see SetResolve); nil uses lookup
+	names     func() []string                    // enumerates variable names for ${!PREFIX*}
 	setenv    func(string, string) error
 	formatter formatter.Formatter
+	report    *xerr.List                          // collected expansion errors (--report-all, --check), nil otherwise
+	match     *fsm.Matcher                        // name filter, compiled once for all files
+	rename    func(oldpath, newpath string) error // os.Rename; replaced in tests
+	status    func(path string, changed bool)     // per-file outcome of in-place edits (see SetStatus)
 }
 
-// NewProcessor creates a Processor with the given options, env lookup, and formatter.
+// NewProcessor creates a Processor with the given options, env lookup and
+// name enumeration (may be nil), and formatter.
 func NewProcessor(
 	opts flag.Options,
 	lookup func(string) (string, bool),
+	names func() []string,
 	setenv func(string, string) error,
 	fmt formatter.Formatter,
 	ioBufSize int,
 ) *Processor {
-	return &Processor{
+	p := &Processor{
 		opts:      opts,
 		lookup:    lookup,
+		names:     names,
 		setenv:    setenv,
 		formatter: fmt,
+		rename:    os.Rename,
 	}
+	if opts.ReportAll || opts.Check {
+		p.report = &xerr.List{}
+	}
+	p.match, _ = fsm.NewMatcher(opts) // patterns are validated by flag parsing
+	return p
+}
+
+// SetResolve makes p resolve variables with resolve, whose errors fail
+// the reference (see fsm.Engine.Resolve).
+func (p *Processor) SetResolve(resolve func(string) (string, bool, error)) {
+	p.resolve = resolve
+}
+
+// SetStatus makes p report, for every file it edits in place, whether the
+// edit changed it.
+func (p *Processor) SetStatus(status func(path string, changed bool)) {
+	p.status = status
+}
+
+// optsFor returns the options for the input labeled label: p.opts with
+// the matching config file overrides applied in order.
+func (p *Processor) optsFor(label string) flag.Options {
+	opts := p.opts
+	for _, o := range p.opts.Overrides {
+		if !o.Matches(label) {
+			continue
+		}
+		if o.Strict != nil {
+			opts.Strict, opts.ErrorUnset, opts.ErrorEmpty = *o.Strict, *o.Strict, *o.Strict
+		}
+		if o.ErrorUnset != nil {
+			opts.ErrorUnset = *o.ErrorUnset
+		}
+		if o.ErrorEmpty != nil {
+			opts.ErrorEmpty = *o.ErrorEmpty
+		}
+		if opts.Colored {
+			continue // escaping would mangle the color codes
+		}
+		if o.AutoEscape != nil {
+			opts.AutoEscape = *o.AutoEscape
+		}
+		if o.Format != nil {
+			opts.EscapeFormat, opts.AutoEscape = *o.Format, true
+		}
+	}
+	return opts
+}
+
+// escapeFor returns how values in the input labeled label are escaped:
+// not at all without --auto-escape, else per --format or the file extension.
+func escapeFor(opts flag.Options, label string) fsm.EscapeFormat {
+	if !opts.AutoEscape {
+		return fsm.EscapeNone
+	}
+	if f, err := fsm.ParseEscapeFormat(opts.EscapeFormat); err == nil { // validated by flag parsing
+		return f
+	}
+	return fsm.EscapeFormatFor(label)
+}
+
+// Report returns the expansion errors collected under --report-all or --check, or nil.
+func (p *Processor) Report() error {
+	return p.report.Err()
+}
+
+// CheckFiles renders paths without writing anything (--check).
+func (p *Processor) CheckFiles(paths []string, bufSize int) error {
+	return p.ProcessFiles(paths, bufio.NewWriterSize(io.Discard, bufSize), bufSize)
 }
 
-// ProcessFile opens a file and streams it into p.stdout using base name as label.
+// ProcessFile opens a file and streams it into p.stdout using its path as label.
 func (p *Processor) ProcessFile(path string, out *bufio.Writer, bufSize int) error {
 	f, err := os.Open(path)
 	if err != nil {
@@ -42,10 +123,11 @@ func (p *Processor) ProcessFile(path string, out *bufio.Writer, bufSize int) err
 	defer func() { _ = f.Close() }()
 
 	br := bufio.NewReaderSize(f, bufSize)
-	return p.ProcessStream(filepath.Base(path), br, out)
+	return p.ProcessStream(path, br, out)
 }
 
 // ProcessFiles processes multiple files to p.stdout in order.
+// Under --report-all, expansion errors are collected and processing continues.
 func (p *Processor) ProcessFiles(paths []string, out *bufio.Writer, bufSize int) error {
 	for _, path := range paths {
 		if err := p.ProcessFile(path, out, bufSize); err != nil {
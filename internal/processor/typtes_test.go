@@ -33,6 +33,7 @@ func TestProcessFile(t *testing.T) {
 				return "", false
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -55,6 +56,7 @@ func TestProcessFile(t *testing.T) {
 			flag.Options{},
 			nil,
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -79,6 +81,7 @@ func TestProcessFile(t *testing.T) {
 			flag.Options{Colored: false},
 			func(string) (string, bool) { return "", false }, // unset -> error
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -88,7 +91,7 @@ func TestProcessFile(t *testing.T) {
 
 		err := p.ProcessFile(path, w, testBufSize)
 		require.Error(t, err)
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, path+":1:1: VAR: boom")
 		assert.Equal(t, "", out.String()) // no flush on error path
 	})
 }
@@ -119,6 +122,7 @@ func TestProcessFiles(t *testing.T) {
 				}
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -149,6 +153,7 @@ func TestProcessFiles(t *testing.T) {
 				return "", false
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -158,7 +163,7 @@ func TestProcessFiles(t *testing.T) {
 
 		err := p.ProcessFiles([]string{ok, bad}, w, testBufSize)
 		require.Error(t, err)
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, bad+":1:1: VAR: boom")
 		// Data from the first file was flushed before the error in the second.
 		assert.Equal(t, "X=x;", out.String())
 	})
@@ -174,6 +179,7 @@ func TestProcessStdin(t *testing.T) {
 			flag.Options{Colored: false},
 			func(string) (string, bool) { return "", false }, // unset -> default path
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -2,93 +2,360 @@ package processor
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
-// ProcessInPlace performs safe in-place substitution on a file.
+// ProcessInPlace performs safe in-place substitution on a file, keeping
+// its mode, owner (as far as permitted) and extended attributes. A file
+// the substitution does not change is left untouched (no rename, no
+// backup). Under --report-all, a file with expansion errors is left
+// untouched.
 func (p *Processor) ProcessInPlace(path string, ioBufSize int) error {
-	src, err := os.Open(path)
+	pe, err := p.prepare(path, ioBufSize)
+	if err != nil || pe == nil {
+		return err
+	}
+	if pe.same {
+		pe.discard()
+		p.notify(path, false)
+		return nil
+	}
+	if err := p.commit(pe); err != nil {
+		pe.discard()
+		return err
+	}
+	p.settle(pe)
+	p.notify(path, true)
+	return nil
+}
+
+// ProcessInPlaceAll edits paths in place as one transaction (--atomic-all):
+// every file is rendered to its temporary file first, and the originals
+// are only replaced when all of them rendered; unchanged files are left
+// untouched. If replacing one fails, the files already replaced are
+// restored and the backups made of them removed. Under --report-all,
+// expansion errors in any file leave all of them untouched.
+func (p *Processor) ProcessInPlaceAll(paths []string, ioBufSize int) error {
+	pend, err := p.prepareAll(paths, ioBufSize)
+	if err != nil {
+		return err
+	}
+
+	// Keep a hard link (or copy) of each original until all are replaced.
+	var done []*pending
+	for i, pe := range pend {
+		if pe.same {
+			pe.discard()
+			continue
+		}
+		err := pe.keepOriginal()
+		if err == nil {
+			err = p.commit(pe)
+		}
+		if err != nil {
+			if pe.orig != "" {
+				_ = os.Remove(pe.orig) // pe.path still is the original
+			}
+			discardAll(pend[i:])
+			return errors.Join(err, rollback(done))
+		}
+		done = append(done, pe)
+	}
+	for _, pe := range done {
+		p.settle(pe)
+	}
+	for _, pe := range pend {
+		p.notify(pe.name, !pe.same)
+	}
+	return nil
+}
+
+// ProcessInPlaceChecked edits paths in place once all of them rendered
+// (--report-all), so expansion errors in any file leave all of them
+// untouched. Each file is rendered once; unlike ProcessInPlaceAll, the
+// files are then replaced one by one, without rollback.
+func (p *Processor) ProcessInPlaceChecked(paths []string, ioBufSize int) error {
+	pend, err := p.prepareAll(paths, ioBufSize)
 	if err != nil {
 		return err
 	}
+	for i, pe := range pend {
+		if pe.same {
+			pe.discard()
+			p.notify(pe.name, false)
+			continue
+		}
+		if err := p.commit(pe); err != nil {
+			discardAll(pend[i:])
+			return err
+		}
+		p.settle(pe)
+		p.notify(pe.name, true)
+	}
+	return nil
+}
+
+// prepareAll renders paths into their temporary files. It returns none
+// when --report-all collected expansion errors in any of them.
+func (p *Processor) prepareAll(paths []string, ioBufSize int) ([]*pending, error) {
+	var pend []*pending
+	seen := p.report.Len()
+	for _, path := range paths {
+		pe, err := p.prepare(path, ioBufSize)
+		if err != nil {
+			discardAll(pend)
+			return nil, err
+		}
+		if pe != nil {
+			pend = append(pend, pe)
+		}
+	}
+	if p.report.Len() > seen {
+		discardAll(pend)
+		return nil, nil
+	}
+	return pend, nil
+}
+
+// pending is a rendered in-place edit waiting to replace its file.
+type pending struct {
+	path string      // file to replace
+	name string      // path as given; a symlink to path with --follow-symlinks
+	tmp  string      // rendered contents, in the same directory
+	info os.FileInfo // the file before the edit
+	same bool        // the rendered contents equal the original
+	orig string      // --atomic-all: link to the original, for rollback
+	bak  string      // backup made by commit
+	prev string      // simple backup bak replaced, until settle
+}
+
+// prepare renders path into a temporary file next to it, hashing both
+// sides to tell whether the edit changes anything. It returns nil without
+// error when --report-all collected expansion errors for path.
+func (p *Processor) prepare(path string, ioBufSize int) (*pending, error) {
+	return p.stage(path, func(pe *pending, src io.Reader, tmp io.Writer) (bool, error) {
+		same, ok, err := p.render(path, src, tmp, ioBufSize)
+		pe.same = same
+		return ok, err
+	})
+}
+
+// render streams the original src of path to dst, hashing what is read
+// and written to tell whether the edit changes anything. ok is false when
+// --report-all collected expansion errors for path.
+func (p *Processor) render(path string, src io.Reader, dst io.Writer, ioBufSize int) (same, ok bool, err error) {
+	in, out := sha256.New(), sha256.New()
+	bw := bufio.NewWriterSize(io.MultiWriter(dst, out), ioBufSize)
+
+	seen := p.report.Len()
+	if err := p.ProcessStream(path, io.TeeReader(src, in), bw); err != nil {
+		return false, false, err
+	}
+	if p.report.Len() > seen {
+		return false, false, nil
+	}
+	if _, err := io.Copy(in, src); err != nil { // hash whatever rendering did not read
+		return false, false, err
+	}
+	return bytes.Equal(in.Sum(nil), out.Sum(nil)), true, nil
+}
+
+// stage creates the temporary file that will replace path (the file
+// target resolves it to), with the owner, mode and extended attributes of
+// the original, and has fill write its contents from the original src.
+// It returns nil without error when fill reports false.
+func (p *Processor) stage(path string, fill func(pe *pending, src io.Reader, tmp io.Writer) (bool, error)) (*pending, error) {
+	target, src, err := p.open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer func() { _ = src.Close() }()
 
 	st, err := src.Stat()
 	if err != nil {
-		return fmt.Errorf("stat: %w", err)
+		return nil, fmt.Errorf("stat: %w", err)
 	}
 
 	// create a temporary file in same dir
-	dir := filepath.Dir(path)
-	base := filepath.Base(path)
-
-	tmp, err := os.CreateTemp(dir, "."+base+".vex-*")
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".vex-*")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() { _ = tmp.Close() }() // safety net; we also close explicitly before rename
 
-	cleanup := func() { _ = os.Remove(tmp.Name()) }
+	pe := &pending{path: target, name: path, tmp: tmp.Name(), info: st}
 
-	// match permissions of original
+	// match owner (first, as it may clear setuid bits), permissions and
+	// extended attributes of original
+	if err := chown(tmp.Name(), st); err != nil {
+		pe.discard()
+		return nil, err
+	}
 	if err := os.Chmod(tmp.Name(), st.Mode()); err != nil {
-		cleanup()
-		return err
+		pe.discard()
+		return nil, err
+	}
+	if err := copyXattrs(target, tmp.Name()); err != nil {
+		pe.discard()
+		return nil, err
 	}
 
-	// stream process src → tmp
-	bw := bufio.NewWriterSize(tmp, ioBufSize)
-
-	if err := p.ProcessStream(path, src, bw); err != nil {
-		cleanup()
-		return err
+	if keep, err := fill(pe, src, tmp); err != nil || !keep {
+		pe.discard()
+		return nil, err
 	}
 
 	// Ensure data hits disk before rename
 	if err := tmp.Sync(); err != nil {
-		cleanup()
-		return err
+		pe.discard()
+		return nil, err
 	}
 	// Close the temp file before rename (important on Windows)
 	if err := tmp.Close(); err != nil {
-		cleanup()
-		return err
+		pe.discard()
+		return nil, err
+	}
+	return pe, nil
+}
+
+// target returns the file an in-place edit of path replaces: path itself
+// or, with --follow-symlinks, the file the symlink path points to.
+// Without it, symlinks are refused rather than replaced by a regular file.
+func (p *Processor) target(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return path, nil // opening path reports the error
+	}
+	if !p.opts.FollowSymlinks {
+		return "", fmt.Errorf("%s: is a symlink; use --follow-symlinks to edit its target", path)
 	}
+	return filepath.EvalSymlinks(path)
+}
 
-	// create backup if requested (best-effort)
-	if ext := p.opts.BackupExt; ext != "" {
-		bak := path + ext
-		_ = os.Remove(bak) // remove old backup
-		if err := os.Link(path, bak); err != nil {
-			_ = copyFile(path, bak, st.Mode()) // fallback to copy (ignore error)
+// open opens the file an in-place edit of path replaces and returns it
+// with its name.
+func (p *Processor) open(path string) (string, *os.File, error) {
+	target, err := p.target(path)
+	if err != nil {
+		return "", nil, err
+	}
+	f, err := os.Open(target)
+	if err != nil {
+		return "", nil, err
+	}
+	return target, f, nil
+}
+
+// commit backs up the original if requested and replaces it with the
+// rendered file. If replacing fails, the backup is undone.
+func (p *Processor) commit(pe *pending) error {
+	if p.opts.Backups() {
+		if err := p.backup(pe); err != nil {
+			return err
 		}
 	}
+	if err := p.replace(pe, pe.info.ModTime()); err != nil {
+		pe.unbackup()
+		return err
+	}
+	return nil
+}
 
-	// Close source before rename (safer on Windows when replacing)
-	_ = src.Close()
+// settle finishes a committed edit: it drops what rollback would need and
+// the backups beyond --backup-keep.
+func (p *Processor) settle(pe *pending) {
+	for _, name := range []string{pe.orig, pe.prev} {
+		if name != "" {
+			_ = os.Remove(name)
+		}
+	}
+	pe.orig, pe.prev = "", ""
+	p.prune(pe.path)
+}
 
+// replace renames the staged file over the original and sets its
+// modification time to mtime.
+func (p *Processor) replace(pe *pending, mtime time.Time) error {
 	// atomic replace
-	if err := os.Rename(tmp.Name(), path); err != nil {
-		cleanup()
+	if err := p.rename(pe.tmp, pe.path); err != nil {
 		return err
 	}
 
 	// fsync the directory for durability (best-effort)
-	if df, derr := os.Open(dir); derr == nil {
+	if df, derr := os.Open(filepath.Dir(pe.path)); derr == nil {
 		_ = df.Sync()
 		_ = df.Close()
 	}
 
 	// preserve modtime (best-effort)
-	_ = os.Chtimes(path, time.Now(), st.ModTime())
+	_ = os.Chtimes(pe.path, time.Now(), mtime)
 
 	return nil
 }
 
+// notify reports the outcome of editing path to the status callback.
+func (p *Processor) notify(path string, changed bool) {
+	if p.status != nil {
+		p.status(path, changed)
+	}
+}
+
+// discard removes the rendered file.
+func (pe *pending) discard() {
+	_ = os.Remove(pe.tmp)
+}
+
+// discardAll removes the rendered files of list.
+func discardAll(list []*pending) {
+	for _, pe := range list {
+		pe.discard()
+	}
+}
+
+// keepOriginal links (or copies) the original to pe.orig so rollback can
+// restore it.
+func (pe *pending) keepOriginal() error {
+	f, err := os.CreateTemp(filepath.Dir(pe.path), "."+filepath.Base(pe.path)+".vex-orig-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	pe.orig = f.Name()
+	_ = os.Remove(pe.orig) // os.Link needs a free name
+	if err := os.Link(pe.path, pe.orig); err == nil {
+		return nil
+	}
+	if err := copyFile(pe.path, pe.orig, pe.info.Mode()); err != nil {
+		_ = os.Remove(pe.orig)
+		return err
+	}
+	_ = os.Chtimes(pe.orig, time.Now(), pe.info.ModTime())
+	return nil
+}
+
+// rollback moves the originals of done back into place, newest first, and
+// undoes their backups. The backup of a file that cannot be restored is
+// kept.
+func rollback(done []*pending) error {
+	var errs []error
+	for _, pe := range slices.Backward(done) {
+		if err := os.Rename(pe.orig, pe.path); err != nil {
+			errs = append(errs, fmt.Errorf("restore %s: %w (original kept as %s)", pe.path, err, pe.orig))
+			continue
+		}
+		pe.unbackup()
+	}
+	return errors.Join(errs...)
+}
+
 // copyFile duplicates file contents with the given mode.
 // Used as a fallback when hard-linking backups fails.
 func copyFile(src, dst string, mode os.FileMode) error {
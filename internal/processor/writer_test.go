@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -47,6 +48,7 @@ func TestProcessInPlace(t *testing.T) {
 				return "", false
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -93,6 +95,7 @@ func TestProcessInPlace(t *testing.T) {
 				return "Ada", true
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -119,13 +122,14 @@ func TestProcessInPlace(t *testing.T) {
 				return "", false
 			},
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
 
 		err := p.ProcessInPlace(path, testBufSize)
 		require.Error(t, err)
-		assert.EqualError(t, err, "VAR: boom")
+		assert.EqualError(t, err, path+":1:1: VAR: boom")
 
 		// Ensure no lingering temp files matching .<base>.vex-*
 		base := filepath.Base(path)
@@ -137,6 +141,38 @@ func TestProcessInPlace(t *testing.T) {
 		}
 	})
 
+	t.Run("Report-all leaves failing file untouched", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "file.txt")
+		require.NoError(t, os.WriteFile(path, []byte("a=${A}\nb=${B}"), 0o600))
+
+		p := NewProcessor(
+			flag.Options{ErrorUnset: true, ReportAll: true},
+			func(string) (string, bool) { return "", false },
+			nil,
+			nil,
+			formatter.NewFormatter(false),
+			testBufSize,
+		)
+
+		require.NoError(t, p.ProcessInPlace(path, testBufSize))
+
+		got, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "a=${A}\nb=${B}", string(got))
+
+		err = p.Report()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "1:3: variable not set: ${A}")
+		assert.Contains(t, err.Error(), "2:3: variable not set: ${B}")
+
+		entries, listErr := os.ReadDir(dir)
+		require.NoError(t, listErr)
+		assert.Len(t, entries, 1, "temporary file should be cleaned up")
+	})
+
 	t.Run("Open errors are surfaced as I/O errors", func(t *testing.T) {
 		t.Parallel()
 
@@ -147,6 +183,7 @@ func TestProcessInPlace(t *testing.T) {
 			flag.Options{},
 			nil,
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -173,6 +210,7 @@ func TestProcessInPlace(t *testing.T) {
 			func(name string) (string, bool) {
 				return "", false // unset to trigger :=
 			},
+			nil,
 			func(name, val string) error {
 				calls++
 				gotName, gotVal = name, val
@@ -206,6 +244,7 @@ func TestProcessInPlace(t *testing.T) {
 			flag.Options{BackupExt: ".bak"},
 			func(name string) (string, bool) { return "y", true },
 			nil,
+			nil,
 			formatter.NewFormatter(false),
 			testBufSize,
 		)
@@ -222,6 +261,71 @@ func TestProcessInPlace(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, orig, string(bs))
 	})
+	t.Run("Unchanged file is not rewritten", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		same, changed := filepath.Join(dir, "same.txt"), filepath.Join(dir, "changed.txt")
+		require.NoError(t, os.WriteFile(same, []byte("no variables\n"), 0o600))
+		require.NoError(t, os.WriteFile(changed, []byte("X=$X\n"), 0o600))
+		before, err := os.Stat(same)
+		require.NoError(t, err)
+
+		p := NewProcessor(
+			flag.Options{BackupExt: ".bak"},
+			func(name string) (string, bool) { return "y", true },
+			nil,
+			nil,
+			formatter.NewFormatter(false),
+			testBufSize,
+		)
+		var status []string
+		p.SetStatus(func(path string, changed bool) {
+			status = append(status, filepath.Base(path)+map[bool]string{true: " changed", false: " unchanged"}[changed])
+		})
+
+		require.NoError(t, p.ProcessInPlace(same, testBufSize))
+		require.NoError(t, p.ProcessInPlace(changed, testBufSize))
+
+		after, err := os.Stat(same)
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(before, after), "the original file is kept")
+		assert.Equal(t, before.ModTime(), after.ModTime())
+		assert.NoFileExists(t, same+".bak")
+		assert.FileExists(t, changed+".bak")
+		assert.Equal(t, []string{"same.txt unchanged", "changed.txt changed"}, status)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 3, "no temporary file is left")
+	})
+	t.Run("Symlinks are refused or followed", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks need privileges on Windows")
+		}
+		dir := t.TempDir()
+		target, link := filepath.Join(dir, "real", "app.conf"), filepath.Join(dir, "app.conf")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0o755))
+		require.NoError(t, os.WriteFile(target, []byte("v=$V"), 0o600))
+		require.NoError(t, os.Symlink(filepath.Join("real", "app.conf"), link))
+		lookup := func(string) (string, bool) { return "x", true }
+
+		p := NewProcessor(flag.Options{}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		err := p.ProcessInPlace(link, testBufSize)
+		require.Error(t, err)
+		assert.EqualError(t, err, link+": is a symlink; use --follow-symlinks to edit its target")
+
+		p = NewProcessor(flag.Options{FollowSymlinks: true, BackupExt: ".bak"}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessInPlace(link, testBufSize))
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink, "the link is kept")
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "v=x", string(got))
+		assert.FileExists(t, target+".bak")
+	})
 }
 
 func TestCopyFile(t *testing.T) {
@@ -280,3 +384,202 @@ func TestCopyFile(t *testing.T) {
 		assert.Contains(t, err.Error(), dst+": ")
 	})
 }
+
+func TestProcessInPlaceAll(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(k string) (string, bool) { return "new", k == "V" }
+
+	// setup writes files (name -> content) into a temp dir and returns their paths.
+	setup := func(t *testing.T, files ...string) (string, []string) {
+		t.Helper()
+		dir := t.TempDir()
+		var paths []string
+		for i := 0; i < len(files); i += 2 {
+			p := filepath.Join(dir, files[i])
+			require.NoError(t, os.WriteFile(p, []byte(files[i+1]), 0o644))
+			paths = append(paths, p)
+		}
+		return dir, paths
+	}
+
+	// contents returns the files in dir (name -> content).
+	contents := func(t *testing.T, dir string) map[string]string {
+		t.Helper()
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		got := map[string]string{}
+		for _, e := range entries {
+			b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			require.NoError(t, err)
+			got[e.Name()] = string(b)
+		}
+		return got
+	}
+
+	t.Run("replaces all files", func(t *testing.T) {
+		t.Parallel()
+		dir, paths := setup(t, "a", "a=$V", "b", "b=$V")
+		p := NewProcessor(flag.Options{AtomicAll: true, BackupExt: ".bak"}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		require.NoError(t, p.ProcessInPlaceAll(paths, testBufSize))
+		assert.Equal(t, map[string]string{
+			"a": "a=new", "a.bak": "a=$V",
+			"b": "b=new", "b.bak": "b=$V",
+		}, contents(t, dir))
+	})
+
+	t.Run("unchanged files are left alone", func(t *testing.T) {
+		t.Parallel()
+		dir, paths := setup(t, "a", "a=$V", "b", "static")
+		p := NewProcessor(flag.Options{AtomicAll: true, BackupExt: ".bak"}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		changed := map[string]bool{}
+		p.SetStatus(func(path string, c bool) { changed[filepath.Base(path)] = c })
+
+		require.NoError(t, p.ProcessInPlaceAll(paths, testBufSize))
+		assert.Equal(t, map[string]string{"a": "a=new", "a.bak": "a=$V", "b": "static"}, contents(t, dir))
+		assert.Equal(t, map[string]bool{"a": true, "b": false}, changed)
+	})
+
+	t.Run("a failing file leaves every file untouched", func(t *testing.T) {
+		t.Parallel()
+		dir, paths := setup(t, "a", "a=$V", "b", "b=$MISSING", "c", "c=$V")
+		p := NewProcessor(flag.Options{AtomicAll: true, ErrorUnset: true, BackupExt: ".bak"}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		err := p.ProcessInPlaceAll(paths, testBufSize)
+		require.Error(t, err)
+		assert.EqualError(t, err, paths[1]+":1:3: variable not set: $MISSING")
+		assert.Equal(t, map[string]string{"a": "a=$V", "b": "b=$MISSING", "c": "c=$V"}, contents(t, dir))
+	})
+
+	t.Run("report-all collects errors and leaves every file untouched", func(t *testing.T) {
+		t.Parallel()
+		dir, paths := setup(t, "a", "a=$V", "b", "b=$MISSING", "c", "c=$ALSO_MISSING")
+		p := NewProcessor(flag.Options{AtomicAll: true, ErrorUnset: true, ReportAll: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		require.NoError(t, p.ProcessInPlaceAll(paths, testBufSize))
+		err := p.Report()
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "$MISSING")
+		assert.ErrorContains(t, err, "$ALSO_MISSING")
+		assert.Equal(t, map[string]string{"a": "a=$V", "b": "b=$MISSING", "c": "c=$ALSO_MISSING"}, contents(t, dir))
+	})
+
+	t.Run("a failing rename restores the replaced files", func(t *testing.T) {
+		t.Parallel()
+		dir, paths := setup(t, "a", "a=$V", "b", "b=$V", "c", "c=$V")
+		oldTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		require.NoError(t, os.Chtimes(paths[0], oldTime, oldTime))
+
+		p := NewProcessor(flag.Options{AtomicAll: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		p.rename = func(oldpath, newpath string) error {
+			if newpath == paths[2] {
+				return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrPermission}
+			}
+			return os.Rename(oldpath, newpath)
+		}
+
+		err := p.ProcessInPlaceAll(paths, testBufSize)
+		require.Error(t, err)
+		assert.EqualError(t, err, "rename "+paths[2]+": permission denied")
+		assert.Equal(t, map[string]string{"a": "a=$V", "b": "b=$V", "c": "c=$V"}, contents(t, dir))
+
+		info, err := os.Stat(paths[0])
+		require.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(oldTime), "restored file keeps its metadata")
+	})
+
+	t.Run("a failing rename removes the backups of the restored files", func(t *testing.T) {
+		t.Parallel()
+		for _, opts := range []flag.Options{
+			{AtomicAll: true, BackupMode: "numbered", BackupKeep: 2},
+			{AtomicAll: true, BackupExt: ".bak"},
+		} {
+			bdir := t.TempDir()
+			opts.BackupDir = bdir
+			dir, paths := setup(t, "a", "a=$V", "b", "b=$V", "c", "c=$V")
+			p := NewProcessor(opts, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+			// earlier backups, as written by previous runs
+			for _, path := range paths {
+				loc, base, err := p.backupLoc(path)
+				require.NoError(t, err)
+				require.NoError(t, os.MkdirAll(loc, 0o755))
+				for _, name := range []string{base + ".~1~", base + ".~2~", base + ".bak"} {
+					require.NoError(t, os.WriteFile(filepath.Join(loc, name), []byte("old "+name), 0o644))
+				}
+			}
+			loc, _, err := p.backupLoc(paths[0])
+			require.NoError(t, err)
+			before := contents(t, loc)
+
+			p.rename = func(oldpath, newpath string) error {
+				if newpath == paths[2] {
+					return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrPermission}
+				}
+				return os.Rename(oldpath, newpath)
+			}
+			require.Error(t, p.ProcessInPlaceAll(paths, testBufSize))
+			assert.Equal(t, map[string]string{"a": "a=$V", "b": "b=$V", "c": "c=$V"}, contents(t, dir))
+			assert.Equal(t, before, contents(t, loc), "backups are as before (%s%s)", opts.BackupMode, opts.BackupExt)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+		dir, paths := setup(t, "a", "a=$V")
+		p := NewProcessor(flag.Options{AtomicAll: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+
+		err := p.ProcessInPlaceAll(append(paths, filepath.Join(dir, "missing")), testBufSize)
+		require.Error(t, err)
+		assert.Equal(t, map[string]string{"a": "a=$V"}, contents(t, dir))
+	})
+}
+
+func TestProcessInPlaceChecked(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(k string) (string, bool) { return "new", k == "V" }
+	read := func(t *testing.T, path string) string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("replaces the changed files", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+		require.NoError(t, os.WriteFile(a, []byte("a=$V"), 0o644))
+		require.NoError(t, os.WriteFile(b, []byte("static"), 0o644))
+
+		p := NewProcessor(flag.Options{ReportAll: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		changed := map[string]bool{}
+		p.SetStatus(func(path string, c bool) { changed[filepath.Base(path)] = c })
+
+		require.NoError(t, p.ProcessInPlaceChecked([]string{a, b}, testBufSize))
+		require.NoError(t, p.Report())
+		assert.Equal(t, "a=new", read(t, a))
+		assert.Equal(t, "static", read(t, b))
+		assert.Equal(t, map[string]bool{"a": true, "b": false}, changed)
+	})
+
+	t.Run("collected errors leave every file untouched", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+		require.NoError(t, os.WriteFile(a, []byte("a=$V"), 0o644))
+		require.NoError(t, os.WriteFile(b, []byte("b=$MISSING"), 0o644))
+
+		p := NewProcessor(flag.Options{ErrorUnset: true, ReportAll: true}, lookup, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessInPlaceChecked([]string{a, b}, testBufSize))
+		err := p.Report()
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "$MISSING")
+		assert.Equal(t, "a=$V", read(t, a))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2, "no temporary files are left")
+	})
+}
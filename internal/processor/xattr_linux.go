@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// copyXattrs copies the extended attributes of src to dst, which covers
+// POSIX ACLs and SELinux labels. Attributes the filesystem does not
+// support or the user may not set are skipped.
+func copyXattrs(src, dst string) error {
+	list, err := xattr(func(buf []byte) (int, error) { return syscall.Listxattr(src, buf) })
+	if err != nil {
+		if skipXattr(err) {
+			return nil
+		}
+		return fmt.Errorf("list xattrs: %w", err)
+	}
+	for name := range bytes.SplitSeq(list, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		val, err := xattr(func(buf []byte) (int, error) { return syscall.Getxattr(src, attr, buf) })
+		if err == nil {
+			err = syscall.Setxattr(dst, attr, val, 0)
+		}
+		if err != nil && !skipXattr(err) {
+			return fmt.Errorf("copy xattr %s: %w", attr, err)
+		}
+	}
+	return nil
+}
+
+// xattr calls get, which works like getxattr(2), with a buffer large
+// enough for the value.
+func xattr(get func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		n, err := get(nil)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		n, err = get(buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // grew in between
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// skipXattr reports whether err means an attribute cannot be copied here
+// rather than that copying failed.
+func skipXattr(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENODATA)
+}
@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyXattrs(t *testing.T) {
+	t.Parallel()
+
+	t.Run("in-place edits keep extended attributes", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "app.conf")
+		require.NoError(t, os.WriteFile(path, []byte("v=$V"), 0o600))
+		if err := syscall.Setxattr(path, "user.vex.test", []byte("kept"), 0); err != nil {
+			if errors.Is(err, syscall.ENOTSUP) {
+				t.Skip("the temp filesystem has no user xattrs")
+			}
+			require.NoError(t, err)
+		}
+
+		p := NewProcessor(flag.Options{}, func(string) (string, bool) { return "x", true }, nil, nil, formatter.NewFormatter(false), testBufSize)
+		require.NoError(t, p.ProcessInPlace(path, testBufSize))
+
+		got, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "v=x", string(got))
+		val, err := xattr(func(buf []byte) (int, error) { return syscall.Getxattr(path, "user.vex.test", buf) })
+		require.NoError(t, err)
+		assert.Equal(t, "kept", string(val))
+	})
+
+	t.Run("no attributes", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+		require.NoError(t, os.WriteFile(src, nil, 0o600))
+		require.NoError(t, os.WriteFile(dst, nil, 0o600))
+		require.NoError(t, copyXattrs(src, dst))
+	})
+
+	t.Run("missing source", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		err := copyXattrs(filepath.Join(dir, "missing"), filepath.Join(dir, "dst"))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, syscall.ENOENT)
+	})
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package processor
+
+// copyXattrs is a no-op outside Linux.
+func copyXattrs(string, string) error { return nil }
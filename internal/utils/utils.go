@@ -2,58 +2,72 @@ package utils
 
 import (
 	"bufio"
-	"fmt"
-	"io"
 	"maps"
 	"os"
 	"strings"
+
+	"github.com/gi8lino/vex/internal/varsfile"
 )
 
-// MergeVars reads key=value pairs from one or more files
-// and returns a new lookupEnv func that prefers these vars over fallback.
-func MergeVars(files []string, fallback func(string) (string, bool)) (func(string) (string, bool), error) {
+// MergeVars reads vars directories (see varsfile.ReadDir), then vars files
+// (dotenv, JSON, YAML or TOML; see varsfile.Split), and returns the merged
+// vars. Later sources override earlier ones. With opts.Interpolate,
+// references in dotenv values resolve against earlier sources, then lookup
+// (may be nil); otherwise they are kept verbatim.
+func MergeVars(dirs, files []string, opts varsfile.Options, lookup func(string) (string, bool)) (map[string]string, error) {
 	all := make(map[string]string)
 
-	for _, file := range files {
-		f, err := os.Open(file)
+	var resolve func(string) (string, bool)
+	if opts.Interpolate {
+		resolve = func(key string) (string, bool) {
+			if v, ok := all[key]; ok {
+				return v, true
+			}
+			if lookup == nil {
+				return "", false
+			}
+			return lookup(key)
+		}
+	}
+
+	for _, dir := range dirs {
+		vars, err := varsfile.ReadDir(dir, opts)
 		if err != nil {
 			return nil, err
 		}
-		vars, err := readVars(f)
-		_ = f.Close()
+		maps.Copy(all, vars)
+	}
+	for _, file := range files {
+		vars, err := varsfile.Read(file, resolve, opts)
 		if err != nil {
-			return nil, fmt.Errorf("parsing vars in %q: %w", file, err)
+			return nil, err
 		}
 		// merge: later files override earlier ones
 		maps.Copy(all, vars)
 	}
-
-	// Create new lookup func that prefers vars over fallback.
-	return func(key string) (string, bool) {
-		if v, ok := all[key]; ok {
-			return v, true
-		}
-		return fallback(key)
-	}, nil
+	return all, nil
 }
 
-// readVars reads KEY=VAL lines into a map.
-func readVars(r io.Reader) (map[string]string, error) {
-	vars := make(map[string]string)
-	sc := bufio.NewScanner(r)
+// ReadList reads a list file: one entry per line, surrounding blanks
+// trimmed. Blank lines and comments (from '#' at the start of a line or
+// after a blank) are skipped.
+func ReadList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var list []string
+	sc := bufio.NewScanner(f)
 	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i == 0 || i > 0 && (line[i-1] == ' ' || line[i-1] == '\t') {
+			line = line[:i]
 		}
-		k, v, found := strings.Cut(line, "=")
-		if !found {
-			return nil, fmt.Errorf("invalid var line %q (expected KEY=VALUE)", line)
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
 		}
-		vars[strings.TrimSpace(k)] = strings.TrimSpace(v)
-	}
-	if err := sc.Err(); err != nil {
-		return nil, err
 	}
-	return vars, nil
+	return list, sc.Err()
 }
@@ -4,86 +4,39 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"testing"
 
+	"github.com/gi8lino/vex/internal/varsfile"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-type errReader struct{}
-
-func (errReader) Read(p []byte) (int, error) {
-	return 0, fmt.Errorf("boom")
-}
-
-func TestReadVars(t *testing.T) {
-	t.Parallel()
-
-	t.Run("Empty input returns empty map", func(t *testing.T) {
-		t.Parallel()
-		m, err := readVars(strings.NewReader(""))
-		require.NoError(t, err)
-		assert.Equal(t, map[string]string{}, m)
-	})
-
-	t.Run("Ignore comments and blank lines", func(t *testing.T) {
-		t.Parallel()
-		input := "\n# comment\nFOO=bar\n  \n# another\nBAZ = qux  \n"
-		m, err := readVars(strings.NewReader(input))
-		require.NoError(t, err)
-		assert.Equal(t, map[string]string{"FOO": "bar", "BAZ": "qux"}, m)
-	})
-
-	t.Run("Value may contain equals", func(t *testing.T) {
-		t.Parallel()
-		input := "KEY=a=b=c\n"
-		m, err := readVars(strings.NewReader(input))
-		require.NoError(t, err)
-		assert.Equal(t, map[string]string{"KEY": "a=b=c"}, m)
-	})
-
-	t.Run("Invalid line without equals", func(t *testing.T) {
-		t.Parallel()
-		input := "NOTVALID\n"
-		_, err := readVars(strings.NewReader(input))
-		require.Error(t, err)
-		assert.EqualError(t, err, `invalid var line "NOTVALID" (expected KEY=VALUE)`)
-	})
-
-	t.Run("Scanner error is returned", func(t *testing.T) {
-		t.Parallel()
-		_, err := readVars(errReader{})
-		require.Error(t, err)
-		assert.EqualError(t, err, "boom")
-	})
-}
-
 func TestMergeVars(t *testing.T) {
 	t.Parallel()
 
-	t.Run("Single file overrides fallback", func(t *testing.T) {
+	t.Run("File keys shadow lookup", func(t *testing.T) {
 		t.Parallel()
-		path := writeTempFile(t, "FOO=from_file\n")
+		path := writeTempFile(t, "FOO=from_file\nBAR=$FOO\n")
 
-		fallback := func(k string) (string, bool) {
-			if k == "FOO" {
-				return "from_fallback", true
+		lookup := func(k string) (string, bool) {
+			if k == "FOO" || k == "ONLY_LOOKUP" {
+				return "from_lookup", true
 			}
 			return "", false
 		}
 
-		lookup, err := MergeVars([]string{path}, fallback)
+		vars, err := MergeVars(nil, []string{path}, varsfile.Options{Interpolate: true}, lookup)
 		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"FOO": "from_file", "BAR": "from_file"}, vars)
+	})
 
-		v, ok := lookup("FOO")
-		require.True(t, ok)
-		assert.Equal(t, "from_file", v)
+	t.Run("References are kept without interpolation", func(t *testing.T) {
+		t.Parallel()
+		path := writeTempFile(t, "FOO=from_file\nPW=abc$def\nBAR=\"${FOO}\"\n")
 
-		// Key only in fallback
-		v2, ok2 := lookup("ONLY_FALLBACK")
-		assert.False(t, ok2)
-		assert.Equal(t, "", v2)
+		vars, err := MergeVars(nil, []string{path}, varsfile.Options{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"FOO": "from_file", "PW": "abc$def", "BAR": "${FOO}"}, vars)
 	})
 
 	t.Run("Later files override earlier", func(t *testing.T) {
@@ -91,20 +44,9 @@ func TestMergeVars(t *testing.T) {
 		p1 := writeTempFile(t, "A=1\nB=2\n")
 		p2 := writeTempFile(t, "B=22\nC=3\n")
 
-		lookup, err := MergeVars([]string{p1, p2}, nil)
+		vars, err := MergeVars(nil, []string{p1, p2}, varsfile.Options{}, nil)
 		require.NoError(t, err)
-
-		vA, okA := lookup("A")
-		require.True(t, okA)
-		assert.Equal(t, "1", vA)
-
-		vB, okB := lookup("B")
-		require.True(t, okB)
-		assert.Equal(t, "22", vB)
-
-		vC, okC := lookup("C")
-		require.True(t, okC)
-		assert.Equal(t, "3", vC)
+		assert.Equal(t, map[string]string{"A": "1", "B": "22", "C": "3"}, vars)
 	})
 
 	t.Run("Missing file returns enriched error", func(t *testing.T) {
@@ -116,47 +58,62 @@ func TestMergeVars(t *testing.T) {
 		_, openErr := os.Open(missing)
 		require.Error(t, openErr)
 
-		_, err := MergeVars([]string{missing}, nil)
+		_, err := MergeVars(nil, []string{missing}, varsfile.Options{}, nil)
 		require.Error(t, err)
 		assert.EqualError(t, err, openErr.Error())
 	})
 
-	t.Run("Parse error is wrapped with file context", func(t *testing.T) {
+	t.Run("Parse error is positioned in the file", func(t *testing.T) {
 		t.Parallel()
-		path := writeTempFile(t, "GOOD=ok\nBADLINE\n")
+		path := writeTempFile(t, "GOOD=ok\nBAD LINE\n")
 
-		_, err := MergeVars([]string{path}, nil)
+		_, err := MergeVars(nil, []string{path}, varsfile.Options{}, nil)
 		require.Error(t, err)
 
-		expected := fmt.Sprintf(`parsing vars in %q: invalid var line "BADLINE" (expected KEY=VALUE)`, path)
+		expected := fmt.Sprintf(`%s:2:5: syntax error: expected '=' after BAD`, path)
 		assert.EqualError(t, err, expected)
 	})
 
-	t.Run("Lookup falls back when not in files", func(t *testing.T) {
+	t.Run("Values interpolate earlier files and fallback", func(t *testing.T) {
 		t.Parallel()
-		path := writeTempFile(t, "INFILE=1\n")
+		p1 := writeTempFile(t, "HOST=db\n")
+		p2 := writeTempFile(t, "URL=\"postgres://${USER}@${HOST}:${PORT:-5432}\"\n")
 
-		fallback := func(k string) (string, bool) {
-			if k == "FALLBACK" {
-				return "fb", true
+		lookup := func(k string) (string, bool) {
+			if k == "USER" {
+				return "app", true
 			}
 			return "", false
 		}
-
-		lookup, err := MergeVars([]string{path}, fallback)
+		vars, err := MergeVars(nil, []string{p1, p2}, varsfile.Options{Interpolate: true}, lookup)
 		require.NoError(t, err)
+		assert.Equal(t, "postgres://app@db:5432", vars["URL"])
+	})
 
-		v1, ok1 := lookup("INFILE")
-		require.True(t, ok1)
-		assert.Equal(t, "1", v1)
+	t.Run("Structured files are flattened", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		p1 := filepath.Join(dir, "values.yaml")
+		require.NoError(t, os.WriteFile(p1, []byte("db:\n  primary:\n    host: db1\n"), 0o600))
+		p2 := filepath.Join(dir, "values")
+		require.NoError(t, os.WriteFile(p2, []byte(`{"db": {"port": 5432}}`), 0o600))
+		p3 := writeTempFile(t, "URL=${DB_PRIMARY_HOST}:${DB_PORT}\n")
+
+		vars, err := MergeVars(nil, []string{p1, "json:" + p2, p3}, varsfile.Options{Interpolate: true}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"DB_PORT": "5432", "DB_PRIMARY_HOST": "db1", "URL": "db1:5432"}, vars)
+	})
 
-		v2, ok2 := lookup("FALLBACK")
-		require.True(t, ok2)
-		assert.Equal(t, "fb", v2)
+	t.Run("Directories come before files", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "DB_PASSWORD"), []byte("s3cret\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "DB_USER"), []byte("dir"), 0o600))
+		path := writeTempFile(t, "DB_USER=file\nDSN=${DB_USER}:${DB_PASSWORD}\n")
 
-		v3, ok3 := lookup("MISSING")
-		assert.False(t, ok3)
-		assert.Equal(t, "", v3)
+		vars, err := MergeVars([]string{dir}, []string{path}, varsfile.Options{TrimNewline: true, Interpolate: true}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"DB_PASSWORD": "s3cret", "DB_USER": "file", "DSN": "file:s3cret"}, vars)
 	})
 }
 
@@ -168,3 +125,22 @@ func writeTempFile(t *testing.T, content string) string {
 	require.NoError(t, err)
 	return path
 }
+
+func TestReadList(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Entries, comments and blanks", func(t *testing.T) {
+		t.Parallel()
+		path := writeTempFile(t, "# upstreams\nAPI_URL\n\n  DB_HOST  # primary\nA#B\n\t# indented comment\nLAST")
+
+		list, err := ReadList(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"API_URL", "DB_HOST", "A#B", "LAST"}, list)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		t.Parallel()
+		_, err := ReadList(filepath.Join(t.TempDir(), "nope"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
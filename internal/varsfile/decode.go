@@ -0,0 +1,293 @@
+package varsfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// A decoded document is a tree of map[string]any, []any and scalar leaves.
+
+// scalar is a leaf: its text becomes the variable value, raw is its JSON
+// form when the enclosing map or list is exposed as JSON.
+type scalar struct {
+	text string
+	raw  json.RawMessage
+}
+
+func (s scalar) MarshalJSON() ([]byte, error) { return s.raw, nil }
+
+// str returns a string leaf.
+func str(s string) scalar {
+	raw, _ := json.Marshal(s) // strings always marshal
+	return scalar{text: s, raw: raw}
+}
+
+// decode parses r into a tree; the top level must be a map.
+func decode(format Format, r io.Reader) (map[string]any, error) {
+	var (
+		tree any
+		err  error
+	)
+	switch format {
+	case JSON:
+		tree, err = decodeJSON(r)
+	case YAML:
+		tree, err = decodeYAML(r)
+	case TOML:
+		tree, err = decodeTOML(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m, ok := tree.(map[string]any)
+	if !ok {
+		return nil, errors.New("top level must be a map of keys")
+	}
+	return m, nil
+}
+
+func decodeJSON(r io.Reader) (any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber() // keep numbers as written
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the top-level value")
+	}
+	return jsonTree(v), nil
+}
+
+func jsonTree(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = jsonTree(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = jsonTree(e)
+		}
+		return v
+	case string:
+		return str(v)
+	case json.Number:
+		return scalar{text: v.String(), raw: json.RawMessage(v)}
+	case bool:
+		return scalar{text: strconv.FormatBool(v), raw: json.RawMessage(strconv.FormatBool(v))}
+	default: // null
+		return scalar{raw: json.RawMessage("null")}
+	}
+}
+
+func decodeYAML(r io.Reader) (any, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) { // empty document
+			return map[string]any{}, nil
+		}
+		return nil, err
+	}
+	return yamlTree(&doc)
+}
+
+// yamlTree converts a node, resolving aliases and merge keys (<<). Scalars
+// keep the text as written.
+func yamlTree(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return map[string]any{}, nil
+		}
+		return yamlTree(n.Content[0])
+	case yaml.AliasNode:
+		return yamlTree(n.Alias)
+	case yaml.SequenceNode:
+		l := make([]any, len(n.Content))
+		for i, c := range n.Content {
+			v, err := yamlTree(c)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = v
+		}
+		return l, nil
+	case yaml.MappingNode:
+		m := make(map[string]any)
+		// merged keys first, so explicit keys win
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Tag != "!!merge" {
+				continue
+			}
+			v, err := yamlTree(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			srcs, ok := v.([]any)
+			if !ok {
+				srcs = []any{v}
+			}
+			for j := len(srcs) - 1; j >= 0; j-- { // earlier sources win
+				src, ok := srcs[j].(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("line %d: merge value must be a map", n.Content[i+1].Line)
+				}
+				for k, e := range src {
+					m[k] = e
+				}
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, vn := n.Content[i], n.Content[i+1]
+			if k.Tag == "!!merge" {
+				continue
+			}
+			if k.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: keys must be scalars", k.Line)
+			}
+			v, err := yamlTree(vn)
+			if err != nil {
+				return nil, err
+			}
+			m[k.Value] = v
+		}
+		return m, nil
+	default:
+		return yamlScalar(n)
+	}
+}
+
+func yamlScalar(n *yaml.Node) (any, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return scalar{raw: json.RawMessage("null")}, nil
+	case "!!bool", "!!int":
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return scalar{text: n.Value, raw: raw}, nil
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		return number(n.Value, f), nil
+	default:
+		return str(n.Value), nil
+	}
+}
+
+// number returns a float leaf; non-finite values are JSON strings.
+func number(text string, f float64) scalar {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return str(text)
+	}
+	raw, _ := json.Marshal(f) // finite floats always marshal
+	return scalar{text: text, raw: raw}
+}
+
+func decodeTOML(r io.Reader) (any, error) {
+	var v map[string]any
+	if _, err := toml.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	return tomlTree(v), nil
+}
+
+func tomlTree(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = tomlTree(e)
+		}
+		return v
+	case []map[string]any: // array of tables
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = tomlTree(e)
+		}
+		return l
+	case []any:
+		for i, e := range v {
+			v[i] = tomlTree(e)
+		}
+		return v
+	case string:
+		return str(v)
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return scalar{text: s, raw: json.RawMessage(s)}
+	case float64:
+		return number(strconv.FormatFloat(v, 'f', -1, 64), v)
+	case bool:
+		return scalar{text: strconv.FormatBool(v), raw: json.RawMessage(strconv.FormatBool(v))}
+	case time.Time:
+		return str(tomlTime(v))
+	default:
+		return str(fmt.Sprint(v))
+	}
+}
+
+// tomlTime formats t as written: the decoder marks local dates and times
+// with dedicated zones.
+func tomlTime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format(time.DateOnly)
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// flatten stores the leaves of v under names derived from path. Lists are
+// flattened by index; with opts.JSON, nested maps and lists are also stored
+// as JSON.
+func flatten(vars map[string]string, path []string, v any, opts Options) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			if err := flatten(vars, append(path[:len(path):len(path)], k), v[k], opts); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if err := flatten(vars, append(path[:len(path):len(path)], strconv.Itoa(i)), e, opts); err != nil {
+				return err
+			}
+		}
+	case scalar:
+		vars[name(path, opts)] = v.text
+		return nil
+	}
+	if opts.JSON && len(path) > 0 {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		vars[name(path, opts)] = string(raw)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package varsfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	parse := func(t *testing.T, f Format, in string, opts Options) map[string]string {
+		t.Helper()
+		vars, err := Parse(f, "values", strings.NewReader(in), nil, opts)
+		require.NoError(t, err)
+		return vars
+	}
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		in := `{"db": {"primary": {"host": "db1", "port": 5432, "ratio": 1.50}}, "debug": true, "none": null, "hosts": ["a", "b"]}`
+		assert.Equal(t, map[string]string{
+			"DB_PRIMARY_HOST":  "db1",
+			"DB_PRIMARY_PORT":  "5432",
+			"DB_PRIMARY_RATIO": "1.50",
+			"DEBUG":            "true",
+			"NONE":             "",
+			"HOSTS_0":          "a",
+			"HOSTS_1":          "b",
+		}, parse(t, JSON, in, Options{}))
+	})
+
+	t.Run("json rejects trailing data", func(t *testing.T) {
+		t.Parallel()
+		_, err := Parse(JSON, "values", strings.NewReader(`{} {}`), nil, Options{})
+		assert.EqualError(t, err, "values: unexpected data after the top-level value")
+	})
+
+	t.Run("yaml keeps scalars as written", func(t *testing.T) {
+		t.Parallel()
+		in := "db:\n  host: db1\n  port: 0x10\n  ratio: 1.0\n  on: true\n  empty:\n  when: 2024-01-02\nlist:\n  - x\n  - k: v\n"
+		assert.Equal(t, map[string]string{
+			"DB_HOST":  "db1",
+			"DB_PORT":  "0x10",
+			"DB_RATIO": "1.0",
+			"DB_ON":    "true",
+			"DB_EMPTY": "",
+			"DB_WHEN":  "2024-01-02",
+			"LIST_0":   "x",
+			"LIST_1_K": "v",
+		}, parse(t, YAML, in, Options{}))
+	})
+
+	t.Run("yaml anchors and merge keys", func(t *testing.T) {
+		t.Parallel()
+		in := "base: &base\n  host: h\n  port: 1\nother: &other\n  port: 2\n  user: u\napp:\n  <<: [*base, *other]\n  port: 3\ncopy: *base\n"
+		vars := parse(t, YAML, in, Options{})
+		assert.Equal(t, "h", vars["APP_HOST"])
+		assert.Equal(t, "3", vars["APP_PORT"])
+		assert.Equal(t, "u", vars["APP_USER"])
+		assert.Equal(t, "h", vars["COPY_HOST"])
+	})
+
+	t.Run("empty yaml", func(t *testing.T) {
+		t.Parallel()
+		assert.Empty(t, parse(t, YAML, "", Options{}))
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		t.Parallel()
+		in := "title = \"t\"\n[db.primary]\nhost = \"db1\"\nport = 5432\nratio = 0.5\nup = 1979-05-27T07:32:00Z\nday = 1979-05-27\nat = 07:32:00\nlocal = 1979-05-27T07:32:00\n[[servers]]\nname = \"a\"\n[[servers]]\nname = \"b\"\n"
+		assert.Equal(t, map[string]string{
+			"TITLE":            "t",
+			"DB_PRIMARY_HOST":  "db1",
+			"DB_PRIMARY_PORT":  "5432",
+			"DB_PRIMARY_RATIO": "0.5",
+			"DB_PRIMARY_UP":    "1979-05-27T07:32:00Z",
+			"DB_PRIMARY_DAY":   "1979-05-27",
+			"DB_PRIMARY_AT":    "07:32:00",
+			"DB_PRIMARY_LOCAL": "1979-05-27T07:32:00",
+			"SERVERS_0_NAME":   "a",
+			"SERVERS_1_NAME":   "b",
+		}, parse(t, TOML, in, Options{}))
+	})
+
+	t.Run("non-scalar values as json", func(t *testing.T) {
+		t.Parallel()
+		in := "db:\n  hosts: [a, b]\n  port: 5432\n  opts: {}\n"
+		assert.Equal(t, map[string]string{
+			"DB":         `{"hosts":["a","b"],"opts":{},"port":5432}`,
+			"DB_HOSTS":   `["a","b"]`,
+			"DB_HOSTS_0": "a",
+			"DB_HOSTS_1": "b",
+			"DB_OPTS":    `{}`,
+			"DB_PORT":    "5432",
+		}, parse(t, YAML, in, Options{JSON: true}))
+	})
+
+	t.Run("non-finite floats become json strings", func(t *testing.T) {
+		t.Parallel()
+		vars := parse(t, YAML, "l: [.inf, 1.5]\n", Options{JSON: true})
+		assert.Equal(t, `[".inf",1.5]`, vars["L"])
+	})
+
+	t.Run("separator and case", func(t *testing.T) {
+		t.Parallel()
+		in := `{"Db": {"primaryHost": "h"}}`
+		assert.Equal(t, map[string]string{"db__primaryhost": "h"}, parse(t, JSON, in, Options{Separator: "__", Case: Lower}))
+		assert.Equal(t, map[string]string{"Db_primaryHost": "h"}, parse(t, JSON, in, Options{Case: Keep}))
+	})
+}
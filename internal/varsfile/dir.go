@@ -0,0 +1,58 @@
+package varsfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadDir reads a directory of files as vars, the layout Kubernetes uses
+// for secret and configmap volumes: each file name is a key and its
+// content the value. Hidden entries (including the "..data" symlink
+// machinery) and subdirectories are skipped; symlinks to files are followed.
+// With Sanitize, file names that map to the same key are an error.
+func ReadDir(dir string, opts Options) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(entries))
+	files := make(map[string]string, len(entries)) // key -> file name
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		info, err := os.Stat(path) // follow symlinks
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		val := string(b)
+		if opts.TrimNewline {
+			if v, ok := strings.CutSuffix(val, "\n"); ok {
+				val = strings.TrimSuffix(v, "\r")
+			}
+		}
+		key := e.Name()
+		if opts.Sanitize {
+			key = name([]string{key}, Options{Case: Keep})
+			if key[0] >= '0' && key[0] <= '9' {
+				key = "_" + key
+			}
+			if prev, ok := files[key]; ok {
+				return nil, fmt.Errorf("%s: files %q and %q both map to %q", dir, prev, e.Name(), key)
+			}
+			files[key] = e.Name()
+		}
+		vars[key] = val
+	}
+	return vars, nil
+}
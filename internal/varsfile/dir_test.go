@@ -0,0 +1,93 @@
+package varsfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mountDir lays out files the way the kubelet mounts a secret volume.
+func mountDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data := filepath.Join(dir, "..2024_01_01_00_00_00.000000001")
+	require.NoError(t, os.Mkdir(data, 0o755))
+	for k, v := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(data, k), []byte(v), 0o600))
+	}
+	require.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data")))
+	for k := range files {
+		require.NoError(t, os.Symlink(filepath.Join("..data", k), filepath.Join(dir, k)))
+	}
+	return dir
+}
+
+func TestReadDir(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+
+	t.Run("secret volume layout", func(t *testing.T) {
+		t.Parallel()
+		dir := mountDir(t, map[string]string{"DB_PASSWORD": "s3cret\n", "db-user.name": "app"})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0o600))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+
+		vars, err := ReadDir(dir, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"DB_PASSWORD": "s3cret\n", "db-user.name": "app"}, vars)
+	})
+
+	t.Run("trim and sanitize", func(t *testing.T) {
+		t.Parallel()
+		dir := mountDir(t, map[string]string{"a": "x\n\n", "b-c.d": "y\r\n", "e": "z\r"})
+
+		vars, err := ReadDir(dir, Options{TrimNewline: true, Sanitize: true})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "x\n", "b_c_d": "y", "e": "z\r"}, vars)
+	})
+
+	t.Run("sanitize prefixes a leading digit", func(t *testing.T) {
+		t.Parallel()
+		dir := mountDir(t, map[string]string{"1st-key": "x", "2": "y"})
+
+		vars, err := ReadDir(dir, Options{Sanitize: true})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"_1st_key": "x", "_2": "y"}, vars)
+	})
+
+	t.Run("sanitized names clash", func(t *testing.T) {
+		t.Parallel()
+		dir := mountDir(t, map[string]string{"a-b": "x", "a.b": "y"})
+
+		_, err := ReadDir(dir, Options{Sanitize: true})
+		require.Error(t, err)
+		assert.EqualError(t, err, dir+`: files "a-b" and "a.b" both map to "a_b"`)
+
+		vars, err := ReadDir(dir, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a-b": "x", "a.b": "y"}, vars)
+	})
+
+	t.Run("dangling symlink", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		require.NoError(t, os.Symlink("nope", filepath.Join(dir, "KEY")))
+
+		_, err := ReadDir(dir, Options{})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		t.Parallel()
+		_, err := ReadDir(filepath.Join(t.TempDir(), "nope"), Options{})
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,131 @@
+// Package varsfile reads --extra-vars files: dotenv files as well as JSON,
+// YAML and TOML documents, whose nested keys are flattened into variable
+// names (db.primary.host → DB_PRIMARY_HOST). ReadDir reads --vars-dir
+// directories of one file per variable.
+package varsfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/dotenv"
+)
+
+// Format is the syntax of a vars file.
+type Format string
+
+const (
+	Dotenv Format = "env"  // Dotenv is KEY=VALUE (see package dotenv).
+	JSON   Format = "json" // JSON is a JSON object.
+	YAML   Format = "yaml" // YAML is a YAML mapping.
+	TOML   Format = "toml" // TOML is a TOML document.
+)
+
+// prefixes maps the explicit "format:" prefixes to formats.
+var prefixes = map[string]Format{
+	"env": Dotenv, "dotenv": Dotenv,
+	"json": JSON,
+	"yaml": YAML, "yml": YAML,
+	"toml": TOML,
+}
+
+// Case controls the letter case of flattened names.
+type Case string
+
+const (
+	Upper Case = "upper" // Upper upper-cases names (the default).
+	Lower Case = "lower" // Lower lower-cases names.
+	Keep  Case = "keep"  // Keep keeps keys as written.
+)
+
+// Options controls how structured files are flattened and how vars
+// directories are read.
+type Options struct {
+	Separator string // joins nested keys; "_" when empty
+	Case      Case   // letter case of names; Upper when empty
+	JSON      bool   // also expose maps and lists as JSON strings
+
+	Interpolate bool // MergeVars: expand references in dotenv values
+
+	TrimNewline bool // ReadDir: trim one trailing newline from values
+	Sanitize    bool // ReadDir: map file names to valid variable names
+}
+
+// Split returns the format and path of spec, which is either a path
+// ("values.yaml", detected by extension; dotenv otherwise) or a path with
+// an explicit format prefix ("yaml:values", "env:prod.yaml").
+func Split(spec string) (Format, string) {
+	if p, path, ok := strings.Cut(spec, ":"); ok {
+		if f, ok := prefixes[strings.ToLower(p)]; ok {
+			return f, path
+		}
+	}
+	switch strings.ToLower(filepath.Ext(spec)) {
+	case ".json":
+		return JSON, spec
+	case ".yaml", ".yml":
+		return YAML, spec
+	case ".toml":
+		return TOML, spec
+	}
+	return Dotenv, spec
+}
+
+// Read loads the vars file spec (see Split). lookup resolves references in
+// dotenv values.
+func Read(spec string, lookup func(string) (string, bool), opts Options) (map[string]string, error) {
+	format, path := Split(spec)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return Parse(format, path, f, lookup, opts)
+}
+
+// Parse reads vars of the given format from r; label names r in errors.
+func Parse(format Format, label string, r io.Reader, lookup func(string) (string, bool), opts Options) (map[string]string, error) {
+	if format == Dotenv {
+		return dotenv.Parse(label, r, lookup)
+	}
+	tree, err := decode(format, r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+	vars := make(map[string]string)
+	if err := flatten(vars, nil, tree, opts); err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+	return vars, nil
+}
+
+// name joins path into a variable name. Bytes that cannot appear in a
+// name become '_'.
+func name(path []string, opts Options) string {
+	sep := opts.Separator
+	if sep == "" {
+		sep = "_"
+	}
+	parts := make([]string, len(path))
+	for i, p := range path {
+		b := []byte(p)
+		for j, c := range b {
+			if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				b[j] = '_'
+			}
+		}
+		parts[i] = string(b)
+	}
+	n := strings.Join(parts, sep)
+	switch opts.Case {
+	case Lower:
+		return strings.ToLower(n)
+	case Keep:
+		return n
+	default:
+		return strings.ToUpper(n)
+	}
+}
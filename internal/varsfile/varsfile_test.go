@@ -0,0 +1,121 @@
+package varsfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	for spec, want := range map[string]struct {
+		f    Format
+		path string
+	}{
+		"values.json":         {JSON, "values.json"},
+		"conf/app.YAML":       {YAML, "conf/app.YAML"},
+		"app.yml":             {YAML, "app.yml"},
+		"Cargo.toml":          {TOML, "Cargo.toml"},
+		"prod.env":            {Dotenv, "prod.env"},
+		".env":                {Dotenv, ".env"},
+		"yaml:values":         {YAML, "values"},
+		"YML:values.txt":      {YAML, "values.txt"},
+		"env:values.yaml":     {Dotenv, "values.yaml"},
+		"dotenv:x.json":       {Dotenv, "x.json"},
+		"toml:/etc/app.conf":  {TOML, "/etc/app.conf"},
+		"C:\\vars\\app.json":  {JSON, "C:\\vars\\app.json"},
+		"unknown:values.toml": {TOML, "unknown:values.toml"},
+	} {
+		f, path := Split(spec)
+		assert.Equal(t, want.f, f, spec)
+		assert.Equal(t, want.path, path, spec)
+	}
+}
+
+func TestName(t *testing.T) {
+	t.Parallel()
+
+	path := []string{"db", "primary-host", "0"}
+	for _, tc := range []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "DB_PRIMARY_HOST_0"},
+		{Options{Separator: "__"}, "DB__PRIMARY_HOST__0"},
+		{Options{Case: Lower}, "db_primary_host_0"},
+		{Options{Case: Keep, Separator: "_"}, "db_primary_host_0"},
+	} {
+		assert.Equal(t, tc.want, name(path, tc.opts), tc.opts)
+	}
+	assert.Equal(t, "camelCase_a_b", name([]string{"camelCase", "a.b"}, Options{Case: Keep}))
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	t.Run("format from extension", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "values.toml")
+		require.NoError(t, os.WriteFile(path, []byte("[db]\nhost = \"h\"\n"), 0o600))
+		vars, err := Read(path, nil, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"DB_HOST": "h"}, vars)
+	})
+
+	t.Run("format from prefix", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "values")
+		require.NoError(t, os.WriteFile(path, []byte("db:\n  host: h\n"), 0o600))
+		vars, err := Read("yaml:"+path, nil, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"DB_HOST": "h"}, vars)
+	})
+
+	t.Run("dotenv by default", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "vars")
+		require.NoError(t, os.WriteFile(path, []byte("db.host=h\nURL=${USER}@h\n"), 0o600))
+		lookup := func(k string) (string, bool) { return "app", k == "USER" }
+		vars, err := Read(path, lookup, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"db.host": "h", "URL": "app@h"}, vars) // dotenv keys are not rewritten
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+		_, err := Read("json:"+filepath.Join(t.TempDir(), "nope.json"), nil, Options{})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("errors name the file", func(t *testing.T) {
+		t.Parallel()
+		for format, in := range map[Format]string{
+			JSON: `{"a": `,
+			YAML: "a: [1",
+			TOML: "a = ",
+		} {
+			_, err := Parse(format, "values", strings.NewReader(in), nil, Options{})
+			require.Error(t, err, format)
+			assert.True(t, strings.HasPrefix(err.Error(), "values: "), err.Error())
+		}
+	})
+
+	t.Run("top level must be a map", func(t *testing.T) {
+		t.Parallel()
+		_, err := Parse(JSON, "values.json", strings.NewReader(`[1, 2]`), nil, Options{})
+		assert.EqualError(t, err, "values.json: top level must be a map of keys")
+
+		_, err = Parse(YAML, "values.yaml", strings.NewReader("just text"), nil, Options{})
+		assert.EqualError(t, err, "values.yaml: top level must be a map of keys")
+	})
+}
@@ -0,0 +1,84 @@
+package xerr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// List accumulates expansion errors so a run can continue past them.
+// The zero value is ready to use.
+type List struct {
+	errs []error
+}
+
+// Add records err.
+func (l *List) Add(err error) {
+	l.errs = append(l.errs, err)
+}
+
+// Len returns the number of recorded errors; a nil List has none.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.errs)
+}
+
+// Err returns l as an error, or nil when nothing was recorded.
+func (l *List) Err() error {
+	if l == nil || len(l.errs) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Unwrap exposes the recorded errors to errors.Is and errors.As.
+func (l *List) Unwrap() []error {
+	return l.errs
+}
+
+// Error renders all errors grouped by input label, in first-seen order:
+//
+//	a.yaml:
+//	  3:6: variable not set: ${X}
+//	b.yaml:
+//	  1:1: DB: must be set
+//	3 errors in 2 files
+func (l *List) Error() string {
+	var order []string
+	groups := make(map[string][]string)
+	for _, err := range l.errs {
+		label, line := "", err.Error()
+		var pe *PosError
+		if errors.As(err, &pe) {
+			label, line = pe.Label, fmt.Sprintf("%d:%d: %v", pe.Line, pe.Col, pe.Err)
+		}
+		if _, ok := groups[label]; !ok {
+			order = append(order, label)
+		}
+		groups[label] = append(groups[label], line)
+	}
+
+	var b strings.Builder
+	for _, label := range order {
+		indent := ""
+		if label != "" {
+			b.WriteString(label + ":\n")
+			indent = "  "
+		}
+		for _, line := range groups[label] {
+			b.WriteString(indent + line + "\n")
+		}
+	}
+	fmt.Fprintf(&b, "%d %s in %d %s", len(l.errs), plural(len(l.errs), "error"), len(order), plural(len(order), "file"))
+	return b.String()
+}
+
+// plural appends an "s" to word unless n is 1.
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
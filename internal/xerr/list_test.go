@@ -0,0 +1,68 @@
+package xerr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Empty list is no error", func(t *testing.T) {
+		t.Parallel()
+
+		var l List
+		assert.NoError(t, l.Err())
+		assert.Equal(t, 0, l.Len())
+
+		var nilList *List
+		assert.NoError(t, nilList.Err())
+		assert.Equal(t, 0, nilList.Len())
+	})
+
+	t.Run("Groups errors by label in first-seen order", func(t *testing.T) {
+		t.Parallel()
+
+		var l List
+		l.Add(At("b.yaml", 3, 6, "${X}", Unset("${X}")))
+		l.Add(At("a.yaml", 1, 1, "${DB:?set}", User("DB: set")))
+		l.Add(At("b.yaml", 7, 2, "${Y}", Empty("${Y}")))
+
+		err := l.Err()
+		require.Error(t, err)
+		assert.Equal(t, 3, l.Len())
+		assert.Equal(t, "b.yaml:\n"+
+			"  3:6: variable not set: ${X}\n"+
+			"  7:2: substitution empty: ${Y}\n"+
+			"a.yaml:\n"+
+			"  1:1: DB: set\n"+
+			"3 errors in 2 files", err.Error())
+	})
+
+	t.Run("Singular summary", func(t *testing.T) {
+		t.Parallel()
+
+		var l List
+		l.Add(At("c", 2, 1, "${Z}", Unset("${Z}")))
+		assert.Equal(t, "c:\n  2:1: variable not set: ${Z}\n1 error in 1 file", l.Error())
+	})
+
+	t.Run("Unwrap exposes recorded errors", func(t *testing.T) {
+		t.Parallel()
+
+		var l List
+		l.Add(At("c", 2, 1, "${Z}", Unset("${Z}")))
+		l.Add(errors.New("plain"))
+
+		assert.ErrorIs(t, l.Err(), ErrSubst)
+		assert.NotErrorIs(t, l.Err(), ErrEmpty)
+
+		var pe *PosError
+		require.ErrorAs(t, l.Err(), &pe)
+		assert.Equal(t, "c", pe.Label)
+		assert.Contains(t, l.Error(), "plain\n")
+	})
+}
@@ -6,8 +6,13 @@ import (
 )
 
 var (
-	ErrSubst = errors.New("variable not set")   // ErrSubst marks an unset/invalid substitution.
-	ErrEmpty = errors.New("substitution empty") // ErrEmpty marks a substitution that resolved to empty.
+	ErrSubst        = errors.New("variable not set")       // ErrSubst marks an unset/invalid substitution.
+	ErrEmpty        = errors.New("substitution empty")     // ErrEmpty marks a substitution that resolved to empty.
+	ErrUser         = errors.New("user error")             // ErrUser marks a ${VAR?msg} / ${VAR:?msg} failure.
+	ErrUnterminated = errors.New("unterminated reference") // ErrUnterminated marks a ${... without closing brace.
+	ErrSyntax       = errors.New("syntax error")           // ErrSyntax marks a malformed reference found by --check.
+	ErrInvalid      = errors.New("invalid value")          // ErrInvalid marks a value an operator cannot transform (e.g. bad base64).
+	ErrLookup       = errors.New("lookup failed")          // ErrLookup marks a variable whose value could not be read (e.g. a VAR_FILE secret).
 )
 
 // Unset returns an ErrSubst-wrapped error with the given message.
@@ -19,3 +24,103 @@ func Unset(msg string) error {
 func Empty(msg string) error {
 	return fmt.Errorf("%w: %s", ErrEmpty, msg)
 }
+
+// Unterminated returns an ErrUnterminated-wrapped error with the given message.
+func Unterminated(msg string) error {
+	return fmt.Errorf("%w: %s", ErrUnterminated, msg)
+}
+
+// Invalid returns an ErrInvalid-wrapped error with the given message.
+func Invalid(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, msg)
+}
+
+// Lookup returns an ErrLookup-wrapped error with the given message.
+func Lookup(msg string) error {
+	return fmt.Errorf("%w: %s", ErrLookup, msg)
+}
+
+// Syntax returns an ErrSyntax-wrapped error with the given message.
+func Syntax(msg string) error {
+	return fmt.Errorf("%w: %s", ErrSyntax, msg)
+}
+
+// IsSyntax reports whether err means the template itself is malformed.
+func IsSyntax(err error) bool {
+	return errors.Is(err, ErrSyntax) || errors.Is(err, ErrUnterminated)
+}
+
+// userError carries a template-supplied message verbatim.
+type userError struct{ msg string }
+
+func (e *userError) Error() string        { return e.msg }
+func (e *userError) Is(target error) bool { return target == ErrUser }
+
+// User returns an error matching ErrUser whose message is msg, unprefixed.
+func User(msg string) error {
+	return &userError{msg: msg}
+}
+
+// IsExpansion reports whether err stems from expanding a reference
+// (as opposed to an I/O failure).
+func IsExpansion(err error) bool {
+	return errors.Is(err, ErrSubst) ||
+		errors.Is(err, ErrEmpty) ||
+		errors.Is(err, ErrUser) ||
+		errors.Is(err, ErrUnterminated) ||
+		errors.Is(err, ErrSyntax) ||
+		errors.Is(err, ErrInvalid) ||
+		errors.Is(err, ErrLookup)
+}
+
+// exitError attaches a process exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// WithExitCode returns err annotated with the exit code the CLI should use.
+func WithExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// ExitCode returns the exit code attached by WithExitCode, or 1.
+func ExitCode(err error) int {
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return 1
+}
+
+// PosError annotates an expansion error with the location of the reference.
+type PosError struct {
+	Label string // Label identifies the input (file path or "<stdin>").
+	Line  int    // Line is the 1-based line of the reference.
+	Col   int    // Col is the 1-based byte column of the reference.
+	Ref   string // Ref is the reference as written, e.g. "${VAR:?msg}".
+	Err   error  // Err is the underlying expansion error.
+}
+
+// Error formats the error as "label:line:col: message".
+func (e *PosError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %v", e.Label, e.Line, e.Col, e.Err)
+}
+
+// Unwrap returns the underlying expansion error.
+func (e *PosError) Unwrap() error { return e.Err }
+
+// At wraps err in a PosError unless it already carries a position.
+func At(label string, line, col int, ref string, err error) error {
+	var pe *PosError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &PosError{Label: label, Line: line, Col: col, Ref: ref, Err: err}
+}
@@ -1,6 +1,7 @@
 package xerr
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -76,3 +77,129 @@ func TestEmpty(t *testing.T) {
 		assert.NotErrorIs(t, wrapped, ErrSubst)
 	})
 }
+
+func TestUser(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Message is kept verbatim", func(t *testing.T) {
+		t.Parallel()
+
+		err := User("DB: must be set")
+		assert.EqualError(t, err, "DB: must be set")
+		assert.ErrorIs(t, err, ErrUser)
+		assert.NotErrorIs(t, err, ErrSubst)
+	})
+}
+
+func TestUnterminated(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Wraps Unterminated error and preserves message", func(t *testing.T) {
+		t.Parallel()
+
+		err := Unterminated("${A:-b")
+		assert.EqualError(t, err, "unterminated reference: ${A:-b")
+		assert.ErrorIs(t, err, ErrUnterminated)
+	})
+}
+
+func TestIsExpansion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Classifies expansion errors", func(t *testing.T) {
+		t.Parallel()
+
+		assert.True(t, IsExpansion(Unset("x")))
+		assert.True(t, IsExpansion(Empty("x")))
+		assert.True(t, IsExpansion(User("x")))
+		assert.True(t, IsExpansion(Unterminated("x")))
+		assert.True(t, IsExpansion(Invalid("x")))
+		assert.True(t, IsExpansion(Lookup("x")))
+		assert.False(t, IsExpansion(errors.New("disk full")))
+	})
+}
+
+func TestAt(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Formats label, line and column", func(t *testing.T) {
+		t.Parallel()
+
+		err := At("app.yaml", 12, 7, "${X}", Unset("${X}"))
+		assert.EqualError(t, err, "app.yaml:12:7: variable not set: ${X}")
+		assert.ErrorIs(t, err, ErrSubst)
+
+		var pe *PosError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, "${X}", pe.Ref)
+	})
+
+	t.Run("Keeps an existing position", func(t *testing.T) {
+		t.Parallel()
+
+		inner := At("a", 1, 2, "${Y}", Unset("${Y}"))
+		outer := At("a", 9, 9, "${X:-${Y}}", inner)
+		assert.Same(t, inner, outer)
+	})
+}
+
+func TestSyntax(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Wraps Syntax error and classifies it", func(t *testing.T) {
+		t.Parallel()
+
+		err := Syntax("empty pattern: ${A#}")
+		assert.EqualError(t, err, "syntax error: empty pattern: ${A#}")
+		assert.ErrorIs(t, err, ErrSyntax)
+		assert.True(t, IsSyntax(err))
+		assert.True(t, IsSyntax(Unterminated("${A")))
+		assert.False(t, IsSyntax(Unset("${A}")))
+	})
+}
+
+func TestInvalid(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Wraps Invalid error and is not a syntax error", func(t *testing.T) {
+		t.Parallel()
+
+		err := Invalid("V: @b: invalid base64")
+		assert.EqualError(t, err, "invalid value: V: @b: invalid base64")
+		assert.ErrorIs(t, err, ErrInvalid)
+		assert.False(t, IsSyntax(err))
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Defaults to 1", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, 1, ExitCode(errors.New("boom")))
+	})
+
+	t.Run("Uses attached code and keeps message", func(t *testing.T) {
+		t.Parallel()
+
+		err := WithExitCode(3, Unset("${X}"))
+		assert.Equal(t, 3, ExitCode(err))
+		assert.EqualError(t, err, "variable not set: ${X}")
+		assert.ErrorIs(t, err, ErrSubst)
+		assert.NoError(t, WithExitCode(2, nil))
+	})
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Wraps Lookup error and is not a syntax error", func(t *testing.T) {
+		t.Parallel()
+
+		err := Lookup("DB_FILE: open /x: permission denied")
+		assert.EqualError(t, err, "lookup failed: DB_FILE: open /x: permission denied")
+		assert.ErrorIs(t, err, ErrLookup)
+		assert.False(t, IsSyntax(err))
+	})
+}
@@ -0,0 +1,39 @@
+// Package vex expands shell-style variable references in text.
+//
+// It is the importable counterpart of the vex CLI and runs the same
+// tokenizer and state machine, so templates behave identically whether they
+// are rendered by the binary or embedded in a Go program. Think of it as
+// os.Expand with the full vex operator set:
+//
+//	$VAR, ${VAR}
+//	${VAR-word}, ${VAR:-word}, ${VAR=word}, ${VAR:=word}
+//	${VAR+word}, ${VAR:+word}, ${VAR?word}, ${VAR:?word}
+//	${#VAR}, ${VAR:off[:len]}
+//	${VAR#pat}, ${VAR##pat}, ${VAR%pat}, ${VAR%%pat}
+//	${VAR/pat/repl}, ${VAR//pat/repl}, ${VAR/#pat/repl}, ${VAR/%pat/repl}
+//	${VAR~/regex/repl}, ${VAR~/regex/repl/g}
+//	${VAR^}, ${VAR^^}, ${VAR,}, ${VAR,,}
+//	${VAR@Q}, ${VAR@J}, ${VAR@Y}, ${VAR@H}, ${VAR@U}, ${VAR@P}, ${VAR@B}, ${VAR@b},
+//	${VAR@T}, ${VAR@C}, ${VAR@R}, ${VAR@S}, chained as ${VAR@B@J}
+//	${!REF} (and ${!REF<op>word}), ${!PREFIX*}, ${!PREFIX@}
+//
+// Patterns are bash globs (*, ?, [...], [[:class:]], backslash escapes);
+// # and % remove the shortest match, ## and %% the longest.
+//
+// An Expander is configured once with functional options and may then be
+// used concurrently, provided the lookup and setenv functions are safe for
+// concurrent use.
+//
+// Templates rendered many times against different environments can be parsed
+// once with Expander.Compile and rendered with Template.Execute, which skips
+// tokenizing entirely.
+//
+// # Compatibility
+//
+// This package follows semantic versioning together with the vex module.
+// Exported identifiers will not be removed or changed incompatibly within a
+// major version. New options and entry points may be added in minor releases.
+// The rendered output for a given template, environment and option set is
+// part of the contract; bug fixes that change output are called out in the
+// release notes.
+package vex
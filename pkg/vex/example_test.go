@@ -0,0 +1,65 @@
+package vex_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gi8lino/vex/pkg/vex"
+)
+
+func ExampleExpander_ExpandString() {
+	x := vex.New(vex.WithMap(map[string]string{
+		"USER": "alice",
+		"HOME": "/home/alice",
+	}))
+
+	out, err := x.ExpandString("${USER^} is ${HOME:6} at home (${SHELL:-sh})")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(out)
+	// Output: Alice is alice at home (sh)
+}
+
+func ExampleExpander_Expand() {
+	x := vex.New(
+		vex.WithMap(map[string]string{"PORT": "8080"}),
+		vex.WithPrefixes("P"),
+	)
+
+	tmpl := "listen ${PORT}; root $HOME;\n"
+	if err := x.Expand(strings.NewReader(tmpl), os.Stdout); err != nil {
+		fmt.Println(err)
+	}
+	// Output: listen 8080; root $HOME;
+}
+
+func ExampleWithStrict() {
+	x := vex.New(vex.WithMap(nil), vex.WithStrict())
+
+	_, err := x.ExpandString("${MISSING}")
+	fmt.Println(err != nil)
+	// Output: true
+}
+
+func ExampleExpander_Compile() {
+	tpl, err := vex.New().CompileString("db=${DB_HOST:-localhost}:${DB_PORT}\n")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, tenant := range []map[string]string{
+		{"DB_PORT": "5432"},
+		{"DB_HOST": "pg.acme", "DB_PORT": "6432"},
+	} {
+		lookup := func(k string) (string, bool) { v, ok := tenant[k]; return v, ok }
+		if err := tpl.Execute(lookup, os.Stdout); err != nil {
+			fmt.Println(err)
+		}
+	}
+	// Output:
+	// db=localhost:5432
+	// db=pg.acme:6432
+}
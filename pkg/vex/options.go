@@ -0,0 +1,122 @@
+package vex
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/gi8lino/vex/internal/formatter"
+)
+
+// Option configures an Expander.
+type Option func(*Expander)
+
+// WithLookup sets the function used to resolve variables (default os.LookupEnv).
+// A lookup func cannot be enumerated, so ${!PREFIX*} lists nothing unless
+// WithNames is given as well.
+func WithLookup(lookup func(string) (string, bool)) Option {
+	return func(x *Expander) { x.lookup, x.names = lookup, nil }
+}
+
+// WithNames sets the function listing variable names for ${!PREFIX*} and ${!PREFIX@}.
+func WithNames(names func() []string) Option {
+	return func(x *Expander) { x.names = names }
+}
+
+// WithMap resolves and lists variables from m only.
+func WithMap(m map[string]string) Option {
+	return func(x *Expander) {
+		x.lookup = func(name string) (string, bool) {
+			v, ok := m[name]
+			return v, ok
+		}
+		x.names = func() []string { return slices.Collect(maps.Keys(m)) }
+	}
+}
+
+// WithSetenv sets the function called by ${VAR=word} and ${VAR:=word}.
+// Pass os.Setenv to make assignments visible to the process environment.
+func WithSetenv(setenv func(string, string) error) Option {
+	return func(x *Expander) { x.setenv = setenv }
+}
+
+// WithLabel sets the label used to identify the input in diagnostics.
+func WithLabel(label string) Option {
+	return func(x *Expander) { x.label = label }
+}
+
+// WithVariables only expands variables with these exact names.
+func WithVariables(names ...string) Option {
+	return func(x *Expander) { x.opts.Variables = append(x.opts.Variables, names...) }
+}
+
+// WithPrefixes only expands variables starting with one of these prefixes.
+func WithPrefixes(prefixes ...string) Option {
+	return func(x *Expander) { x.opts.Prefix = append(x.opts.Prefix, prefixes...) }
+}
+
+// WithSuffixes only expands variables ending with one of these suffixes.
+func WithSuffixes(suffixes ...string) Option {
+	return func(x *Expander) { x.opts.Suffix = append(x.opts.Suffix, suffixes...) }
+}
+
+// WithStrict fails on unset and empty variables (WithErrorUnset + WithErrorEmpty)
+// and on references missing their closing brace.
+func WithStrict() Option {
+	return func(x *Expander) {
+		x.opts.Strict = true
+		x.opts.ErrorUnset, x.opts.ErrorEmpty = true, true
+	}
+}
+
+// WithErrorUnset fails with ErrUnset when a referenced variable is unset.
+func WithErrorUnset() Option {
+	return func(x *Expander) { x.opts.ErrorUnset = true }
+}
+
+// WithErrorEmpty fails with ErrEmpty when a reference resolves to empty.
+func WithErrorEmpty() Option {
+	return func(x *Expander) { x.opts.ErrorEmpty = true }
+}
+
+// WithKeepUnset leaves references to unset variables as literals.
+func WithKeepUnset() Option {
+	return func(x *Expander) { x.opts.KeepUnset = true }
+}
+
+// WithKeepEmpty leaves references to empty variables as literals.
+func WithKeepEmpty() Option {
+	return func(x *Expander) { x.opts.KeepEmpty = true }
+}
+
+// WithKeepVars leaves unset and empty references as literals.
+func WithKeepVars() Option {
+	return func(x *Expander) {
+		x.opts.KeepVars = true
+		x.opts.KeepUnset, x.opts.KeepEmpty = true, true
+	}
+}
+
+// WithNoOps treats operator forms as literals (envsubst-compatible mode).
+func WithNoOps() Option {
+	return func(x *Expander) { x.opts.NoOps = true }
+}
+
+// WithLiteralDollar disables the \$ escape; the two bytes are kept as-is.
+func WithLiteralDollar() Option {
+	return func(x *Expander) { x.opts.NoEscape = true }
+}
+
+// WithFormatter decorates output with f.
+func WithFormatter(f Formatter) Option {
+	return func(x *Expander) { x.format = f }
+}
+
+// WithColor decorates output with ANSI colors, like the CLI's --colored.
+// Unset and empty references are kept so they remain visible.
+func WithColor() Option {
+	return func(x *Expander) {
+		x.format = formatter.NewFormatter(true)
+		x.opts.Colored = true
+		x.opts.KeepUnset, x.opts.KeepEmpty = true, true
+	}
+}
@@ -0,0 +1,159 @@
+package vex
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gi8lino/vex/internal/flag"
+	"github.com/gi8lino/vex/internal/formatter"
+	"github.com/gi8lino/vex/internal/fsm"
+	"github.com/gi8lino/vex/internal/xerr"
+)
+
+var (
+	ErrUnset        = xerr.ErrSubst        // ErrUnset marks a reference to an unset variable under WithErrorUnset.
+	ErrEmpty        = xerr.ErrEmpty        // ErrEmpty marks a reference that resolved to empty under WithErrorEmpty.
+	ErrUser         = xerr.ErrUser         // ErrUser marks a ${VAR?msg} / ${VAR:?msg} failure.
+	ErrUnterminated = xerr.ErrUnterminated // ErrUnterminated marks a ${... without closing brace under WithStrict.
+)
+
+// PosError is the error returned for a failing reference. It carries the
+// input label (see WithLabel), the 1-based line and column of the reference
+// and the reference text; extract it with errors.As.
+type PosError = xerr.PosError
+
+// Formatter decorates substituted values and diagnostics.
+// Its method set matches the one used by the CLI, so custom implementations
+// can be used for both plain and colored rendering.
+type Formatter interface {
+	OkStr(string) string        // OkStr formats a successful substitution.
+	DefaultStr(string) string   // DefaultStr formats a value that comes from a default/fallback.
+	UserErrorStr(string) string // UserErrorStr formats a user error message (${VAR:?msg}).
+	FilterStr(string) string    // FilterStr formats a filtered variable.
+	EmptyStr(string) string     // EmptyStr formats an empty variable.
+	UnsetStr(string) string     // UnsetStr formats an unset variable.
+	ErrorStr(string) string     // ErrorStr formats an engine/internal error.
+}
+
+// Expander expands variable references using a fixed configuration.
+type Expander struct {
+	label  string
+	opts   flag.Options
+	lookup func(string) (string, bool)
+	names  func() []string
+	setenv func(string, string) error
+	format Formatter
+}
+
+// New returns an Expander configured by opts.
+// Without options, variables are resolved with os.LookupEnv (and listed
+// from os.Environ for ${!PREFIX*}), assignments
+// (${VAR:=word}) are discarded and output is not decorated.
+func New(opts ...Option) *Expander {
+	x := &Expander{
+		label:  "<input>",
+		lookup: os.LookupEnv,
+		names:  environNames,
+		setenv: func(string, string) error { return nil },
+		format: formatter.NewFormatter(false),
+	}
+	for _, o := range opts {
+		o(x)
+	}
+	return x
+}
+
+// engine returns an fsm.Engine configured like x.
+func (x *Expander) engine() *fsm.Engine {
+	return &fsm.Engine{
+		Label:  x.label,
+		Opts:   x.opts,
+		Lookup: x.lookup,
+		Names:  x.names,
+		Setenv: x.setenv,
+		Format: x.format,
+	}
+}
+
+// environNames lists the names in the process environment.
+func environNames() []string {
+	env := os.Environ()
+	names := make([]string, 0, len(env))
+	for _, kv := range env {
+		if k, _, ok := strings.Cut(kv, "="); ok && k != "" {
+			names = append(names, k)
+		}
+	}
+	return names
+}
+
+// Expand reads a template from r and writes the expanded result to w.
+func (x *Expander) Expand(r io.Reader, w io.Writer) error {
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriter(w)
+	}
+	if err := x.engine().Consume(r, bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ExpandString expands s and returns the result.
+func (x *Expander) ExpandString(s string) (string, error) {
+	var b strings.Builder
+	if err := x.Expand(strings.NewReader(s), &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// ExpandBytes expands b and returns the result.
+func (x *Expander) ExpandBytes(b []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(b))
+	if err := x.Expand(bytes.NewReader(b), &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Template is a parsed template that renders without re-parsing.
+// It is safe for concurrent use when the lookup passed to Execute is.
+type Template struct {
+	t *fsm.Template
+}
+
+// Compile parses a template from r for repeated rendering with Execute.
+// Errors that depend on variable values are reported by Execute.
+func (x *Expander) Compile(r io.Reader) (*Template, error) {
+	t, err := x.engine().Compile(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{t: t}, nil
+}
+
+// CompileString parses s; see Compile.
+func (x *Expander) CompileString(s string) (*Template, error) {
+	return x.Compile(strings.NewReader(s))
+}
+
+// Execute renders the template to w, resolving variables with lookup.
+// A nil lookup uses the Expander's (see WithLookup). Under a custom
+// lookup, ${!PREFIX*} expands to nothing, as lookup cannot list names.
+func (t *Template) Execute(lookup func(string) (string, bool), w io.Writer) error {
+	return t.t.Execute(lookup, w)
+}
+
+// ExecuteString renders the template and returns the result; see Execute.
+func (t *Template) ExecuteString(lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(lookup, &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
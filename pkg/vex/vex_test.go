@@ -0,0 +1,238 @@
+package vex_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gi8lino/vex/pkg/vex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bracketFormatter struct{}
+
+func (bracketFormatter) OkStr(s string) string        { return "[" + s + "]" }
+func (bracketFormatter) DefaultStr(s string) string   { return "<" + s + ">" }
+func (bracketFormatter) UserErrorStr(s string) string { return s }
+func (bracketFormatter) FilterStr(s string) string    { return s }
+func (bracketFormatter) EmptyStr(s string) string     { return s }
+func (bracketFormatter) UnsetStr(s string) string     { return s }
+func (bracketFormatter) ErrorStr(s string) string     { return s }
+
+func TestExpander(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"NAME": "ada", "EMPTY": "", "APP_PORT": "80"}
+
+	t.Run("ExpandString resolves operators", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env))
+		out, err := x.ExpandString("${NAME^^}:${MISSING:-x}:${#NAME}")
+		require.NoError(t, err)
+		assert.Equal(t, "ADA:x:3", out)
+	})
+
+	t.Run("ExpandBytes resolves variables", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env))
+		out, err := x.ExpandBytes([]byte("hi $NAME"))
+		require.NoError(t, err)
+		assert.Equal(t, "hi ada", string(out))
+	})
+
+	t.Run("Expand streams to writer", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env))
+		var out bytes.Buffer
+		require.NoError(t, x.Expand(strings.NewReader("a ${NAME} b"), &out))
+		assert.Equal(t, "a ada b", out.String())
+	})
+
+	t.Run("WithLookup overrides resolution", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithLookup(func(name string) (string, bool) { return strings.ToLower(name), true }))
+		out, err := x.ExpandString("$FOO")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", out)
+	})
+
+	t.Run("WithSetenv receives assignments", func(t *testing.T) {
+		t.Parallel()
+		got := map[string]string{}
+		x := vex.New(
+			vex.WithMap(nil),
+			vex.WithSetenv(func(k, v string) error { got[k] = v; return nil }),
+		)
+		out, err := x.ExpandString("${X:=1}")
+		require.NoError(t, err)
+		assert.Equal(t, "1", out)
+		assert.Equal(t, map[string]string{"X": "1"}, got)
+	})
+
+	t.Run("Default discards assignments", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(nil))
+		out, err := x.ExpandString("${X:=1}")
+		require.NoError(t, err)
+		assert.Equal(t, "1", out)
+	})
+
+	t.Run("Filters restrict expansion", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithPrefixes("APP_"), vex.WithVariables("NAME"))
+		out, err := x.ExpandString("$APP_PORT $NAME $HOME")
+		require.NoError(t, err)
+		assert.Equal(t, "80 ada $HOME", out)
+	})
+
+	t.Run("WithSuffixes restricts expansion", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithSuffixes("_PORT"))
+		out, err := x.ExpandString("$APP_PORT $NAME")
+		require.NoError(t, err)
+		assert.Equal(t, "80 $NAME", out)
+	})
+
+	t.Run("WithErrorUnset reports ErrUnset", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithErrorUnset())
+		_, err := x.ExpandString("${MISSING}")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, vex.ErrUnset))
+	})
+
+	t.Run("WithStrict reports ErrEmpty", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithStrict())
+		_, err := x.ExpandString("${EMPTY}")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, vex.ErrEmpty))
+	})
+
+	t.Run("errors carry position", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithLabel("tmpl"))
+		_, err := x.ExpandString("a\nb ${MISSING:?required}")
+		require.EqualError(t, err, "tmpl:2:3: MISSING: required")
+
+		var pe *vex.PosError
+		require.True(t, errors.As(err, &pe))
+		assert.Equal(t, 2, pe.Line)
+		assert.Equal(t, 3, pe.Col)
+		assert.Equal(t, "${MISSING:?required}", pe.Ref)
+		assert.True(t, errors.Is(err, vex.ErrUser))
+	})
+
+	t.Run("WithKeepVars keeps literals", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithKeepVars())
+		out, err := x.ExpandString("${MISSING}|${EMPTY}|$NAME")
+		require.NoError(t, err)
+		assert.Equal(t, "${MISSING}|${EMPTY}|ada", out)
+	})
+
+	t.Run("WithKeepUnset and WithKeepEmpty", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithKeepUnset())
+		out, err := x.ExpandString("${MISSING}|${EMPTY}")
+		require.NoError(t, err)
+		assert.Equal(t, "${MISSING}|", out)
+
+		x = vex.New(vex.WithMap(env), vex.WithKeepEmpty())
+		out, err = x.ExpandString("${MISSING}|${EMPTY}")
+		require.NoError(t, err)
+		assert.Equal(t, "|${EMPTY}", out)
+	})
+
+	t.Run("WithNoOps keeps operator forms literal", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithNoOps())
+		out, err := x.ExpandString("${NAME:-x}")
+		require.NoError(t, err)
+		assert.Equal(t, "${NAME:-x}", out)
+	})
+
+	t.Run("WithLiteralDollar disables escape", func(t *testing.T) {
+		t.Parallel()
+		out, err := vex.New(vex.WithMap(env)).ExpandString(`\$NAME`)
+		require.NoError(t, err)
+		assert.Equal(t, "$NAME", out)
+
+		out, err = vex.New(vex.WithMap(env), vex.WithLiteralDollar()).ExpandString(`\$NAME`)
+		require.NoError(t, err)
+		assert.Equal(t, `\ada`, out)
+	})
+
+	t.Run("WithFormatter decorates values", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithFormatter(bracketFormatter{}))
+		out, err := x.ExpandString("$NAME ${X:-d}")
+		require.NoError(t, err)
+		assert.Equal(t, "[ada] <d>", out)
+	})
+
+	t.Run("WithColor keeps unset visible", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithColor())
+		out, err := x.ExpandString("${MISSING}")
+		require.NoError(t, err)
+		assert.Contains(t, out, "${MISSING}")
+		assert.Contains(t, out, "\x1b[")
+	})
+
+	t.Run("Compile renders against many lookups", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env))
+		tpl, err := x.CompileString("${NAME^}:${MISSING:-${NAME}}")
+		require.NoError(t, err)
+
+		out, err := tpl.ExecuteString(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Ada:ada", out)
+
+		out, err = tpl.ExecuteString(func(string) (string, bool) { return "bob", true })
+		require.NoError(t, err)
+		assert.Equal(t, "Bob:bob", out)
+	})
+
+	t.Run("Execute reports positioned errors", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(env), vex.WithLabel("t.tpl"), vex.WithErrorUnset())
+		tpl, err := x.CompileString("a\n $NOPE")
+		require.NoError(t, err)
+		_, err = tpl.ExecuteString(nil)
+		require.ErrorIs(t, err, vex.ErrUnset)
+		var pe *vex.PosError
+		require.True(t, errors.As(err, &pe))
+		assert.Equal(t, 2, pe.Line)
+		assert.Equal(t, 2, pe.Col)
+	})
+
+	t.Run("Compile rejects unterminated references under WithStrict", func(t *testing.T) {
+		t.Parallel()
+		_, err := vex.New(vex.WithStrict()).CompileString("${OPEN")
+		require.ErrorIs(t, err, vex.ErrUnterminated)
+	})
+
+	t.Run("Indirect and prefix listing", func(t *testing.T) {
+		t.Parallel()
+		x := vex.New(vex.WithMap(map[string]string{"REF": "APP_B", "APP_B": "b", "APP_A": "a"}))
+		out, err := x.ExpandString("${!REF} ${!REF^} [${!APP_*}]")
+		require.NoError(t, err)
+		assert.Equal(t, "b B [APP_A APP_B]", out)
+	})
+
+	t.Run("WithLookup without WithNames lists nothing", func(t *testing.T) {
+		t.Parallel()
+		lookup := func(string) (string, bool) { return "x", true }
+		out, err := vex.New(vex.WithLookup(lookup)).ExpandString("[${!A*}]")
+		require.NoError(t, err)
+		assert.Equal(t, "[]", out)
+
+		out, err = vex.New(vex.WithLookup(lookup), vex.WithNames(func() []string { return []string{"A1"} })).ExpandString("[${!A*}]")
+		require.NoError(t, err)
+		assert.Equal(t, "[A1]", out)
+	})
+}